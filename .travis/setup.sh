@@ -9,6 +9,8 @@
 # - testing directories set up
 # - a xfs filesystem mounted in a loopback
 #   device.
+# - an ext4 filesystem with project quotas
+#   mounted in a loopback device.
 
 set -o errexit
 
@@ -16,6 +18,7 @@ main() {
   install_dependencies
   create_xfs_loopback_device
   create_xfs_loopback_device_without_project_quota
+  create_ext4_loopback_device
   create_testing_directory
 
   lsblk
@@ -44,7 +47,7 @@ create_xfs_loopback_device() {
 
   sudo dd if=/dev/zero of=/xfs.512M.1 bs=1M count=512
   sudo losetup /dev/loop0 /xfs.512M.1
-  sudo mkfs -t xfs /dev/loop0
+  sudo mkfs -t xfs -n ftype=1 /dev/loop0
   sudo mkdir -p /mnt/xfs
   sudo mount /dev/loop0 /mnt/xfs -o pquota
 
@@ -70,13 +73,30 @@ create_xfs_loopback_device_without_project_quota() {
   "
 }
 
+create_ext4_loopback_device() {
+  echo "INFO:
+  Creating ext4 loopback device with project
+  quota support.
+  "
+
+  sudo dd if=/dev/zero of=/ext4.512M.1 bs=1M count=512
+  sudo losetup /dev/loop2 /ext4.512M.1
+  sudo mkfs -t ext4 -O quota,project -I 256 /dev/loop2
+  sudo mkdir -p /mnt/ext4
+  sudo mount /dev/loop2 /mnt/ext4 -o prjquota
+
+  echo "SUCCESS:
+  Device created.
+  "
+}
+
 create_testing_directory() {
   echo "INFO:
-  Creating testing directory '/mnt/xfs/tmp'.
+  Creating testing directories '/mnt/xfs/tmp' and '/mnt/ext4/tmp'.
   "
 
-  sudo mkdir -p /mnt/xfs/tmp
-  sudo chown -R $(whoami) /mnt/xfs/tmp
+  sudo mkdir -p /mnt/xfs/tmp /mnt/ext4/tmp
+  sudo chown -R $(whoami) /mnt/xfs/tmp /mnt/ext4/tmp
 
   echo "SUCCESS:
   Testing directory created
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"github.com/cirocosta/xfsvol/xfs"
+)
+
+// QuotaBackend is the set of quota operations that the manager
+// relies on to have volumes' limits applied and retrieved.
+//
+// `*xfs.Control` is the implementation used in production while
+// `xfstest.Backend` is an in-memory implementation meant for tests.
+type QuotaBackend interface {
+	// SetQuota assigns a project id to a directory (if it
+	// doesn't have one yet) and sets the quota of the project.
+	SetQuota(targetPath string, quota xfs.Quota) error
+
+	// GetQuota retrieves the quota (limits and usage) of the
+	// project associated with a directory.
+	GetQuota(targetPath string) (*xfs.Quota, error)
+
+	// RemoveQuota resets the limits of the project associated
+	// with a directory and releases its project id.
+	RemoveQuota(targetPath string) error
+
+	// AssignProjectId retrieves the project id associated
+	// with a directory, assigning a fresh one to it in case
+	// it has none.
+	AssignProjectId(targetPath string) (projectId uint32, err error)
+
+	// GetProjectId retrieves the project id associated with
+	// a directory.
+	GetProjectId(targetPath string) (projectId uint32, found bool)
+
+	// ListProjectQuotas retrieves the quotas of every project
+	// known by the backend.
+	ListProjectQuotas() ([]xfs.ProjectQuota, error)
+
+	// GetSizeGranularity retrieves the unit (in bytes) in
+	// which size limits get stored, with requested ones
+	// rounded down to a multiple of it.
+	GetSizeGranularity() (granularity uint64)
+
+	// Refresh rebuilds any cached state from the underlying
+	// storage.
+	Refresh() error
+}
+
+var _ QuotaBackend = &xfs.Control{}
@@ -0,0 +1,247 @@
+package manager_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/cirocosta/xfsvol/xfs/xfstest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ manager.QuotaBackend = &xfstest.Backend{}
+
+// newFakeManager creates a manager backed by an in-memory
+// quota backend under a regular temporary directory.
+func newFakeManager(t *testing.T) (m *manager.Manager, backend *xfstest.Backend, dir string) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+
+	backend = xfstest.NewBackend()
+	m, err = manager.New(manager.Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.NoError(t, err)
+	return
+}
+
+// createVolume creates a volume with a given name and size limit,
+// returning the path to it.
+func createVolume(t *testing.T, m *manager.Manager, name, size string) (absPath string) {
+	absPath, err := m.Create(manager.Volume{
+		Name: name,
+		Size: manager.MustFromHumanSize(size),
+	})
+	assert.NoError(t, err)
+	return
+}
+
+// assertNoQuotas asserts that no project quota is left behind in
+// a given backend.
+func assertNoQuotas(t *testing.T, backend *xfstest.Backend) {
+	quotas, err := backend.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 0)
+}
+
+func TestFakeBackend_createAndGet(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(manager.Volume{
+		Name:     "abc",
+		Size:     manager.MustFromHumanSize("10MB"),
+		SoftSize: manager.MustFromHumanSize("8MB"),
+		INode:    100,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "abc"), absPath)
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, "8MB", manager.HumanSize(vol.SoftSize))
+	assert.Equal(t, uint64(100), vol.INode)
+}
+
+func TestFakeBackend_enforcesVolumeLimits(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "abc", "1MB")
+
+	// the limit is kept rounded down to the backend's
+	// granularity, just like XFS does.
+	vol, _, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000*1000/512*512), vol.Size)
+
+	assert.NoError(t, backend.Use(absPath, int64(vol.Size), 1))
+
+	err = backend.Use(absPath, 1, 0)
+	assert.Error(t, err)
+	assert.Equal(t, syscall.EDQUOT, errors.Cause(err))
+}
+
+func TestFakeBackend_deleteReleasesQuota(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "abc", "1MB")
+
+	assert.NoError(t, m.Delete("abc"))
+
+	_, found := backend.GetProjectId(absPath)
+	assert.False(t, found)
+
+	assertNoQuotas(t, backend)
+
+	assert.Error(t, m.Delete("abc"))
+}
+
+func TestFakeBackend_skipsDirectoriesWithoutProjectId(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	assert.NoError(t, os.Mkdir(path.Join(dir, "lost+found"), 0755))
+	assert.NoError(t, os.Mkdir(path.Join(dir, "def"), 0755))
+
+	_, found, err := m.Get("def")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+	assert.Equal(t, "abc", vols[0].Name)
+
+	err = m.Delete("def")
+	assert.Equal(t, manager.ErrNotFound, err)
+}
+
+// projectIdLosingBackend is a backend whose directories lose their
+// project ids right after their quotas get retrieved.
+type projectIdLosingBackend struct {
+	*xfstest.Backend
+}
+
+func (b projectIdLosingBackend) GetProjectId(targetPath string) (projectId uint32, found bool) {
+	return
+}
+
+func TestFakeBackend_skipsDirectoriesThatLoseTheirProjectId(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	m, err := manager.New(manager.Config{
+		Root:    dir,
+		Backend: projectIdLosingBackend{backend},
+	})
+	assert.NoError(t, err)
+
+	_, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFakeBackend_getsVolumesWithoutLimits(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "abc", "10MB")
+
+	assert.NoError(t, backend.SetQuota(absPath, xfs.Quota{}))
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(0), vol.Size)
+
+	assert.NoError(t, m.Delete("abc"))
+}
+
+func TestFakeBackend_reportsUsage(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(manager.Volume{
+		Name:  "abc",
+		Size:  manager.MustFromHumanSize("1MB"),
+		INode: 10,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, backend.Use(absPath, 250*1000, 1))
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint64(250*1000), vol.UsedSize)
+
+	projectId, _ := backend.GetProjectId(absPath)
+	assert.Equal(t, projectId, vol.ProjectId)
+	assert.Equal(t, uint64(1), vol.UsedINode)
+	assert.InDelta(t, 25.0, vol.PercentUsed, 0.01)
+
+	// the percentage is the highest of the size and inode ones
+	assert.NoError(t, backend.Use(absPath, 0, 4))
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+	assert.Equal(t, uint64(5), vols[0].UsedINode)
+	assert.InDelta(t, 50.0, vols[0].PercentUsed, 0.01)
+}
+
+func TestFakeBackend_concurrentCreateDeleteList(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	var (
+		wg      sync.WaitGroup
+		workers = 8
+		rounds  = 20
+	)
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("vol-%d", worker)
+			for round := 0; round < rounds; round++ {
+				_, err := m.Create(manager.Volume{
+					Name: name,
+					Size: manager.MustFromHumanSize("1M"),
+				})
+				assert.NoError(t, err)
+
+				_, err = m.List()
+				assert.NoError(t, err)
+
+				assert.NoError(t, m.Delete(name))
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 0)
+
+	assertNoQuotas(t, backend)
+}
@@ -0,0 +1,156 @@
+package manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeBackend_cloneCopiesContentsIntoNewProject(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	srcPath, err := m.Create(manager.Volume{
+		Name:  "abc",
+		Size:  manager.MustFromHumanSize("10MB"),
+		INode: 100,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Mkdir(path.Join(srcPath, "dir"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(srcPath, "dir", "file"), []byte("content"), 0644))
+
+	dstPath, err := m.Clone("abc", manager.Volume{
+		Name: "def",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "def"), dstPath)
+
+	content, err := ioutil.ReadFile(path.Join(dstPath, "dir", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	srcProjectId, _ := backend.GetProjectId(srcPath)
+	dstProjectId, found := backend.GetProjectId(dstPath)
+	assert.True(t, found)
+	assert.NotEqual(t, srcProjectId, dstProjectId)
+
+	vol, found, err := m.Get("def")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, uint64(100), vol.INode)
+
+	_, err = m.Clone("abc", manager.Volume{
+		Name: "ghi",
+		Size: manager.MustFromHumanSize("20MB"),
+	})
+	assert.NoError(t, err)
+
+	vol, _, err = m.Get("ghi")
+	assert.NoError(t, err)
+	assert.Equal(t, "20MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, uint64(100), vol.INode)
+}
+
+func TestFakeBackend_cloneInheritsOnlyUnsetLimits(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := m.Create(manager.Volume{
+		Name:      "abc",
+		Size:      manager.MustFromHumanSize("10MB"),
+		SoftSize:  manager.MustFromHumanSize("8MB"),
+		INode:     100,
+		SoftINode: 80,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Clone("abc", manager.Volume{
+		Name:  "def",
+		INode: 1000,
+	})
+	assert.NoError(t, err)
+
+	vol, _, err := m.Get("def")
+	assert.NoError(t, err)
+	assert.Equal(t, "10MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, "8MB", manager.HumanSize(vol.SoftSize))
+	assert.Equal(t, uint64(1000), vol.INode)
+	assert.Equal(t, uint64(0), vol.SoftINode)
+
+	// a hard size below the soft size of the source doesn't
+	// get the soft size inherited.
+	_, err = m.Clone("abc", manager.Volume{
+		Name: "ghi",
+		Size: manager.MustFromHumanSize("5MB"),
+	})
+	assert.NoError(t, err)
+
+	vol, _, err = m.Get("ghi")
+	assert.NoError(t, err)
+	assert.Equal(t, "5MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, uint64(0), vol.SoftSize)
+	assert.Equal(t, uint64(100), vol.INode)
+	assert.Equal(t, uint64(80), vol.SoftINode)
+}
+
+func TestFakeBackend_cloneIsIdempotent(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	var vol = manager.Volume{
+		Name: "def",
+		Size: manager.MustFromHumanSize("20MB"),
+	}
+
+	absPath, err := m.Clone("abc", vol)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("content"), 0644))
+
+	retriedPath, err := m.Clone("abc", vol)
+	assert.NoError(t, err)
+	assert.Equal(t, absPath, retriedPath)
+
+	_, err = os.Stat(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+
+	// retries inheriting the limits of the source match as well
+	_, err = m.Clone("abc", manager.Volume{Name: "ghi"})
+	assert.NoError(t, err)
+
+	_, err = m.Clone("abc", manager.Volume{Name: "ghi"})
+	assert.NoError(t, err)
+
+	vol.Size = manager.MustFromHumanSize("30MB")
+	_, err = m.Clone("abc", vol)
+	assert.Equal(t, manager.ErrConflict, errors.Cause(err))
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 3)
+}
+
+func TestFakeBackend_cloneFailsForMissingSourceOrExistingTarget(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := m.Clone("abc", manager.Volume{Name: "def"})
+	assert.Equal(t, manager.ErrNotFound, errors.Cause(err))
+
+	createVolume(t, m, "abc", "10MB")
+
+	_, err = m.Clone("abc", manager.Volume{Name: "abc"})
+	assert.Equal(t, manager.ErrExists, err)
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+}
@@ -0,0 +1,275 @@
+package manager
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ficlone is the FICLONE ioctl (_IOW(0x94, 9, int)), which
+	// makes a file share all of the extents of another one
+	// (reflink) such that no data gets copied until modified.
+	ficlone = 0x40049409
+)
+
+// copyTree recreates the tree under `src` in `dst` (an existing
+// directory), preserving modes, ownership, extended attributes
+// and modification times.
+//
+// Regular files are cloned with reflinks (copy-on-write) when
+// the filesystem supports it (e.g., XFS formatted with
+// `reflink=1`), falling back to copying their bytes otherwise.
+// Directories, symlinks and special files are recreated.
+//
+// Hard links are not preserved: each link becomes its own file.
+func copyTree(src, dst string) (err error) {
+	type dirTimes struct {
+		path string
+		stat *syscall.Stat_t
+	}
+
+	var dirs []dirTimes
+
+	err = filepath.Walk(src, func(path string, finfo os.FileInfo, walkErr error) (err error) {
+		if walkErr != nil {
+			err = walkErr
+			return
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return
+		}
+
+		var (
+			target = filepath.Join(dst, rel)
+			stat   = finfo.Sys().(*syscall.Stat_t)
+			mode   = finfo.Mode()
+		)
+
+		switch {
+		case mode.IsDir():
+			if rel != "." {
+				err = os.Mkdir(target, 0700)
+				if err != nil {
+					return
+				}
+			}
+
+			dirs = append(dirs, dirTimes{target, stat})
+		case mode.IsRegular():
+			err = cloneFile(path, target)
+			if err != nil {
+				return
+			}
+		case mode&os.ModeSymlink != 0:
+			var link string
+
+			link, err = os.Readlink(path)
+			if err != nil {
+				return
+			}
+
+			err = os.Symlink(link, target)
+			if err != nil {
+				return
+			}
+
+			err = os.Lchown(target, int(stat.Uid), int(stat.Gid))
+			return
+		default:
+			err = syscall.Mknod(target, stat.Mode, int(stat.Rdev))
+			if err != nil {
+				err = &os.PathError{Op: "mknod", Path: target, Err: err}
+				return
+			}
+		}
+
+		err = copyAttributes(path, target, stat)
+		if err != nil {
+			return
+		}
+
+		if !mode.IsDir() {
+			err = setTimes(target, stat)
+		}
+
+		return
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't copy tree %s to %s", src, dst)
+		return
+	}
+
+	// directories get their times set only after all of their
+	// entries got created as creating them changes the times.
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		err = setTimes(dirs[idx].path, dirs[idx].stat)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't set times of directory %s", dirs[idx].path)
+			return
+		}
+	}
+
+	return
+}
+
+// cloneFile creates `dst` with the contents of `src`, sharing
+// its extents (reflink) if possible.
+func cloneFile(src, dst string) (err error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := dstFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+		dstFile.Fd(), ficlone, srcFile.Fd())
+	switch errno {
+	case 0:
+		return
+	case syscall.EOPNOTSUPP, syscall.ENOTTY, syscall.EXDEV,
+		syscall.EINVAL, syscall.ENOSYS:
+	default:
+		err = &os.PathError{Op: "ficlone", Path: dst, Err: errno}
+		return
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	return
+}
+
+// copyAttributes copies the ownership, mode and extended
+// attributes of a file (not a symlink) to another.
+func copyAttributes(src, dst string, stat *syscall.Stat_t) (err error) {
+	err = os.Chown(dst, int(stat.Uid), int(stat.Gid))
+	if err != nil {
+		return
+	}
+
+	// chmod(2) goes after chown(2) as the latter clears the
+	// setuid and setgid bits.
+	err = syscall.Chmod(dst, stat.Mode&07777)
+	if err != nil {
+		err = &os.PathError{Op: "chmod", Path: dst, Err: err}
+		return
+	}
+
+	err = copyXattrs(src, dst)
+	return
+}
+
+// copyXattrs copies the extended attributes of a file to
+// another, doing nothing if the filesystem doesn't support
+// them.
+func copyXattrs(src, dst string) (err error) {
+	names, err := listXattrs(src)
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		var value []byte
+
+		value, err = getXattr(src, name)
+		if err != nil {
+			return
+		}
+
+		err = syscall.Setxattr(dst, name, value, 0)
+		if err != nil {
+			err = &os.PathError{Op: "setxattr " + name, Path: dst, Err: err}
+			return
+		}
+	}
+
+	return
+}
+
+// listXattrs retrieves the names of the extended attributes
+// of a file.
+func listXattrs(path string) (names []string, err error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			err = nil
+			return
+		}
+
+		err = &os.PathError{Op: "listxattr", Path: path, Err: err}
+		return
+	}
+
+	if size == 0 {
+		return
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		err = &os.PathError{Op: "listxattr", Path: path, Err: err}
+		return
+	}
+
+	start := 0
+	for idx, b := range buf[:size] {
+		if b == 0 {
+			names = append(names, string(buf[start:idx]))
+			start = idx + 1
+		}
+	}
+
+	return
+}
+
+// getXattr retrieves the value of an extended attribute.
+func getXattr(path, name string) (value []byte, err error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		err = &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		return
+	}
+
+	value = make([]byte, size)
+	if size == 0 {
+		return
+	}
+
+	size, err = syscall.Getxattr(path, name, value)
+	if err != nil {
+		err = &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		return
+	}
+
+	value = value[:size]
+	return
+}
+
+// setTimes sets the access and modification times of a file
+// (not a symlink) to those of a given stat.
+func setTimes(path string, stat *syscall.Stat_t) (err error) {
+	err = syscall.UtimesNano(path, []syscall.Timespec{stat.Atim, stat.Mtim})
+	if err != nil {
+		err = &os.PathError{Op: "utimensat", Path: path, Err: err}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyTree_recreatesTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		src   = filepath.Join(dir, "src")
+		dst   = filepath.Join(dir, "dst")
+		mtime = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+	assert.NoError(t, os.Mkdir(dst, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a", "file"), []byte("content"), 0640))
+	assert.NoError(t, os.Chmod(filepath.Join(src, "a", "b"), 0711))
+	assert.NoError(t, os.Symlink("../a/file", filepath.Join(src, "a", "b", "link")))
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "a", "file"), mtime, mtime))
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "a"), mtime, mtime))
+
+	err = syscall.Setxattr(filepath.Join(src, "a", "file"), "user.xfsvol", []byte("value"), 0)
+	hasXattrs := err == nil
+
+	assert.NoError(t, copyTree(src, dst))
+
+	content, err := ioutil.ReadFile(filepath.Join(dst, "a", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	finfo, err := os.Stat(filepath.Join(dst, "a", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), finfo.Mode().Perm())
+	assert.True(t, mtime.Equal(finfo.ModTime()))
+
+	finfo, err = os.Stat(filepath.Join(dst, "a"))
+	assert.NoError(t, err)
+	assert.True(t, mtime.Equal(finfo.ModTime()))
+
+	finfo, err = os.Stat(filepath.Join(dst, "a", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0711), finfo.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dst, "a", "b", "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "../a/file", link)
+
+	if hasXattrs {
+		value, err := getXattr(filepath.Join(dst, "a", "file"), "user.xfsvol")
+		assert.NoError(t, err)
+		assert.Equal(t, "value", string(value))
+	}
+
+	// clones don't share anything with the source visible to
+	// their users.
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dst, "a", "file"), []byte("changed"), 0640))
+
+	content, err = ioutil.ReadFile(filepath.Join(src, "a", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
+
+func TestCopyTree_failsIfTargetExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		src = filepath.Join(dir, "src")
+		dst = filepath.Join(dir, "dst")
+	)
+
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "file"), []byte("new"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dst, "file"), []byte("old"), 0644))
+
+	assert.Error(t, copyTree(src, dst))
+}
@@ -0,0 +1,252 @@
+package manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeBackend_recordsMetadata(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	before := time.Now()
+
+	_, err := m.Create(manager.Volume{
+		Name:    "abc",
+		Size:    manager.MustFromHumanSize("10MB"),
+		Options: map[string]string{"size": "10MB"},
+		Labels:  map[string]string{"team": "ci"},
+	})
+	assert.NoError(t, err)
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{"size": "10MB"}, vol.Options)
+	assert.Equal(t, map[string]string{"team": "ci"}, vol.Labels)
+	assert.False(t, vol.CreatedAt.Before(before.Truncate(time.Second)))
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+	assert.Equal(t, vol.CreatedAt, vols[0].CreatedAt)
+	assert.Equal(t, vol.Labels, vols[0].Labels)
+
+	// metadata survives the manager being recreated (e.g., on
+	// plugin restarts).
+	other, err := manager.New(manager.Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.NoError(t, err)
+
+	otherVol, found, err := other.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, vol.CreatedAt.Equal(otherVol.CreatedAt))
+	assert.Equal(t, vol.Options, otherVol.Options)
+}
+
+func TestFakeBackend_deleteRemovesMetadata(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := m.Create(manager.Volume{
+		Name:   "abc",
+		Size:   manager.MustFromHumanSize("10MB"),
+		Labels: map[string]string{"team": "ci"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Delete("abc"))
+
+	createVolume(t, m, "abc", "10MB")
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Empty(t, vol.Labels)
+}
+
+func TestFakeBackend_appliesOwnershipAndMode(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(manager.Volume{
+		Name: "abc",
+		Size: manager.MustFromHumanSize("10MB"),
+		Uid:  os.Getuid(),
+		Gid:  os.Getgid(),
+		Mode: 0750,
+	})
+	assert.NoError(t, err)
+
+	finfo, err := os.Stat(absPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), finfo.Mode().Perm())
+
+	vol, _, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), vol.Mode)
+	assert.Equal(t, os.Getuid(), vol.Uid)
+	assert.Equal(t, os.Getgid(), vol.Gid)
+
+	_, err = m.Clone("abc", manager.Volume{
+		Name: "def",
+		Mode: 0700,
+	})
+	assert.NoError(t, err)
+
+	vol, _, err = m.Get("def")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), vol.Mode)
+}
+
+func TestFakeBackend_createIsIdempotent(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	// sizes that aren't a multiple of the backend's granularity
+	// get rounded down when stored, still matching on retries.
+	var vol = manager.Volume{
+		Name:     "abc",
+		Size:     manager.MustFromHumanSize("10MB"),
+		SoftSize: manager.MustFromHumanSize("5MB"),
+		INode:    100,
+		Labels:   map[string]string{"team": "ci"},
+	}
+
+	absPath, err := m.Create(vol)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("content"), 0644))
+
+	created, _, err := m.Get("abc")
+	assert.NoError(t, err)
+
+	retriedPath, err := m.Create(vol)
+	assert.NoError(t, err)
+	assert.Equal(t, absPath, retriedPath)
+
+	retried, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, created.ProjectId, retried.ProjectId)
+	assert.Equal(t, created.CreatedAt, retried.CreatedAt)
+
+	_, err = os.Stat(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+
+	quotas, err := backend.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 1)
+}
+
+func TestFakeBackend_createConflictsWithDifferentSpecification(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	var vol = manager.Volume{
+		Name:   "abc",
+		Size:   manager.MustFromHumanSize("10MB"),
+		Labels: map[string]string{"team": "ci"},
+	}
+
+	_, err := m.Create(vol)
+	assert.NoError(t, err)
+
+	var testCases = []func(vol *manager.Volume){
+		func(vol *manager.Volume) { vol.Size = manager.MustFromHumanSize("20MB") },
+		func(vol *manager.Volume) { vol.SoftSize = manager.MustFromHumanSize("5MB") },
+		func(vol *manager.Volume) { vol.INode = 100 },
+		func(vol *manager.Volume) { vol.Uid, vol.Gid = 1000, 1000 },
+		func(vol *manager.Volume) { vol.Mode = 0700 },
+		func(vol *manager.Volume) { vol.Labels = nil },
+		func(vol *manager.Volume) { vol.Labels = map[string]string{"team": "qa"} },
+	}
+
+	for idx, change := range testCases {
+		var other = vol
+		change(&other)
+
+		_, err = m.Create(other)
+		assert.Error(t, err, "case %d", idx)
+		assert.Equal(t, manager.ErrConflict, errors.Cause(err), "case %d", idx)
+
+		_, err = m.Adopt(other)
+		assert.Equal(t, manager.ErrConflict, errors.Cause(err), "case %d", idx)
+	}
+
+	current, _, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, manager.HumanSize(vol.Size), manager.HumanSize(current.Size))
+	assert.Equal(t, uint64(0), current.INode)
+	assert.Equal(t, vol.Labels, current.Labels)
+}
+
+func TestFakeBackend_createRefusesDirectoriesThatAreNotVolumes(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	var absPath = path.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(absPath, 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("content"), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "def"), []byte("content"), 0644))
+
+	_, err := m.Create(manager.Volume{
+		Name: "abc",
+		Size: manager.MustFromHumanSize("10MB"),
+	})
+	assert.Error(t, err)
+	assert.Equal(t, manager.ErrNotAVolume, errors.Cause(err))
+
+	_, err = os.Stat(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+
+	_, err = m.Adopt(manager.Volume{
+		Name: "def",
+		Size: manager.MustFromHumanSize("10MB"),
+	})
+	assert.Equal(t, manager.ErrNotAVolume, errors.Cause(err))
+
+	assertNoQuotas(t, backend)
+}
+
+func TestFakeBackend_adoptTurnsDirectoriesIntoVolumes(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	var absPath = path.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(absPath, 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("content"), 0644))
+
+	var vol = manager.Volume{
+		Name: "abc",
+		Size: manager.MustFromHumanSize("10MB"),
+	}
+
+	adoptedPath, err := m.Adopt(vol)
+	assert.NoError(t, err)
+	assert.Equal(t, absPath, adoptedPath)
+
+	adopted, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, manager.HumanSize(vol.Size), manager.HumanSize(adopted.Size))
+
+	content, err := ioutil.ReadFile(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+
+	// once adopted, it's a volume like any other
+	_, err = m.Create(vol)
+	assert.NoError(t, err)
+
+	_, err = m.Adopt(vol)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// lockFileName is the name of the file under the root
+	// that processes managing the same root (e.g., the plugin
+	// and `xfsvolctl`) lock to coordinate with each other.
+	lockFileName = "__xfsvol.lock"
+
+	// DefaultLockTimeout is how long operations wait for
+	// locks when no timeout is configured.
+	DefaultLockTimeout = 30 * time.Second
+
+	// lockPollInterval is the interval between attempts
+	// of acquiring a busy lock.
+	lockPollInterval = 50 * time.Millisecond
+)
+
+// fileLock is an advisory lock (flock) on a file that is
+// shared by every process that manages a given root.
+//
+// Exclusive holders write their pid to the file so that
+// processes waiting for the lock can tell who holds it.
+type fileLock struct {
+	path    string
+	timeout time.Duration
+}
+
+// newFileLock creates a lock backed by a given file path,
+// creating it if it doesn't exist.
+func newFileLock(path string, timeout time.Duration) (l *fileLock, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create lock file %s", path)
+		return
+	}
+	file.Close()
+
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+
+	l = &fileLock{
+		path:    path,
+		timeout: timeout,
+	}
+	return
+}
+
+// Lock acquires the lock (exclusive for writers, shared for
+// readers), waiting at most for the configured timeout.
+//
+// A new file description is opened for each acquisition such
+// that goroutines of the same process also exclude each other.
+//
+// The returned function must be called to release the lock.
+func (l *fileLock) Lock(exclusive bool) (unlock func(), err error) {
+	var (
+		how      = syscall.LOCK_SH
+		deadline = time.Now().Add(l.timeout)
+	)
+
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't open lock file %s", l.path)
+		return
+	}
+
+	for {
+		err = syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			file.Close()
+			err = errors.Wrapf(err,
+				"couldn't lock file %s", l.path)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			file.Close()
+			err = errors.Errorf(
+				"timed out after %s waiting for %s lock on %s - %s",
+				l.timeout, lockKind(exclusive), l.path, l.describeHolder())
+			return
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+
+	if exclusive {
+		file.Truncate(0)
+		file.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+
+	unlock = func() {
+		if exclusive {
+			file.Truncate(0)
+		}
+
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+	return
+}
+
+// describeHolder builds a human readable description of
+// who's holding the lock.
+func (l *fileLock) describeHolder() string {
+	content, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return "holder unknown"
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return "held by readers (shared lock)"
+	}
+
+	return fmt.Sprintf("held by pid %d", pid)
+}
+
+func lockKind(exclusive bool) string {
+	if exclusive {
+		return "exclusive"
+	}
+
+	return "shared"
+}
@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileLock(t *testing.T, timeout time.Duration) (l *fileLock, cleanup func()) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+
+	l, err = newFileLock(filepath.Join(dir, lockFileName), timeout)
+	assert.NoError(t, err)
+
+	cleanup = func() {
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestFileLock_sharedLocksCoexist(t *testing.T) {
+	l, cleanup := newTestFileLock(t, 100*time.Millisecond)
+	defer cleanup()
+
+	unlock1, err := l.Lock(false)
+	assert.NoError(t, err)
+	defer unlock1()
+
+	unlock2, err := l.Lock(false)
+	assert.NoError(t, err)
+	defer unlock2()
+}
+
+func TestFileLock_exclusiveTimesOutNamingHolder(t *testing.T) {
+	l, cleanup := newTestFileLock(t, 100*time.Millisecond)
+	defer cleanup()
+
+	unlock, err := l.Lock(true)
+	assert.NoError(t, err)
+
+	_, err = l.Lock(true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("held by pid %d", os.Getpid()))
+
+	_, err = l.Lock(false)
+	assert.Error(t, err)
+
+	unlock()
+
+	unlock, err = l.Lock(false)
+	assert.NoError(t, err)
+
+	_, err = l.Lock(true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "shared lock")
+
+	unlock()
+}
+
+func TestFileLock_waitsForRelease(t *testing.T) {
+	l, cleanup := newTestFileLock(t, 5*time.Second)
+	defer cleanup()
+
+	unlockFirst, err := l.Lock(true)
+	assert.NoError(t, err)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlockFirst()
+	}()
+
+	unlockSecond, err := l.Lock(true)
+	assert.NoError(t, err)
+	unlockSecond()
+}
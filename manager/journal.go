@@ -0,0 +1,369 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+)
+
+// journalDirName is the name of the directory (under the
+// metadata directory) that holds the intents of the operations
+// that are in flight.
+const journalDirName = "journal"
+
+// operation names a multi-step operation that gets recorded in
+// the journal before any of its steps take place.
+type operation string
+
+const (
+	// opCreate is the creation of a volume in a directory that
+	// didn't exist (including clones) - rolled back on recovery.
+	opCreate operation = "create"
+
+	// opAdopt is the creation of a volume in a directory that
+	// already existed - replayed on recovery, as rolling it back
+	// can't be done without touching the directory's contents.
+	opAdopt operation = "adopt"
+
+	// opDelete is the deletion of a volume - replayed on recovery
+	// as its data might be partially gone already.
+	opDelete operation = "delete"
+
+	// opResize is the change of the limits of a volume - replayed
+	// on recovery.
+	opResize operation = "resize"
+
+	// opRestore is the replacement of the contents of a volume by
+	// those of a snapshot - replayed on recovery, as the volume
+	// might be partially cleared already.
+	opRestore operation = "restore"
+)
+
+// intent is the record of an operation that is in flight.
+type intent struct {
+	Op operation `json:"op"`
+
+	// Volume is the specification the operation targets: the
+	// limits, ownership and metadata of the volume to create
+	// or the limits to resize it to.
+	Volume Volume `json:"volume"`
+
+	// Snapshot is the name of the snapshot to restore (for
+	// restores only).
+	Snapshot string `json:"snapshot,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+}
+
+// journal is a write-ahead log of the operations that mutate
+// volumes in more than one step (e.g., creating the directory,
+// assigning it a project id and setting the project's limits).
+//
+// An intent is recorded (`Begin`) before the first step of an
+// operation and removed (`Finish`) after the last one, such that
+// intents left behind describe operations that got interrupted
+// (e.g., by a crash) and must be replayed or rolled back (see
+// `Manager.recover`).
+//
+// Intents are stored as one JSON file per volume (`<name>.json`),
+// replaced atomically. As mutating operations hold the lock of
+// the volume, there's at most one intent per volume.
+type journal struct {
+	dir string
+}
+
+// newJournal creates a journal under a given directory,
+// creating the directory if it doesn't exist.
+func newJournal(dir string) (j *journal, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create journal directory %s", dir)
+		return
+	}
+
+	j = &journal{
+		dir: dir,
+	}
+	return
+}
+
+func (j *journal) path(name string) string {
+	return filepath.Join(j.dir, name+".json")
+}
+
+// Begin records the intent of performing an operation on a
+// volume.
+func (j *journal) Begin(op operation, vol Volume) (err error) {
+	err = j.record(intent{
+		Op:     op,
+		Volume: vol,
+	})
+	return
+}
+
+// BeginRestore records the intent of restoring a snapshot into
+// a volume.
+func (j *journal) BeginRestore(volume, snapshot string) (err error) {
+	err = j.record(intent{
+		Op:       opRestore,
+		Volume:   Volume{Name: volume},
+		Snapshot: snapshot,
+	})
+	return
+}
+
+func (j *journal) record(in intent) (err error) {
+	in.StartedAt = time.Now().UTC()
+
+	content, err := json.Marshal(&in)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't encode %s intent of volume %s", in.Op, in.Volume.Name)
+		return
+	}
+
+	err = writeFileAtomically(j.path(in.Volume.Name), content)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't record %s intent of volume %s", in.Op, in.Volume.Name)
+		return
+	}
+
+	return
+}
+
+// Finish removes the intent recorded for a volume (if any).
+func (j *journal) Finish(name string) (err error) {
+	var path = j.path(name)
+
+	err = os.Remove(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"couldn't remove journal entry %s", path)
+		return
+	}
+
+	return
+}
+
+// Load retrieves the intent recorded for a volume (if any).
+func (j *journal) Load(name string) (in intent, found bool, err error) {
+	var path = j.path(name)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"couldn't read journal entry %s", path)
+		return
+	}
+
+	err = json.Unmarshal(content, &in)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't parse journal entry %s", path)
+		return
+	}
+
+	found = true
+	return
+}
+
+// Pending retrieves the intents that have been recorded but not
+// finished, in the order they've been recorded.
+func (j *journal) Pending() (intents []intent, err error) {
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't list journal directory %s", j.dir)
+		return
+	}
+
+	for _, file := range files {
+		// temporary files of interrupted writes start with a dot
+		// and can be ignored as the intent they'd replace (if
+		// any) is still in place.
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") ||
+			!strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		var (
+			in    intent
+			found bool
+		)
+
+		in, found, err = j.Load(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return
+		}
+
+		if found {
+			intents = append(intents, in)
+		}
+	}
+
+	sort.SliceStable(intents, func(i, k int) bool {
+		return intents[i].StartedAt.Before(intents[k].StartedAt)
+	})
+
+	return
+}
+
+// recover brings the volumes that had operations interrupted
+// back to a consistent state, replaying or rolling back each of
+// the intents left in the journal.
+//
+// Creations are rolled back, removing the directory together
+// with whatever project id, quota and metadata it got, while
+// adoptions, deletions, resizes and restores are carried on.
+//
+// Intents of volumes whose lock is held by another process are
+// skipped: their operations are still in flight (locks don't
+// outlive the processes holding them).
+//
+// Callers are expected to not serve requests until it finishes.
+func (m *Manager) recover() (err error) {
+	intents, err := m.journal.Pending()
+	if err != nil {
+		return
+	}
+
+	for _, in := range intents {
+		var name = in.Volume.Name
+
+		if !isValidName(name) {
+			err = errors.Wrapf(ErrInvalidName,
+				"journal has %s intent for volume '%s'", in.Op, name)
+			return
+		}
+
+		err = m.recoverIntent(name)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// recoverIntent replays or rolls back the intent recorded for a
+// volume (see `recover`) holding the volume lock.
+func (m *Manager) recoverIntent(name string) (err error) {
+	unlock, err := m.locks.TryLock(name, true)
+	if err != nil {
+		err = nil
+		return
+	}
+	defer unlock()
+
+	// the operation might have finished between listing the
+	// intents and getting hold of the lock.
+	in, found, err := m.journal.Load(name)
+	if err != nil || !found {
+		return
+	}
+
+	switch in.Op {
+	case opCreate, opDelete:
+		err = m.remove(name)
+	case opAdopt:
+		err = m.redoAdopt(in.Volume)
+	case opResize:
+		err = m.redoResize(in.Volume)
+	case opRestore:
+		err = m.redoRestore(in.Volume.Name, in.Snapshot)
+	default:
+		err = errors.Errorf("unknown operation '%s'", in.Op)
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't recover %s of volume %s started at %s",
+			in.Op, name, in.StartedAt.Format(time.RFC3339))
+		return
+	}
+
+	err = m.journal.Finish(name)
+	return
+}
+
+// redoAdopt completes the adoption of a directory (see `adopt`)
+// unless the directory is gone.
+func (m *Manager) redoAdopt(vol Volume) (err error) {
+	var absPath = filepath.Join(m.root, vol.Name)
+
+	_, err = os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = m.metadata.Delete(vol.Name)
+		}
+
+		return
+	}
+
+	err = setOwnership(absPath, vol)
+	if err != nil {
+		return
+	}
+
+	err = m.create(vol, volumeQuota(vol))
+	return
+}
+
+// redoResize applies the limits that a volume was being resized
+// to (see `Resize`) unless the volume is gone.
+func (m *Manager) redoResize(vol Volume) (err error) {
+	var absPath = filepath.Join(m.root, vol.Name)
+
+	_, found := m.quotaCtl.GetProjectId(absPath)
+	if !found {
+		return
+	}
+
+	err = m.quotaCtl.SetQuota(absPath, volumeQuota(vol))
+	if err != nil && errors.Is(err, xfs.ErrNoProjectId) {
+		err = nil
+	}
+
+	return
+}
+
+// redoRestore restores a snapshot into a volume (see `restore`)
+// unless either of them is gone.
+func (m *Manager) redoRestore(volume, name string) (err error) {
+	if !isValidName(name) {
+		err = errors.Wrapf(ErrInvalidName,
+			"snapshot '%s'", name)
+		return
+	}
+
+	vol, found, err := m.get(volume)
+	if err != nil || !found {
+		return
+	}
+
+	snapshot, found, err := m.getSnapshot(volume, name)
+	if err != nil || !found {
+		return
+	}
+
+	err = m.restore(vol, snapshot)
+	return
+}
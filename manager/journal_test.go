@@ -0,0 +1,297 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/cirocosta/xfsvol/xfs/xfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManager creates a manager backed by an in-memory quota
+// backend under a temporary directory.
+func newTestManager(t *testing.T) (m *Manager, backend *xfstest.Backend, dir string) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+
+	backend = xfstest.NewBackend()
+	m, err = New(Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.NoError(t, err)
+	return
+}
+
+// restart simulates the process managing the root being started
+// again (e.g., after a crash), recovering interrupted operations.
+func restart(t *testing.T, backend *xfstest.Backend, dir string) (m *Manager) {
+	m, err := New(Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.NoError(t, err)
+
+	intents, err := m.journal.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, intents, 0)
+	return
+}
+
+func TestJournal_pendingListsUnfinishedIntents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := newJournal(filepath.Join(dir, journalDirName))
+	assert.NoError(t, err)
+
+	assert.NoError(t, j.Begin(opCreate, Volume{Name: "abc", Size: 10}))
+	assert.NoError(t, j.Begin(opDelete, Volume{Name: "def"}))
+	assert.NoError(t, j.Begin(opResize, Volume{Name: "ghi", Size: 20}))
+	assert.NoError(t, j.Finish("def"))
+	assert.NoError(t, j.Finish("inexistent"))
+
+	// leftover of an interrupted write
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(j.dir, ".abc.json.123"), []byte("{"), 0600))
+
+	intents, err := j.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, intents, 2)
+
+	assert.Equal(t, opCreate, intents[0].Op)
+	assert.Equal(t, "abc", intents[0].Volume.Name)
+	assert.Equal(t, uint64(10), intents[0].Volume.Size)
+	assert.Equal(t, opResize, intents[1].Op)
+	assert.Equal(t, "ghi", intents[1].Volume.Name)
+}
+
+func TestJournal_operationsLeaveNoIntents(t *testing.T) {
+	m, _, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	var vol = Volume{
+		Name: "abc",
+		Size: MustFromHumanSize("10MB"),
+	}
+
+	_, err := m.Create(vol)
+	assert.NoError(t, err)
+
+	_, err = m.Clone("abc", Volume{Name: "def"})
+	assert.NoError(t, err)
+
+	_, err = m.Resize("abc", xfs.Quota{Size: MustFromHumanSize("20MB")}, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Delete("def"))
+
+	intents, err := m.journal.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, intents, 0)
+}
+
+func TestRecover_rollsBackInterruptedCreate(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	var (
+		vol     = Volume{Name: "abc", Size: MustFromHumanSize("10MB")}
+		absPath = filepath.Join(dir, "abc")
+	)
+
+	// crashed after assigning a project id but before setting
+	// its limits.
+	assert.NoError(t, m.journal.Begin(opCreate, vol))
+	assert.NoError(t, os.Mkdir(absPath, 0755))
+	_, err := backend.AssignProjectId(absPath)
+	assert.NoError(t, err)
+
+	m = restart(t, backend, dir)
+
+	_, err = os.Stat(absPath)
+	assert.True(t, os.IsNotExist(err))
+
+	_, found := backend.GetProjectId(absPath)
+	assert.False(t, found)
+
+	// the name can be used again
+	_, err = m.Create(vol)
+	assert.NoError(t, err)
+}
+
+func TestRecover_rollsBackInterruptedClone(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	var (
+		vol     = Volume{Name: "abc", Size: MustFromHumanSize("10MB")}
+		absPath = filepath.Join(dir, "abc")
+	)
+
+	// crashed while copying contents into a volume that already
+	// got its limits and metadata.
+	assert.NoError(t, m.journal.Begin(opCreate, vol))
+	assert.NoError(t, os.Mkdir(absPath, 0755))
+	assert.NoError(t, m.create(vol, volumeQuota(vol)))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "partial"), []byte("content"), 0644))
+
+	m = restart(t, backend, dir)
+
+	_, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, found, err = m.metadata.Load("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	quotas, err := backend.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 0)
+}
+
+func TestRecover_completesInterruptedAdopt(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	var (
+		vol     = Volume{Name: "abc", Size: MustFromHumanSize("10MB")}
+		absPath = filepath.Join(dir, "abc")
+	)
+
+	assert.NoError(t, os.Mkdir(absPath, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "file"), []byte("content"), 0644))
+
+	// crashed after assigning a project id but before setting
+	// its limits.
+	assert.NoError(t, m.journal.Begin(opAdopt, vol))
+	_, err := backend.AssignProjectId(absPath)
+	assert.NoError(t, err)
+
+	m = restart(t, backend, dir)
+
+	adopted, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, HumanSize(vol.Size), HumanSize(adopted.Size))
+	assert.False(t, adopted.CreatedAt.IsZero())
+
+	_, err = os.Stat(filepath.Join(absPath, "file"))
+	assert.NoError(t, err)
+}
+
+func TestRecover_completesInterruptedDelete(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(Volume{
+		Name: "abc",
+		Size: MustFromHumanSize("10MB"),
+	})
+	assert.NoError(t, err)
+
+	_, err = m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+
+	// crashed after removing part of the contents.
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "file"), []byte("content"), 0644))
+	assert.NoError(t, m.journal.Begin(opDelete, Volume{Name: "abc"}))
+	assert.NoError(t, os.Remove(filepath.Join(absPath, "file")))
+
+	m = restart(t, backend, dir)
+
+	_, err = os.Stat(absPath)
+	assert.True(t, os.IsNotExist(err))
+
+	_, found, err := m.metadata.Load("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	snapshots, err := m.ListSnapshots("abc")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 0)
+
+	quotas, err := backend.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 0)
+}
+
+func TestRecover_completesInterruptedResize(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := m.Create(Volume{
+		Name: "abc",
+		Size: MustFromHumanSize("10MB"),
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.journal.Begin(opResize, Volume{
+		Name:  "abc",
+		Size:  MustFromHumanSize("20MB"),
+		INode: 100,
+	}))
+
+	// intents of volumes that are gone are just dropped
+	assert.NoError(t, m.journal.Begin(opResize, Volume{
+		Name: "inexistent",
+		Size: MustFromHumanSize("20MB"),
+	}))
+
+	m = restart(t, backend, dir)
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "20MB", HumanSize(vol.Size))
+	assert.Equal(t, uint64(100), vol.INode)
+}
+
+func TestRecover_completesInterruptedRestore(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(Volume{
+		Name: "abc",
+		Size: MustFromHumanSize("10MB"),
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "file"), []byte("first"), 0644))
+
+	_, err = m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "file"), []byte("second"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(absPath, "other"), []byte("second"), 0644))
+
+	// crashed after clearing part of the contents.
+	assert.NoError(t, m.journal.BeginRestore("abc", "first"))
+	assert.NoError(t, os.Remove(filepath.Join(absPath, "file")))
+
+	m = restart(t, backend, dir)
+
+	content, err := ioutil.ReadFile(filepath.Join(absPath, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+
+	_, err = os.Stat(filepath.Join(absPath, "other"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRecover_failsOnMalformedIntents(t *testing.T) {
+	m, backend, dir := newTestManager(t)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(m.journal.path("abc"), []byte(`{"op":"create","volume":{"Name":"../abc"}}`), 0600))
+
+	_, err := New(Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// locksDirName is the name of the directory (under the
+	// metadata directory) that holds the lock files of the
+	// volumes.
+	locksDirName = "locks"
+
+	// metadataLocksDirName is the name of the directory (under
+	// the locks directory) that holds the lock files of the
+	// metadata of the volumes.
+	metadataLocksDirName = "metadata"
+)
+
+// volumeLocks provides a lock per volume name such that
+// operations targetting the same volume can be serialized
+// without blocking operations on other volumes.
+//
+// Within the process, goroutines are serialized by an in-memory
+// read-write lock per name. Other processes managing the same
+// root are coordinated through an advisory lock (see `fileLock`)
+// on a file per name (`<dir>/<name>.lock`).
+//
+// In-memory locks are created on demand and dropped once nobody
+// holds or waits for them, while lock files are left in place.
+type volumeLocks struct {
+	mu      sync.Mutex
+	locks   map[string]*volumeLock
+	dir     string
+	timeout time.Duration
+}
+
+// volumeLock is a lock associated with a single volume
+// name together with the number of goroutines that hold
+// or wait for it.
+type volumeLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// newVolumeLocks creates the locks of the volumes whose lock
+// files live under a given directory, creating the directory if
+// it doesn't exist.
+//
+// `timeout` is the maximum amount of time to wait for other
+// processes to release a lock (see `fileLock`).
+func newVolumeLocks(dir string, timeout time.Duration) (l *volumeLocks, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create locks directory %s", dir)
+		return
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+
+	l = &volumeLocks{
+		locks:   make(map[string]*volumeLock),
+		dir:     dir,
+		timeout: timeout,
+	}
+	return
+}
+
+// Lock acquires the lock of a given volume name (exclusive for
+// writers, shared for readers), blocking until it's available
+// within the process and then waiting at most for the configured
+// timeout for other processes to release it.
+//
+// The returned function must be called to release it.
+func (l *volumeLocks) Lock(name string, exclusive bool) (unlock func(), err error) {
+	unlock, err = l.lock(name, exclusive, l.timeout)
+	return
+}
+
+// TryLock acquires the lock of a given volume name (see `Lock`)
+// without waiting for other processes to release it.
+func (l *volumeLocks) TryLock(name string, exclusive bool) (unlock func(), err error) {
+	unlock, err = l.lock(name, exclusive, 0)
+	return
+}
+
+func (l *volumeLocks) lock(name string, exclusive bool, timeout time.Duration) (unlock func(), err error) {
+	l.mu.Lock()
+	lock, ok := l.locks[name]
+	if !ok {
+		lock = new(volumeLock)
+		l.locks[name] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	if exclusive {
+		lock.Lock()
+	} else {
+		lock.RLock()
+	}
+
+	release := func() {
+		if exclusive {
+			lock.Unlock()
+		} else {
+			lock.RUnlock()
+		}
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, name)
+		}
+		l.mu.Unlock()
+	}
+
+	var file = &fileLock{
+		path:    filepath.Join(l.dir, name+".lock"),
+		timeout: timeout,
+	}
+
+	unlockFile, err := file.Lock(exclusive)
+	if err != nil {
+		release()
+		return
+	}
+
+	unlock = func() {
+		unlockFile()
+		release()
+	}
+	return
+}
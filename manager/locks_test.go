@@ -0,0 +1,277 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/cirocosta/xfsvol/xfs/xfstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVolumeLocks(t *testing.T, timeout time.Duration) (locks *volumeLocks, cleanup func()) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+
+	locks, err = newVolumeLocks(dir, timeout)
+	assert.NoError(t, err)
+
+	cleanup = func() {
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestVolumeLocks_serializesSameName(t *testing.T) {
+	locks, cleanup := newTestVolumeLocks(t, 5*time.Second)
+	defer cleanup()
+
+	var (
+		wg      sync.WaitGroup
+		holders int
+		maxSeen int
+		mu      sync.Mutex
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := locks.Lock("abc", true)
+			assert.NoError(t, err)
+			defer unlock()
+
+			mu.Lock()
+			holders++
+			if holders > maxSeen {
+				maxSeen = holders
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			holders--
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, maxSeen)
+	assert.Len(t, locks.locks, 0)
+}
+
+func TestVolumeLocks_doesntBlockDifferentNames(t *testing.T) {
+	locks, cleanup := newTestVolumeLocks(t, 5*time.Second)
+	defer cleanup()
+
+	var done = make(chan struct{})
+
+	unlock, err := locks.Lock("abc", true)
+	assert.NoError(t, err)
+	defer unlock()
+
+	go func() {
+		unlock, err := locks.Lock("def", true)
+		assert.NoError(t, err)
+		unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock of a different volume blocked")
+	}
+}
+
+func TestVolumeLocks_sharedLocksCoexist(t *testing.T) {
+	locks, cleanup := newTestVolumeLocks(t, 100*time.Millisecond)
+	defer cleanup()
+
+	unlock1, err := locks.Lock("abc", false)
+	assert.NoError(t, err)
+	defer unlock1()
+
+	unlock2, err := locks.Lock("abc", false)
+	assert.NoError(t, err)
+	defer unlock2()
+}
+
+func TestVolumeLocks_excludeOtherProcesses(t *testing.T) {
+	locks, cleanup := newTestVolumeLocks(t, 100*time.Millisecond)
+	defer cleanup()
+
+	// a second instance over the same directory stands for
+	// another process managing the same root.
+	other, err := newVolumeLocks(locks.dir, 100*time.Millisecond)
+	assert.NoError(t, err)
+
+	unlock, err := locks.Lock("abc", true)
+	assert.NoError(t, err)
+
+	_, err = other.Lock("abc", false)
+	assert.Error(t, err)
+
+	_, err = other.TryLock("abc", true)
+	assert.Error(t, err)
+
+	unlockOther, err := other.Lock("def", true)
+	assert.NoError(t, err)
+	unlockOther()
+
+	unlock()
+
+	unlockOther, err = other.TryLock("abc", true)
+	assert.NoError(t, err)
+	unlockOther()
+}
+
+func TestManager_mutatesDifferentVolumesConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := New(Config{
+		Root:        dir,
+		Backend:     xfstest.NewBackend(),
+		LockTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Create(Volume{Name: "abc", Size: MustFromHumanSize("10MB")})
+	assert.NoError(t, err)
+
+	// an operation on `abc` that is in flight doesn't keep
+	// others from mutating `def`.
+	unlock, err := m.lockVolume("abc", true)
+	assert.NoError(t, err)
+	defer unlock()
+
+	var done = make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, err := m.Create(Volume{Name: "def", Size: MustFromHumanSize("10MB")})
+		assert.NoError(t, err)
+
+		_, err = m.Resize("def", xfs.Quota{Size: MustFromHumanSize("20MB")}, false)
+		assert.NoError(t, err)
+
+		_, err = m.Mount("def", "container")
+		assert.NoError(t, err)
+
+		assert.NoError(t, m.ForceDelete("def"))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("mutations of a different volume blocked")
+	}
+
+	// while mutations of the same volume (e.g., by another
+	// process) wait for it.
+	other, err := New(Config{
+		Root:        dir,
+		Backend:     m.quotaCtl,
+		LockTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	_, err = other.Resize("abc", xfs.Quota{Size: MustFromHumanSize("20MB")}, false)
+	assert.Error(t, err)
+}
+
+func TestManager_clonesWhileSourceIsRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := New(Config{
+		Root:        dir,
+		Backend:     xfstest.NewBackend(),
+		LockTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Create(Volume{Name: "abc", Size: MustFromHumanSize("10MB")})
+	assert.NoError(t, err)
+
+	// e.g., another process retrieving the source
+	other, err := New(Config{
+		Root:        dir,
+		Backend:     m.quotaCtl,
+		LockTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	unlock, err := other.lockVolume("abc", false)
+	assert.NoError(t, err)
+	defer unlock()
+
+	_, err = m.Clone("abc", Volume{Name: "def"})
+	assert.NoError(t, err)
+
+	// while the destination is held exclusively
+	unlockClone, err := other.lockVolume("ghi", false)
+	assert.NoError(t, err)
+
+	_, err = m.Clone("abc", Volume{Name: "ghi"})
+	assert.Error(t, err)
+
+	unlockClone()
+}
+
+func TestManager_mountsWhileVolumeIsRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := New(Config{
+		Root:        dir,
+		Backend:     xfstest.NewBackend(),
+		LockTimeout: 5 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Create(Volume{Name: "abc", Size: MustFromHumanSize("10MB")})
+	assert.NoError(t, err)
+
+	// e.g., another process cloning the volume
+	other, err := New(Config{
+		Root:        dir,
+		Backend:     m.quotaCtl,
+		LockTimeout: 5 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	unlock, err := other.lockVolume("abc", false)
+	assert.NoError(t, err)
+	defer unlock()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			_, err := m.Mount("abc", id)
+			assert.NoError(t, err)
+		}(fmt.Sprintf("container-%d", i))
+	}
+
+	wg.Wait()
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Len(t, vol.Mounts, 10)
+}
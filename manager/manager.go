@@ -1,10 +1,16 @@
 package manager
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cirocosta/xfsvol/xfs"
 	"github.com/pkg/errors"
@@ -20,14 +26,54 @@ var (
 	ErrEmptyQuota  = errors.Errorf("Invalid quota - Can't be 0")
 	ErrEmptyINode  = errors.Errorf("Invalid inode - Can't be 0")
 	ErrNotFound    = errors.Errorf("Volume not found")
+	ErrExists      = errors.Errorf("Volume already exists")
+	ErrInUse       = errors.Errorf("Volume in use - Mounted by running containers")
+	ErrConflict    = errors.Errorf("Volume already exists with a different specification")
+	ErrNotAVolume  = errors.Errorf("Path exists but is not a volume - Adopt it to turn it into one")
+
+	ErrSoftSizeAboveHard  = errors.Errorf("Invalid soft size - Can't be greater than size")
+	ErrSoftINodeAboveHard = errors.Errorf("Invalid soft inode - Can't be greater than inode")
+
+	ErrSizeBelowUsage  = errors.Errorf("Invalid size - Can't be lower than the space already used (force to shrink anyway)")
+	ErrINodeBelowUsage = errors.Errorf("Invalid inode - Can't be lower than the inodes already used (force to shrink anyway)")
 )
 
 // Manager is the entity responsible for managing
 // volumes under a given base path. It takes the
 // responsability of 'CRUD'ing these volumes.
+//
+// It's safe for concurrent use: operations that target
+// the same volume are serialized while operations on
+// different volumes run in parallel.
+//
+// Other processes managing the same root (e.g., the plugin
+// and `xfsvolctl`) are coordinated through advisory locks on
+// files under the root: one per volume, held like the volume
+// locks, and one for the whole root, held only while project
+// ids get assigned or released (see `lockRoot`).
 type Manager struct {
-	quotaCtl *xfs.Control
+	quotaCtl QuotaBackend
 	root     string
+	locks    *volumeLocks
+	rootLock *fileLock
+	metadata *metadataStore
+
+	// rootMu serializes the holders of the root lock within
+	// the process.
+	rootMu sync.Mutex
+
+	// metadataLocks serialize the updates of the metadata of a
+	// volume that are made while holding its lock shared (see
+	// `Mount`).
+	metadataLocks *volumeLocks
+
+	// snapshots holds the metadata of the snapshots of the
+	// volumes (see `Snapshot`).
+	snapshots *metadataStore
+
+	// journal records the operations that are in flight such
+	// that interrupted ones can be recovered (see `recover`).
+	journal *journal
 }
 
 // Config represents the configuration to
@@ -36,22 +82,115 @@ type Manager struct {
 // controls project quotas bellow it.
 type Config struct {
 	Root string
+
+	// StartingProjectId and MaxProjectId specify the band
+	// of project ids that the manager can make use of when
+	// creating volumes (see `xfs.ControlConfig`).
+	StartingProjectId *uint32
+	MaxProjectId      *uint32
+
+	// LockTimeout is the maximum amount of time to wait
+	// for other processes to release the lock of a volume
+	// or the root lock.
+	//
+	// Defaults to `DefaultLockTimeout`.
+	LockTimeout time.Duration
+
+	// BlockDeviceMode specifies how the block device that
+	// quota commands are issued against gets resolved (see
+	// `xfs.BlockDeviceMode`).
+	//
+	// Defaults to `xfs.BlockDeviceModeAuto`.
+	BlockDeviceMode xfs.BlockDeviceMode
+
+	// PreflightMode determines whether the manager refuses to
+	// be created when the filesystem holding `Root` is not fit
+	// for enforcing project quotas (see `xfs.Preflight`).
+	//
+	// Defaults to `xfs.PreflightModeFail`.
+	PreflightMode xfs.PreflightMode
+
+	// ProjectsFile and ProjIdFile are the paths of the project
+	// files (`/etc/projects` and `/etc/projid` formats) to keep
+	// in sync with the volumes such that xfs_quota(8) reports
+	// show volume names (see `xfs.ControlConfig`).
+	//
+	// They're recorded under `Root` such that managers created
+	// without them (e.g., by `xfsvolctl`) keep the same files in
+	// sync. Empty paths (the default) disable the files unless
+	// they've been recorded.
+	ProjectsFile string
+	ProjIdFile   string
+
+	// Backend is the quota backend to apply volumes' limits
+	// with.
+	//
+	// Defaults to an `xfs.Control` under `Root`.
+	Backend QuotaBackend
 }
 
 // Volume represents a volume under a given
 // root path that has a project quota associated
 // with it.
+//
+// `Size` and `INode` are the hard limits while
+// `SoftSize` and `SoftINode` are the soft limits,
+// i.e., thresholds that can be temporarily exceeded
+// but that mark the volume as being over quota.
+//
+// `CreatedAt`, `Options` and `Labels` come from the metadata
+// recorded when the volume got created - volumes created by
+// versions that didn't record it have them empty.
 type Volume struct {
-	Name  string
-	Path  string
-	Size  uint64
-	INode uint64
+	Name      string
+	Path      string
+	ProjectId uint32
+	Size      uint64
+	SoftSize  uint64
+	INode     uint64
+	SoftINode uint64
+
+	// Uid, Gid and Mode are the owner and the permission bits
+	// of the root directory of the volume.
+	//
+	// On creation, zero values leave the defaults (owned by the
+	// user of the manager process with mode 0755 - or, for
+	// clones, as in the source volume).
+	Uid  int
+	Gid  int
+	Mode os.FileMode
+
+	// UsedSize and UsedINode are the disk space (in bytes)
+	// and the number of inodes that the volume uses.
+	UsedSize  uint64
+	UsedINode uint64
+
+	// PercentUsed is how much of its quota the volume uses:
+	// the highest of the percentages of `Size` and `INode`
+	// (when limited) that are used - 100 or more means full.
+	PercentUsed float64
+
+	// CreatedAt is the time the volume got created at
+	// (set by `Create` when not specified).
+	CreatedAt time.Time
+
+	// Options are the raw options that the volume got
+	// created with (e.g., `docker volume create --opt`).
+	Options map[string]string
+
+	// Labels are arbitrary key-value pairs attached to
+	// the volume.
+	Labels map[string]string
+
+	// Mounts are the ids of the callers (e.g., containers)
+	// that have the volume mounted (see `Manager.Mount`).
+	Mounts []string
 }
 
 // New instantiates a new manager that is meant to
 // take care of volume creation, listing, updating
 // and stats retrieval under a given root path.
-func New(cfg Config) (manager Manager, err error) {
+func New(cfg Config) (manager *Manager, err error) {
 	if cfg.Root == "" {
 		err = errors.Errorf("Root not specified.")
 		return
@@ -64,25 +203,112 @@ func New(cfg Config) (manager Manager, err error) {
 		return
 	}
 
-	quotaCtl, err := xfs.NewControl(xfs.ControlConfig{
-		BasePath: cfg.Root,
-	})
+	rootLock, err := newFileLock(filepath.Join(cfg.Root, lockFileName), cfg.LockTimeout)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't initialize lock on root path %s",
+			cfg.Root)
+		return
+	}
+
+	var quotaCtl = cfg.Backend
+	if quotaCtl == nil {
+		var s settings
+
+		s, err = resolveSettings(cfg.Root, cfg)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't resolve settings of root path %s",
+				cfg.Root)
+			return
+		}
+
+		quotaCtl, err = xfs.NewControl(xfs.ControlConfig{
+			BasePath:          cfg.Root,
+			StartingProjectId: cfg.StartingProjectId,
+			MaxProjectId:      cfg.MaxProjectId,
+			BlockDeviceMode:   cfg.BlockDeviceMode,
+			PreflightMode:     cfg.PreflightMode,
+			ProjectsFile:      s.ProjectsFile,
+			ProjIdFile:        s.ProjIdFile,
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't initialize XFS quota control on root path %s",
+				cfg.Root)
+			return
+		}
+	}
+
+	metadata, err := newMetadataStore(filepath.Join(cfg.Root, metadataDirName))
 	if err != nil {
 		err = errors.Wrapf(err,
-			"Couldn't initialize XFS quota control on root path %s",
+			"Couldn't initialize metadata store on root path %s",
 			cfg.Root)
 		return
 	}
 
-	manager.quotaCtl = &quotaCtl
-	manager.root = cfg.Root
+	snapshots, err := newMetadataStore(filepath.Join(cfg.Root, metadataDirName, "snapshots"))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't initialize snapshot metadata store on root path %s",
+			cfg.Root)
+		return
+	}
 
+	journal, err := newJournal(filepath.Join(cfg.Root, metadataDirName, journalDirName))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't initialize journal on root path %s",
+			cfg.Root)
+		return
+	}
+
+	locks, err := newVolumeLocks(filepath.Join(cfg.Root, metadataDirName, locksDirName), cfg.LockTimeout)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't initialize volume locks on root path %s",
+			cfg.Root)
+		return
+	}
+
+	metadataLocks, err := newVolumeLocks(filepath.Join(cfg.Root, metadataDirName, locksDirName, metadataLocksDirName), cfg.LockTimeout)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't initialize metadata locks on root path %s",
+			cfg.Root)
+		return
+	}
+
+	m := &Manager{
+		quotaCtl:      quotaCtl,
+		root:          cfg.Root,
+		locks:         locks,
+		metadataLocks: metadataLocks,
+		rootLock:      rootLock,
+		metadata:      metadata,
+		snapshots:     snapshots,
+		journal:       journal,
+	}
+
+	err = m.recover()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't recover interrupted operations on root path %s",
+			cfg.Root)
+		return
+	}
+
+	manager = m
 	return
 }
 
 // List lists all the volumes that have been created under
 // a given root path that is controlled by this manager.
-func (m Manager) List() (vols []Volume, err error) {
+//
+// Volumes that get removed while the listing takes place
+// are not included.
+func (m *Manager) List() (vols []Volume, err error) {
 	files, err := ioutil.ReadDir(m.root)
 	if err != nil {
 		err = errors.Wrapf(err,
@@ -91,24 +317,30 @@ func (m Manager) List() (vols []Volume, err error) {
 	}
 
 	for _, file := range files {
-		if file.IsDir() {
-			var quota *xfs.Quota
-			absPath := filepath.Join(m.root, file.Name())
+		if !file.IsDir() || !isValidName(file.Name()) {
+			continue
+		}
+
+		var (
+			vol   Volume
+			found bool
+		)
+
+		var unlock func()
+		unlock, err = m.lockVolume(file.Name(), false)
+		if err != nil {
+			return
+		}
+
+		vol, found, err = m.get(file.Name())
+		unlock()
 
-			quota, err = m.quotaCtl.GetQuota(absPath)
-			if err != nil {
-				err = errors.Wrapf(err,
-					"Couldn't retrieve quota for directory %s",
-					file.Name())
-				return
-			}
+		if err != nil {
+			return
+		}
 
-			vols = append(vols, Volume{
-				Name:  file.Name(),
-				Size:  quota.Size,
-				INode: quota.INode,
-				Path:  absPath,
-			})
+		if found {
+			vols = append(vols, vol)
 		}
 	}
 
@@ -121,51 +353,133 @@ func (m Manager) List() (vols []Volume, err error) {
 // `/mnt/xfs/volumes`, then a volume named `foo` that would live
 // under `/mnt/xfs/volumes/foo` can be retrieved by passing `foo`
 // as the parameter.
-func (m Manager) Get(name string) (vol Volume, found bool, err error) {
-	var absPath string
-
+func (m *Manager) Get(name string) (vol Volume, found bool, err error) {
 	if !isValidName(name) {
 		err = ErrInvalidName
 		return
 	}
 
-	files, err := ioutil.ReadDir(m.root)
+	unlock, err := m.lockVolume(name, false)
 	if err != nil {
-		err = errors.Wrapf(err,
-			"Couldn't list files/directories from %s", m.root)
 		return
 	}
+	defer unlock()
 
-	for _, file := range files {
-		if file.IsDir() && file.Name() == name {
-			found = true
-			var quota *xfs.Quota
-			absPath = filepath.Join(m.root, name)
-
-			quota, err = m.quotaCtl.GetQuota(absPath)
-			if err != nil {
-				err = errors.Wrapf(err,
-					"Couldn't retrieve quota for directory %s",
-					file.Name())
-				return
-			}
-
-			vol.Name = filepath.Base(absPath)
-			vol.Size = quota.Size
-			vol.INode = quota.INode
-			vol.Path = absPath
+	vol, found, err = m.get(name)
+	return
+}
+
+// get retrieves a volume by its name without taking the
+// volume lock - callers are expected to hold it.
+func (m *Manager) get(name string) (vol Volume, found bool, err error) {
+	var absPath = filepath.Join(m.root, name)
+
+	finfo, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
 			return
 		}
+
+		err = errors.Wrapf(err,
+			"Couldn't stat volume directory %s", absPath)
+		return
 	}
 
+	if !finfo.IsDir() {
+		return
+	}
+
+	stat := finfo.Sys().(*syscall.Stat_t)
+
+	// Directories without a project id are not volumes (e.g.,
+	// created by hand under the root) while volumes whose
+	// project lost its limits are still volumes - just not
+	// limited anymore.
+	quota, err := m.quotaCtl.GetQuota(absPath)
+	switch {
+	case errors.Is(err, xfs.ErrNoProjectId):
+		err = nil
+		return
+	case errors.Is(err, xfs.ErrNoQuota):
+		err = nil
+		quota = &xfs.Quota{}
+	case err != nil:
+		err = errors.Wrapf(err,
+			"Couldn't retrieve quota for directory %s",
+			name)
+		return
+	}
+
+	// the project id might be gone if the directory lost it
+	// after its quota got retrieved - not a volume anymore.
+	projectId, hasProjectId := m.quotaCtl.GetProjectId(absPath)
+	if !hasProjectId {
+		return
+	}
+
+	md, _, err := m.metadata.Load(name)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't retrieve metadata of volume %s",
+			name)
+		return
+	}
+
+	found = true
+	vol.Name = name
+	vol.Size = quota.Size
+	vol.SoftSize = quota.SoftSize
+	vol.INode = quota.INode
+	vol.SoftINode = quota.SoftINode
+	vol.UsedSize = quota.UsedSize
+	vol.UsedINode = quota.UsedInode
+	vol.PercentUsed = percentUsed(quota)
+	vol.Path = absPath
+	vol.ProjectId = projectId
+	vol.Uid = int(stat.Uid)
+	vol.Gid = int(stat.Gid)
+	vol.Mode = finfo.Mode().Perm()
+	vol.CreatedAt = md.CreatedAt
+	vol.Options = md.Options
+	vol.Labels = md.Labels
+	vol.Mounts = md.Mounts
 	return
 }
 
 // Create validates a volume specification and then proceed with
-// creating the volume under the controlled root directory.
-func (m Manager) Create(vol Volume) (absPath string, err error) {
-	if vol.Size == 0 {
-		err = ErrEmptyQuota
+// creating the volume under the controlled root directory,
+// recording its metadata (creation time, options and labels).
+//
+// Creating a volume that already exists with the same
+// specification (e.g., a retried request) succeeds without
+// changing it, while creating it with a different one fails
+// with `ErrConflict`. Directories under the root that are not
+// volumes are left untouched (see `Adopt`).
+func (m *Manager) Create(vol Volume) (absPath string, err error) {
+	absPath, err = m.createOrAdopt(vol, false)
+	return
+}
+
+// Adopt creates a volume (see `Create`) allowing its directory
+// to already exist without being a volume, in which case it gets
+// turned into one with its contents kept (and accounted against
+// the quota of the volume).
+func (m *Manager) Adopt(vol Volume) (absPath string, err error) {
+	absPath, err = m.createOrAdopt(vol, true)
+	return
+}
+
+func (m *Manager) createOrAdopt(vol Volume, adopt bool) (absPath string, err error) {
+	var quota = xfs.Quota{
+		Size:      vol.Size,
+		SoftSize:  vol.SoftSize,
+		INode:     vol.INode,
+		SoftINode: vol.SoftINode,
+	}
+
+	err = validateLimits(quota)
+	if err != nil {
 		return
 	}
 
@@ -174,40 +488,434 @@ func (m Manager) Create(vol Volume) (absPath string, err error) {
 		return
 	}
 
+	unlock, err := m.lockVolume(vol.Name, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	existing, found, err := m.get(vol.Name)
+	if err != nil {
+		return
+	}
+
 	absPath = filepath.Join(m.root, vol.Name)
-	err = os.MkdirAll(absPath, 0755)
+
+	if found {
+		differences := specDifferences(existing, vol, m.quotaCtl.GetSizeGranularity())
+		if len(differences) > 0 {
+			err = errors.Wrapf(ErrConflict,
+				"volume %s exists with %s",
+				vol.Name, strings.Join(differences, ", "))
+		}
+
+		return
+	}
+
+	finfo, err := os.Stat(absPath)
+	switch {
+	case err == nil && !finfo.IsDir():
+		err = errors.Wrapf(ErrNotAVolume,
+			"%s is not a directory", absPath)
+		return
+	case err == nil && !adopt:
+		err = errors.Wrapf(ErrNotAVolume,
+			"directory %s already exists", absPath)
+		return
+	case err == nil:
+		// adopting the directory, which is kept as is (with its
+		// contents) even if the creation fails.
+		err = m.adopt(vol)
+		return
+	case !os.IsNotExist(err):
+		err = errors.Wrapf(err,
+			"Couldn't stat directory %s", absPath)
+		return
+	}
+
+	if vol.CreatedAt.IsZero() {
+		vol.CreatedAt = time.Now().UTC()
+	}
+
+	err = m.journal.Begin(opCreate, vol)
+	if err != nil {
+		return
+	}
+
+	// nothing got created if creating the directory fails, thus,
+	// there's nothing to roll back (and what's in its place, if
+	// anything, is not ours to remove).
+	err = os.Mkdir(absPath, 0755)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Couldn't create directory %s", absPath)
+		m.journal.Finish(vol.Name)
 		return
 	}
 
-	err = m.quotaCtl.SetQuota(absPath, xfs.Quota{
-		Size:  vol.Size,
-		INode: vol.INode,
+	err = setOwnership(absPath, vol)
+	if err == nil {
+		err = m.create(vol, quota)
+	}
+	if err != nil {
+		m.abortCreate(vol.Name)
+		return
+	}
+
+	err = m.journal.Finish(vol.Name)
+	return
+}
+
+// adopt turns an existing directory into a volume, recording the
+// operation in the journal such that it gets completed if it's
+// interrupted.
+//
+// Callers are expected to hold the volume lock.
+func (m *Manager) adopt(vol Volume) (err error) {
+	var absPath = filepath.Join(m.root, vol.Name)
+
+	if vol.CreatedAt.IsZero() {
+		vol.CreatedAt = time.Now().UTC()
+	}
+
+	err = m.journal.Begin(opAdopt, vol)
+	if err != nil {
+		return
+	}
+
+	err = setOwnership(absPath, vol)
+	if err == nil {
+		err = m.create(vol, volumeQuota(vol))
+	}
+
+	finishErr := m.journal.Finish(vol.Name)
+	if err == nil {
+		err = finishErr
+	}
+
+	return
+}
+
+// abortCreate rolls back a creation that failed, keeping its
+// intent in the journal if that fails too such that it gets
+// retried on recovery.
+func (m *Manager) abortCreate(name string) {
+	if m.remove(name) != nil {
+		return
+	}
+
+	m.journal.Finish(name)
+}
+
+// create sets the quota of a volume whose directory is in place
+// and records its metadata, releasing the quota if recording the
+// metadata fails.
+//
+// Callers are expected to hold the volume lock and to remove the
+// directory (if they created it) when it fails.
+func (m *Manager) create(vol Volume, quota xfs.Quota) (err error) {
+	var absPath = filepath.Join(m.root, vol.Name)
+
+	err = m.assignQuota(absPath, quota)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't set quota for volume name=%s size=%d soft-size=%d inode=%d soft-inode=%d",
+			vol.Name, vol.Size, vol.SoftSize, vol.INode, vol.SoftINode)
+		return
+	}
+
+	if vol.CreatedAt.IsZero() {
+		vol.CreatedAt = time.Now().UTC()
+	}
+
+	err = m.metadata.Save(vol.Name, metadata{
+		CreatedAt: vol.CreatedAt,
+		Options:   vol.Options,
+		Labels:    vol.Labels,
 	})
 	if err != nil {
 		err = errors.Wrapf(err,
-			"Couldn't set quota for volume name=%s size=%d inode=%d",
-			vol.Name, vol.Size, vol.INode)
-		os.RemoveAll(absPath)
+			"Couldn't record metadata of volume %s",
+			vol.Name)
+		m.releaseQuota(absPath)
 		return
 	}
 
 	return
 }
 
-// Delete tries to delete a volume by its name.
+// Clone creates a volume (`vol`) with a copy of the contents of
+// an existing one (`src`), with files sharing their data with
+// the source ones (reflinks) when the filesystem supports it.
+//
+// The clone gets its own project: it's accounted against its own
+// quota, taking the size limits of the source when `vol` doesn't
+// specify any and, likewise, the inode ones.
+//
+// The source is only read, thus, it can be read by others (and
+// mounted) while the contents get copied.
+//
+// Just like with `Create`, cloning into a volume that already
+// exists with the same specification succeeds without touching
+// it, while a different one fails with `ErrConflict`.
+func (m *Manager) Clone(src string, vol Volume) (absPath string, err error) {
+	if !isValidName(src) || !isValidName(vol.Name) {
+		err = ErrInvalidName
+		return
+	}
+
+	// cloning a volume into itself is never a retry of a
+	// previous clone, thus, it always fails as the target exists.
+	if src == vol.Name {
+		err = ErrExists
+		return
+	}
+
+	var exclusive = map[string]bool{
+		src:      false,
+		vol.Name: true,
+	}
+
+	unlock, err := m.lockVolumes(exclusive)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	srcVol, found, err := m.get(src)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = errors.Wrapf(ErrNotFound,
+			"Couldn't find volume %s to clone", src)
+		return
+	}
+
+	// size and inode limits are inherited separately, each
+	// pair (hard and soft) only when the clone leaves it unset
+	// such that a soft limit never ends up above a hard one.
+	if vol.Size == 0 && vol.SoftSize == 0 {
+		vol.Size = srcVol.Size
+		vol.SoftSize = srcVol.SoftSize
+	}
+
+	if vol.INode == 0 && vol.SoftINode == 0 {
+		vol.INode = srcVol.INode
+		vol.SoftINode = srcVol.SoftINode
+	}
+
+	var quota = xfs.Quota{
+		Size:      vol.Size,
+		SoftSize:  vol.SoftSize,
+		INode:     vol.INode,
+		SoftINode: vol.SoftINode,
+	}
+
+	err = validateLimits(quota)
+	if err != nil {
+		return
+	}
+
+	existing, found, err := m.get(vol.Name)
+	if err != nil {
+		return
+	}
+
+	absPath = filepath.Join(m.root, vol.Name)
+
+	if found {
+		differences := specDifferences(existing, vol, m.quotaCtl.GetSizeGranularity())
+		if len(differences) > 0 {
+			err = errors.Wrapf(ErrConflict,
+				"volume %s exists with %s",
+				vol.Name, strings.Join(differences, ", "))
+		}
+
+		return
+	}
+
+	_, err = os.Lstat(absPath)
+	switch {
+	case err == nil:
+		err = ErrExists
+		return
+	case !os.IsNotExist(err):
+		err = errors.Wrapf(err,
+			"Couldn't stat directory %s", absPath)
+		return
+	}
+
+	if vol.CreatedAt.IsZero() {
+		vol.CreatedAt = time.Now().UTC()
+	}
+
+	err = m.journal.Begin(opCreate, vol)
+	if err != nil {
+		return
+	}
+
+	err = os.Mkdir(absPath, 0755)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create directory %s", absPath)
+		m.journal.Finish(vol.Name)
+		return
+	}
+
+	err = m.create(vol, quota)
+	if err != nil {
+		m.abortCreate(vol.Name)
+		return
+	}
+
+	err = copyTree(srcVol.Path, absPath)
+	if err == nil {
+		err = setOwnership(absPath, vol)
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't copy contents of volume %s to %s",
+			src, vol.Name)
+		m.abortCreate(vol.Name)
+		return
+	}
+
+	err = m.journal.Finish(vol.Name)
+	return
+}
+
+// Resize changes the limits of an existing volume while it's
+// in use (i.e., without touching its data).
+//
+// Limits can't go below what the volume already uses unless
+// `force` is set - in which case the volume is left over quota,
+// with writes failing until enough gets removed from it.
+func (m *Manager) Resize(name string, quota xfs.Quota, force bool) (vol Volume, err error) {
+	err = validateLimits(quota)
+	if err != nil {
+		return
+	}
+
+	if !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(name, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	vol, found, err := m.get(name)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrNotFound
+		return
+	}
+
+	current, err := m.quotaCtl.GetQuota(vol.Path)
+	switch {
+	case errors.Is(err, xfs.ErrNoQuota):
+		err = nil
+		current = &xfs.Quota{}
+	case err != nil:
+		err = errors.Wrapf(err,
+			"Couldn't retrieve usage of volume %s",
+			name)
+		return
+	}
+
+	if !force {
+		if quota.Size < current.UsedSize {
+			err = errors.Wrapf(ErrSizeBelowUsage,
+				"volume %s uses %s", name, HumanSize(current.UsedSize))
+			return
+		}
+
+		if quota.INode != 0 && quota.INode < current.UsedInode {
+			err = errors.Wrapf(ErrINodeBelowUsage,
+				"volume %s uses %d inodes", name, current.UsedInode)
+			return
+		}
+	}
+
+	err = m.journal.Begin(opResize, Volume{
+		Name:      name,
+		Size:      quota.Size,
+		SoftSize:  quota.SoftSize,
+		INode:     quota.INode,
+		SoftINode: quota.SoftINode,
+	})
+	if err != nil {
+		return
+	}
+
+	err = m.quotaCtl.SetQuota(vol.Path, quota)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't set quota for volume name=%s size=%d soft-size=%d inode=%d soft-inode=%d",
+			name, quota.Size, quota.SoftSize, quota.INode, quota.SoftINode)
+		m.journal.Finish(name)
+		return
+	}
+
+	err = m.journal.Finish(name)
+	if err != nil {
+		return
+	}
+
+	quota.UsedSize = current.UsedSize
+	quota.UsedInode = current.UsedInode
+
+	vol.Size = quota.Size
+	vol.SoftSize = quota.SoftSize
+	vol.INode = quota.INode
+	vol.SoftINode = quota.SoftINode
+	vol.UsedSize = quota.UsedSize
+	vol.UsedINode = quota.UsedInode
+	vol.PercentUsed = percentUsed(&quota)
+	return
+}
+
+// Delete tries to delete a volume by its name, releasing the
+// project quota that was associated with it.
+//
+// Snapshots of the volume are deleted with it.
 //
 // ps.: Deleting a volume that doesn't exist is considered
-// an error.
-func (m Manager) Delete(name string) (err error) {
+// an error, as well as deleting a volume that is mounted
+// (see `ForceDelete`).
+func (m *Manager) Delete(name string) (err error) {
+	err = m.delete(name, false)
+	return
+}
+
+// ForceDelete deletes a volume (see `Delete`) even if it's
+// mounted.
+func (m *Manager) ForceDelete(name string) (err error) {
+	err = m.delete(name, true)
+	return
+}
+
+func (m *Manager) delete(name string, force bool) (err error) {
 	if !isValidName(name) {
 		err = ErrInvalidName
 		return
 	}
 
-	vol, found, err := m.Get(name)
+	unlock, err := m.lockVolume(name, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	vol, found, err := m.get(name)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Errored retrieving abs path for name %s",
@@ -220,11 +928,356 @@ func (m Manager) Delete(name string) (err error) {
 		return
 	}
 
-	err = os.RemoveAll(vol.Path)
+	if len(vol.Mounts) > 0 && !force {
+		err = errors.Wrapf(ErrInUse,
+			"volume %s is mounted by %s",
+			name, strings.Join(vol.Mounts, ", "))
+		return
+	}
+
+	err = m.journal.Begin(opDelete, Volume{Name: name})
+	if err != nil {
+		return
+	}
+
+	err = m.remove(name)
+	if err != nil {
+		return
+	}
+
+	err = m.journal.Finish(name)
+	return
+}
+
+// remove removes a volume together with its quota, metadata and
+// snapshots. Parts that are already gone are skipped such that
+// an interrupted removal can be carried on.
+//
+// Callers are expected to hold the volume lock.
+func (m *Manager) remove(name string) (err error) {
+	var absPath = filepath.Join(m.root, name)
+
+	err = m.removeTree(absPath)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Errored removing volume named %s at path %s",
-			name, vol.Path)
+			name, absPath)
+		return
+	}
+
+	err = m.metadata.Delete(name)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored removing metadata of volume named %s",
+			name)
+		return
+	}
+
+	snapshotKeys, err := m.listSnapshotKeys(name)
+	if err != nil {
+		return
+	}
+
+	for _, key := range snapshotKeys {
+		err = m.deleteSnapshot(key[0], key[1])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// removeTree removes the directory of a volume releasing its
+// quota.
+//
+// The contents go first, then the quota and only then the
+// directory itself: as the project id is only known through the
+// directory, it must outlive the quota for an interrupted removal
+// to be able to release it.
+func (m *Manager) removeTree(absPath string) (err error) {
+	entries, err := ioutil.ReadDir(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(absPath, entry.Name()))
+		if err != nil {
+			return
+		}
+	}
+
+	err = m.releaseQuota(absPath)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored releasing quota of %s", absPath)
+		return
+	}
+
+	err = os.Remove(absPath)
+	if err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// lockVolume acquires the lock of a given volume, shared with
+// other processes managing the same root (see `volumeLocks`).
+//
+// The returned function must be called to release it.
+func (m *Manager) lockVolume(name string, exclusive bool) (unlock func(), err error) {
+	unlock, err = m.lockVolumes(map[string]bool{name: exclusive})
+	return
+}
+
+// lockVolumes acquires the locks of several volumes (see
+// `lockVolume`), each exclusively or not as mapped, always in the
+// same (lexical) order such that operations that involve the same
+// volumes can't deadlock.
+func (m *Manager) lockVolumes(exclusive map[string]bool) (unlock func(), err error) {
+	var (
+		unlockVolumes []func()
+		names         = make([]string, 0, len(exclusive))
+	)
+
+	for name := range exclusive {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	unlock = func() {
+		for idx := len(unlockVolumes) - 1; idx >= 0; idx-- {
+			unlockVolumes[idx]()
+		}
+	}
+
+	for _, name := range names {
+		var unlockVolume func()
+		unlockVolume, err = m.locks.Lock(name, exclusive[name])
+		if err != nil {
+			unlock()
+			unlock = nil
+			err = errors.Wrapf(err,
+				"Couldn't lock volume %s", name)
+			return
+		}
+
+		unlockVolumes = append(unlockVolumes, unlockVolume)
+	}
+
+	return
+}
+
+// lockRoot acquires the root lock, which must be held while
+// project ids get assigned or released, refreshing the quota
+// control state as other processes might have changed it.
+//
+// The returned function must be called to release it.
+func (m *Manager) lockRoot() (unlock func(), err error) {
+	m.rootMu.Lock()
+
+	unlockRoot, err := m.rootLock.Lock(true)
+	if err != nil {
+		m.rootMu.Unlock()
+		err = errors.Wrapf(err,
+			"Couldn't lock root %s", m.root)
+		return
+	}
+
+	unlock = func() {
+		unlockRoot()
+		m.rootMu.Unlock()
+	}
+
+	err = m.quotaCtl.Refresh()
+	if err != nil {
+		unlock()
+		unlock = nil
+		err = errors.Wrapf(err,
+			"Couldn't refresh quota control state")
+		return
+	}
+
+	return
+}
+
+// assignQuota sets the quota of a directory that might not have
+// a project id yet, holding the root lock while doing so.
+func (m *Manager) assignQuota(absPath string, quota xfs.Quota) (err error) {
+	unlock, err := m.lockRoot()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = m.quotaCtl.SetQuota(absPath, quota)
+	return
+}
+
+// releaseQuota releases the quota of a directory (if it has a
+// project id), holding the root lock while doing so.
+func (m *Manager) releaseQuota(absPath string) (err error) {
+	unlock, err := m.lockRoot()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = m.quotaCtl.RemoveQuota(absPath)
+	if err != nil && errors.Is(err, xfs.ErrNoProjectId) {
+		err = nil
+	}
+
+	return
+}
+
+// setOwnership applies the owner and mode of a volume
+// specification (if set) to its root directory.
+func setOwnership(absPath string, vol Volume) (err error) {
+	if vol.Uid != 0 || vol.Gid != 0 {
+		err = os.Chown(absPath, vol.Uid, vol.Gid)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't set owner of volume %s to %d:%d",
+				vol.Name, vol.Uid, vol.Gid)
+			return
+		}
+	}
+
+	if vol.Mode != 0 {
+		err = os.Chmod(absPath, vol.Mode.Perm())
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't set mode of volume %s to %#o",
+				vol.Name, vol.Mode.Perm())
+			return
+		}
+	}
+
+	return
+}
+
+// volumeQuota retrieves the limits of a volume specification.
+func volumeQuota(vol Volume) xfs.Quota {
+	return xfs.Quota{
+		Size:      vol.Size,
+		SoftSize:  vol.SoftSize,
+		INode:     vol.INode,
+		SoftINode: vol.SoftINode,
+	}
+}
+
+// specDifferences describes how an existing volume differs from
+// the specification it's being created with.
+//
+// Ownership and mode are only compared when specified, as zero
+// values leave them to the defaults. Sizes are compared as the
+// backend stores them, i.e., rounded down to its granularity.
+func specDifferences(existing, vol Volume, granularity uint64) (differences []string) {
+	var limits = []struct {
+		name               string
+		existing, required uint64
+		size               bool
+	}{
+		{"size", existing.Size, vol.Size, true},
+		{"soft-size", existing.SoftSize, vol.SoftSize, true},
+		{"inode", existing.INode, vol.INode, false},
+		{"soft-inode", existing.SoftINode, vol.SoftINode, false},
+	}
+
+	for _, limit := range limits {
+		var required = limit.required
+		if limit.size && granularity > 1 {
+			required = required / granularity * granularity
+		}
+
+		if limit.existing == required {
+			continue
+		}
+
+		if limit.size {
+			differences = append(differences, fmt.Sprintf("%s %s (requested %s)",
+				limit.name, HumanSize(limit.existing), HumanSize(limit.required)))
+		} else {
+			differences = append(differences, fmt.Sprintf("%s %d (requested %d)",
+				limit.name, limit.existing, limit.required))
+		}
+	}
+
+	if (vol.Uid != 0 || vol.Gid != 0) && (vol.Uid != existing.Uid || vol.Gid != existing.Gid) {
+		differences = append(differences, fmt.Sprintf("owner %d:%d (requested %d:%d)",
+			existing.Uid, existing.Gid, vol.Uid, vol.Gid))
+	}
+
+	if vol.Mode != 0 && vol.Mode.Perm() != existing.Mode {
+		differences = append(differences, fmt.Sprintf("mode %#o (requested %#o)",
+			existing.Mode, vol.Mode.Perm()))
+	}
+
+	if !equalLabels(existing.Labels, vol.Labels) {
+		differences = append(differences, "different labels")
+	}
+
+	return
+}
+
+// equalLabels tells whether two sets of labels are the same
+// (with no labels being the same as empty ones).
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		other, present := b[key]
+		if !present || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// percentUsed computes how much of its hard limits a project
+// uses, taking the highest of the size and inode percentages.
+func percentUsed(quota *xfs.Quota) (percent float64) {
+	if quota.Size != 0 {
+		percent = 100 * float64(quota.UsedSize) / float64(quota.Size)
+	}
+
+	if quota.INode != 0 {
+		inodePercent := 100 * float64(quota.UsedInode) / float64(quota.INode)
+		if inodePercent > percent {
+			percent = inodePercent
+		}
+	}
+
+	return
+}
+
+// validateLimits verifies whether the limits of a quota are
+// consistent: a size must be specified and soft limits can't
+// be greater than hard limits.
+func validateLimits(quota xfs.Quota) (err error) {
+	if quota.Size == 0 {
+		err = ErrEmptyQuota
+		return
+	}
+
+	if quota.SoftSize > quota.Size {
+		err = ErrSoftSizeAboveHard
+		return
+	}
+
+	if quota.INode != 0 && quota.SoftINode > quota.INode {
+		err = ErrSoftINodeAboveHard
 		return
 	}
 
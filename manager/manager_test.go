@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 	"testing"
 
 	"github.com/cirocosta/xfsvol/manager"
@@ -163,6 +164,32 @@ func TestCreate_cantCreateWithEmptySize(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCreate_cantCreateWithSoftLimitsAboveHardLimits(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Create(manager.Volume{
+		Name:     "abc",
+		Size:     manager.MustFromHumanSize("10M"),
+		SoftSize: manager.MustFromHumanSize("20M"),
+	})
+	assert.Equal(t, manager.ErrSoftSizeAboveHard, err)
+
+	_, err = m.Create(manager.Volume{
+		Name:      "abc",
+		Size:      manager.MustFromHumanSize("10M"),
+		INode:     10,
+		SoftINode: 20,
+	})
+	assert.Equal(t, manager.ErrSoftINodeAboveHard, err)
+}
+
 func TestList_listsDirectories(t *testing.T) {
 	dir, err := ioutil.TempDir(xfsMount, "")
 	assert.NoError(t, err)
@@ -231,6 +258,34 @@ func TestGet_findsDirectory(t *testing.T) {
 	assert.Equal(t, path.Join(dir, "abc"), vol.Path)
 }
 
+func TestGet_retrievesSoftAndHardLimits(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	_, err = m.Create(manager.Volume{
+		Name:      "abc",
+		Size:      manager.MustFromHumanSize("10MB"),
+		SoftSize:  manager.MustFromHumanSize("8MB"),
+		INode:     100,
+		SoftINode: 80,
+	})
+	assert.NoError(t, err)
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, "8MB", manager.HumanSize(vol.SoftSize))
+	assert.Equal(t, uint64(100), vol.INode)
+	assert.Equal(t, uint64(80), vol.SoftINode)
+}
+
 func TestDelete_succeedsForExistentVolume(t *testing.T) {
 	dir, err := ioutil.TempDir(xfsMount, "")
 	assert.NoError(t, err)
@@ -273,3 +328,154 @@ func TestDelete_failsForInexistentVolume(t *testing.T) {
 	err = m.Delete("abc")
 	assert.Error(t, err)
 }
+
+func TestDelete_allowsRecreatingVolumeWithFreshQuota(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	absPath, err := m.Create(manager.Volume{
+		Name: "abc",
+		Size: manager.MustFromHumanSize("10MB"),
+	})
+	assert.NoError(t, err)
+
+	fd, err := os.Create(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+	assert.NoError(t, utils.WriteBytes(fd, 'c', 1<<20))
+	fd.Close()
+
+	assert.NoError(t, m.Delete("abc"))
+
+	_, err = m.Create(manager.Volume{
+		Name: "def",
+		Size: manager.MustFromHumanSize("20MB"),
+	})
+	assert.NoError(t, err)
+
+	vol, found, err := m.Get("def")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "20MB", manager.HumanSize(vol.Size))
+}
+
+func TestManager_concurrentCreateDeleteList(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	var (
+		wg      sync.WaitGroup
+		workers = 8
+		rounds  = 10
+	)
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("vol-%d", worker)
+			for round := 0; round < rounds; round++ {
+				_, err := m.Create(manager.Volume{
+					Name: name,
+					Size: manager.MustFromHumanSize("1M"),
+				})
+				assert.NoError(t, err)
+
+				_, err = m.List()
+				assert.NoError(t, err)
+
+				assert.NoError(t, m.Delete(name))
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 0)
+}
+
+func TestManager_concurrentOperationsOnSameVolume(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for round := 0; round < 10; round++ {
+				m.Create(manager.Volume{
+					Name: "abc",
+					Size: manager.MustFromHumanSize("1M"),
+				})
+
+				_, _, err := m.Get("abc")
+				assert.NoError(t, err)
+
+				m.Delete("abc")
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestManager_multipleManagersOnSameRootDontShareProjectIds(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m1, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	m2, err := manager.New(manager.Config{
+		Root: dir,
+	})
+	assert.NoError(t, err)
+
+	_, err = m1.Create(manager.Volume{
+		Name: "abc",
+		Size: manager.MustFromHumanSize("10MB"),
+	})
+	assert.NoError(t, err)
+
+	_, err = m2.Create(manager.Volume{
+		Name: "def",
+		Size: manager.MustFromHumanSize("20MB"),
+	})
+	assert.NoError(t, err)
+
+	vol, found, err := m1.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10MB", manager.HumanSize(vol.Size))
+
+	vol, found, err = m1.Get("def")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "20MB", manager.HumanSize(vol.Size))
+}
@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// metadataDirName is the name of the directory under the root
+// that holds the metadata of the volumes. As volume names must
+// start with an alphanumeric character, it can't clash with any
+// volume.
+const metadataDirName = "__xfsvol.meta"
+
+// metadata is the persisted record of what's known about a
+// volume besides its quota (which lives in the filesystem).
+type metadata struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Options   map[string]string `json:"options,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	// Mounts are the ids of the callers that have the
+	// volume mounted (see `Manager.Mount`).
+	Mounts []string `json:"mounts,omitempty"`
+}
+
+// metadataStore stores the metadata of each volume in a JSON
+// file named after it (`<name>.json`) under a directory that
+// sits next to the volumes, outside of their data trees.
+//
+// Records are replaced atomically (written to a temporary file
+// that is then renamed over the previous one) such that a crash
+// never leaves a partially written record behind.
+//
+// Callers are expected to hold the lock of the volume whose
+// record they access.
+type metadataStore struct {
+	dir string
+}
+
+// newMetadataStore creates a store under a given directory,
+// creating the directory if it doesn't exist.
+func newMetadataStore(dir string) (s *metadataStore, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create metadata directory %s", dir)
+		return
+	}
+
+	s = &metadataStore{
+		dir: dir,
+	}
+	return
+}
+
+func (s *metadataStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Load retrieves the record of a volume, telling whether
+// one exists (volumes created by older versions have none).
+func (s *metadataStore) Load(name string) (md metadata, found bool, err error) {
+	var path = s.path(name)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"couldn't read metadata file %s", path)
+		return
+	}
+
+	err = json.Unmarshal(content, &md)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't parse metadata file %s", path)
+		return
+	}
+
+	found = true
+	return
+}
+
+// Save atomically writes the record of a volume.
+func (s *metadataStore) Save(name string, md metadata) (err error) {
+	content, err := json.Marshal(&md)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't encode metadata of volume %s", name)
+		return
+	}
+
+	err = writeFileAtomically(s.path(name), content)
+	return
+}
+
+// writeFileAtomically replaces the contents of a file by
+// writing them to a temporary file in the same directory that
+// is then renamed over it.
+func writeFileAtomically(path string, content []byte) (err error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create temporary file for %s", path)
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't write temporary file for %s", path)
+		return
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't replace file %s", path)
+		return
+	}
+
+	return
+}
+
+// Delete removes the record of a volume (if any).
+func (s *metadataStore) Delete(name string) (err error) {
+	var path = s.path(name)
+
+	err = os.Remove(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"couldn't remove metadata file %s", path)
+		return
+	}
+
+	return
+}
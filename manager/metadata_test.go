@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMetadataStore(t *testing.T) (s *metadataStore, cleanup func()) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+
+	s, err = newMetadataStore(filepath.Join(dir, metadataDirName))
+	assert.NoError(t, err)
+
+	cleanup = func() {
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestMetadataStore_loadsWhatWasSaved(t *testing.T) {
+	s, cleanup := newTestMetadataStore(t)
+	defer cleanup()
+
+	var md = metadata{
+		CreatedAt: time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC),
+		Options:   map[string]string{"size": "10M"},
+		Labels:    map[string]string{"team": "ci"},
+	}
+
+	assert.NoError(t, s.Save("abc", md))
+
+	loaded, found, err := s.Load("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, md, loaded)
+
+	files, err := ioutil.ReadDir(s.dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestMetadataStore_missingRecordIsNotAnError(t *testing.T) {
+	s, cleanup := newTestMetadataStore(t)
+	defer cleanup()
+
+	_, found, err := s.Load("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, s.Delete("abc"))
+}
+
+func TestMetadataStore_failsOnCorruptRecord(t *testing.T) {
+	s, cleanup := newTestMetadataStore(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(s.path("abc"), []byte("{"), 0600))
+
+	_, _, err := s.Load("abc")
+	assert.Error(t, err)
+}
+
+func TestMetadataStore_deleteRemovesRecord(t *testing.T) {
+	s, cleanup := newTestMetadataStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Save("abc", metadata{CreatedAt: time.Now()}))
+	assert.NoError(t, s.Delete("abc"))
+
+	_, found, err := s.Load("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
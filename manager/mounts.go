@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Mount records that a volume got mounted by a given caller
+// (e.g., the id of the container that docker mounts it for),
+// retrieving the volume.
+//
+// Mounts are persisted together with the metadata of the
+// volume such that they survive restarts of the plugin.
+// Recording the same id more than once has no effect.
+//
+// Mounting doesn't change the volume itself, thus, it only
+// holds the volume lock shared (e.g., a volume can be mounted
+// while it's being cloned).
+func (m *Manager) Mount(name, id string) (vol Volume, err error) {
+	if !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(name, false)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	vol, found, err := m.get(name)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrNotFound
+		return
+	}
+
+	unlockMetadata, err := m.lockMetadata(name)
+	if err != nil {
+		return
+	}
+	defer unlockMetadata()
+
+	md, _, err := m.metadata.Load(name)
+	if err != nil {
+		return
+	}
+
+	vol.Mounts = md.Mounts
+
+	for _, mount := range md.Mounts {
+		if mount == id {
+			return
+		}
+	}
+
+	md.Mounts = append(md.Mounts, id)
+
+	err = m.metadata.Save(name, md)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't record mount %s of volume %s", id, name)
+		return
+	}
+
+	vol.Mounts = md.Mounts
+	return
+}
+
+// Unmount records that a caller that mounted a volume (see
+// `Mount`) doesn't use it anymore.
+//
+// Unmounting with an id that has no mount recorded has no
+// effect.
+func (m *Manager) Unmount(name, id string) (err error) {
+	if !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(name, false)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	_, found, err := m.get(name)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrNotFound
+		return
+	}
+
+	unlockMetadata, err := m.lockMetadata(name)
+	if err != nil {
+		return
+	}
+	defer unlockMetadata()
+
+	md, _, err := m.metadata.Load(name)
+	if err != nil {
+		return
+	}
+
+	var mounts = make([]string, 0, len(md.Mounts))
+	for _, mount := range md.Mounts {
+		if mount != id {
+			mounts = append(mounts, mount)
+		}
+	}
+
+	if len(mounts) == len(md.Mounts) {
+		return
+	}
+
+	md.Mounts = mounts
+
+	err = m.metadata.Save(name, md)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't release mount %s of volume %s", id, name)
+		return
+	}
+
+	return
+}
+
+// lockMetadata acquires the lock of the metadata of a volume,
+// which must be held for updating it while holding the volume
+// lock shared.
+func (m *Manager) lockMetadata(name string) (unlock func(), err error) {
+	unlock, err = m.metadataLocks.Lock(name, true)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't lock metadata of volume %s", name)
+		return
+	}
+
+	return
+}
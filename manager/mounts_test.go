@@ -0,0 +1,92 @@
+package manager_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeBackend_mountsArePersisted(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	vol, err := m.Mount("abc", "container1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"container1"}, vol.Mounts)
+
+	vol, err = m.Mount("abc", "container1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"container1"}, vol.Mounts)
+
+	_, err = m.Mount("abc", "container2")
+	assert.NoError(t, err)
+
+	restarted, err := manager.New(manager.Config{
+		Root:    dir,
+		Backend: backend,
+	})
+	assert.NoError(t, err)
+
+	vol, found, err := restarted.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"container1", "container2"}, vol.Mounts)
+
+	assert.NoError(t, restarted.Unmount("abc", "container1"))
+	assert.NoError(t, restarted.Unmount("abc", "unknown"))
+
+	vol, _, err = m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"container2"}, vol.Mounts)
+
+	_, err = m.Mount("inexistent", "container1")
+	assert.Equal(t, manager.ErrNotFound, errors.Cause(err))
+}
+
+func TestFakeBackend_deleteRefusesMountedVolumes(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	_, err := m.Mount("abc", "container1")
+	assert.NoError(t, err)
+
+	err = m.Delete("abc")
+	assert.Error(t, err)
+	assert.Equal(t, manager.ErrInUse, errors.Cause(err))
+
+	_, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	assert.NoError(t, m.Unmount("abc", "container1"))
+	assert.NoError(t, m.Delete("abc"))
+
+	_, found, err = m.Get("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFakeBackend_forceDeleteRemovesMountedVolumes(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	_, err := m.Mount("abc", "container1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.ForceDelete("abc"))
+
+	_, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assertNoQuotas(t, backend)
+}
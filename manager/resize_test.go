@@ -0,0 +1,99 @@
+package manager_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeBackend_resizeChangesLimits(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "abc", "1MB")
+
+	assert.NoError(t, backend.Use(absPath, 1000*1000, 1))
+	assert.Error(t, backend.Use(absPath, 1, 0))
+
+	vol, err := m.Resize("abc", xfs.Quota{
+		Size:     manager.MustFromHumanSize("2MB"),
+		SoftSize: manager.MustFromHumanSize("1MB"),
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "2MB", manager.HumanSize(vol.Size))
+
+	vol, found, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "2MB", manager.HumanSize(vol.Size))
+	assert.Equal(t, "1MB", manager.HumanSize(vol.SoftSize))
+
+	assert.NoError(t, backend.Use(absPath, 1000, 0))
+}
+
+func TestFakeBackend_resizeRefusesShrinkingBelowUsage(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath, err := m.Create(manager.Volume{
+		Name:  "abc",
+		Size:  manager.MustFromHumanSize("2MB"),
+		INode: 10,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, backend.Use(absPath, 1000*1000, 5))
+
+	_, err = m.Resize("abc", xfs.Quota{
+		Size:  manager.MustFromHumanSize("500KB"),
+		INode: 10,
+	}, false)
+	assert.Equal(t, manager.ErrSizeBelowUsage, errors.Cause(err))
+
+	_, err = m.Resize("abc", xfs.Quota{
+		Size:  manager.MustFromHumanSize("2MB"),
+		INode: 2,
+	}, false)
+	assert.Equal(t, manager.ErrINodeBelowUsage, errors.Cause(err))
+
+	vol, _, err := m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "2MB", manager.HumanSize(vol.Size))
+
+	_, err = m.Resize("abc", xfs.Quota{
+		Size:  manager.MustFromHumanSize("500KB"),
+		INode: 10,
+	}, true)
+	assert.NoError(t, err)
+
+	vol, _, err = m.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, manager.MustFromHumanSize("500KB"), vol.Size)
+
+	assert.Error(t, backend.Use(absPath, 1, 0))
+}
+
+func TestFakeBackend_resizeValidatesLimits(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := m.Resize("abc", xfs.Quota{
+		Size: manager.MustFromHumanSize("1MB"),
+	}, false)
+	assert.Equal(t, manager.ErrNotFound, err)
+
+	createVolume(t, m, "abc", "1MB")
+
+	_, err = m.Resize("abc", xfs.Quota{}, false)
+	assert.Equal(t, manager.ErrEmptyQuota, err)
+
+	_, err = m.Resize("abc", xfs.Quota{
+		Size:     manager.MustFromHumanSize("1MB"),
+		SoftSize: manager.MustFromHumanSize("2MB"),
+	}, false)
+	assert.Equal(t, manager.ErrSoftSizeAboveHard, err)
+}
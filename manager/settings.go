@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// settingsFileName is the name of the file (under the metadata
+// directory) that holds the settings of the root. As volume names
+// must start with an alphanumeric character, it can't clash with
+// the metadata of any volume.
+const settingsFileName = "_settings.json"
+
+// settings is the part of the configuration that every process
+// managing a root must agree on, e.g., such that a volume deleted
+// by `xfsvolctl` gets its entries removed from the project files
+// that the plugin keeps.
+//
+// It's recorded under the root whenever a manager is configured
+// with it and picked up by managers that aren't.
+type settings struct {
+	ProjectsFile string `json:"projects_file,omitempty"`
+	ProjIdFile   string `json:"projid_file,omitempty"`
+}
+
+// resolveSettings retrieves the settings that a manager of a given
+// root must use: those of the configuration when it specifies any
+// (recording them for other managers) or the recorded ones when it
+// doesn't.
+func resolveSettings(root string, cfg Config) (s settings, err error) {
+	var path = filepath.Join(root, metadataDirName, settingsFileName)
+
+	if cfg.ProjectsFile == "" && cfg.ProjIdFile == "" {
+		var content []byte
+
+		content, err = ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+				return
+			}
+
+			err = errors.Wrapf(err,
+				"couldn't read settings file %s", path)
+			return
+		}
+
+		err = json.Unmarshal(content, &s)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't parse settings file %s", path)
+			return
+		}
+
+		return
+	}
+
+	s = settings{
+		ProjectsFile: cfg.ProjectsFile,
+		ProjIdFile:   cfg.ProjIdFile,
+	}
+
+	content, err := json.Marshal(&s)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't encode settings")
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create metadata directory %s", filepath.Dir(path))
+		return
+	}
+
+	err = writeFileAtomically(path, content)
+	return
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSettings_emptyWithoutRecordedSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := resolveSettings(dir, Config{Root: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, settings{}, s)
+}
+
+func TestResolveSettings_picksUpRecordedSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := resolveSettings(dir, Config{
+		Root:         dir,
+		ProjectsFile: "/etc/projects",
+		ProjIdFile:   "/etc/projid",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/projects", s.ProjectsFile)
+	assert.Equal(t, "/etc/projid", s.ProjIdFile)
+
+	s, err = resolveSettings(dir, Config{Root: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/projects", s.ProjectsFile)
+	assert.Equal(t, "/etc/projid", s.ProjIdFile)
+
+	// configured settings replace the recorded ones
+	s, err = resolveSettings(dir, Config{
+		Root:         dir,
+		ProjectsFile: "/mnt/xfs/projects",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/xfs/projects", s.ProjectsFile)
+	assert.Equal(t, "", s.ProjIdFile)
+
+	s, err = resolveSettings(dir, Config{Root: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/xfs/projects", s.ProjectsFile)
+	assert.Equal(t, "", s.ProjIdFile)
+}
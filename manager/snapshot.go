@@ -0,0 +1,436 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// snapshotDirPrefix prefixes the directories under the root
+	// that hold snapshots (`<prefix><volume>.<snapshot>`). They
+	// sit directly under the root (like volumes) such that they
+	// get project ids from the same quota control.
+	snapshotDirPrefix = "__xfsvol.snapshot."
+
+	// snapshotDataDirName is the directory of a snapshot that
+	// holds the copy of the volume's contents.
+	snapshotDataDirName = "data"
+)
+
+var (
+	ErrSnapshotNotFound = errors.Errorf("Snapshot not found")
+	ErrSnapshotExists   = errors.Errorf("Snapshot already exists")
+)
+
+// Snapshot represents a point-in-time copy of the contents
+// of a volume.
+//
+// Snapshots have their own project id, such that they're
+// accounted separately from the volume they've been taken
+// from, and are not volumes: they can't be retrieved nor
+// mounted as such, only restored into the volume. Their
+// files are plain copies though, thus, nothing keeps them
+// from being modified through the directory that holds them.
+type Snapshot struct {
+	Name   string
+	Volume string
+
+	// Path is the directory that holds the snapshot.
+	Path string
+
+	// UsedSize and UsedINode are the disk space (in bytes)
+	// and the number of inodes that the snapshot uses.
+	UsedSize  uint64
+	UsedINode uint64
+
+	CreatedAt time.Time
+}
+
+// snapshotKey builds the key that identifies a snapshot both
+// in the name of its directory and in the metadata store.
+//
+// As neither volume nor snapshot names can contain dots, the
+// key can be unambiguously split back.
+func snapshotKey(volume, name string) string {
+	return volume + "." + name
+}
+
+func (m *Manager) snapshotPath(volume, name string) string {
+	return filepath.Join(m.root, snapshotDirPrefix+snapshotKey(volume, name))
+}
+
+// CreateSnapshot takes a snapshot of the contents of a volume,
+// cloning its files with reflinks when the filesystem supports
+// it (see `Clone`).
+//
+// The volume is only read, thus, it can be read by others (and
+// mounted) while the contents get copied.
+func (m *Manager) CreateSnapshot(volume, name string) (snapshot Snapshot, err error) {
+	if !isValidName(volume) || !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(volume, false)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	vol, found, err := m.get(volume)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrNotFound
+		return
+	}
+
+	var absPath = m.snapshotPath(volume, name)
+
+	err = os.Mkdir(absPath, 0700)
+	if err != nil {
+		if os.IsExist(err) {
+			err = ErrSnapshotExists
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"Couldn't create snapshot directory %s", absPath)
+		return
+	}
+
+	// the snapshot is a copy of what the volume holds, so it
+	// always fits in the limits of the volume - unless the
+	// volume got shrunk below its usage.
+	var quota = xfs.Quota{
+		Size: vol.Size,
+	}
+
+	if vol.UsedSize > quota.Size {
+		quota.Size = vol.UsedSize
+	}
+
+	err = m.assignQuota(absPath, quota)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't set quota for snapshot %s of volume %s",
+			name, volume)
+		os.RemoveAll(absPath)
+		return
+	}
+
+	var dataPath = filepath.Join(absPath, snapshotDataDirName)
+
+	err = os.Mkdir(dataPath, 0755)
+	if err == nil {
+		err = copyTree(vol.Path, dataPath)
+	}
+	if err == nil {
+		err = m.snapshots.Save(snapshotKey(volume, name), metadata{
+			CreatedAt: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't snapshot volume %s into %s",
+			volume, absPath)
+		os.RemoveAll(absPath)
+		m.releaseQuota(absPath)
+		return
+	}
+
+	snapshot, _, err = m.getSnapshot(volume, name)
+	return
+}
+
+// ListSnapshots lists the snapshots of a volume (or of every
+// volume if `volume` is empty), ordered by volume and creation
+// time.
+func (m *Manager) ListSnapshots(volume string) (snapshots []Snapshot, err error) {
+	keys, err := m.listSnapshotKeys(volume)
+	if err != nil {
+		return
+	}
+
+	for _, key := range keys {
+		var (
+			snapshot Snapshot
+			found    bool
+		)
+
+		snapshot, found, err = m.getSnapshot(key[0], key[1])
+		if err != nil {
+			return
+		}
+
+		if found {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if snapshots[i].Volume != snapshots[j].Volume {
+			return snapshots[i].Volume < snapshots[j].Volume
+		}
+
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return
+}
+
+// RestoreSnapshot replaces the contents of a volume with those
+// of one of its snapshots, which is kept.
+//
+// Restoring fails if the snapshot doesn't fit in the current
+// limits of the volume or if the volume is mounted (see
+// `ForceRestoreSnapshot`).
+func (m *Manager) RestoreSnapshot(volume, name string) (err error) {
+	err = m.restoreSnapshot(volume, name, false)
+	return
+}
+
+// ForceRestoreSnapshot restores a snapshot (see `RestoreSnapshot`)
+// even if the volume is mounted, replacing the files from under
+// the containers that use it.
+func (m *Manager) ForceRestoreSnapshot(volume, name string) (err error) {
+	err = m.restoreSnapshot(volume, name, true)
+	return
+}
+
+func (m *Manager) restoreSnapshot(volume, name string, force bool) (err error) {
+	if !isValidName(volume) || !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(volume, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	vol, found, err := m.get(volume)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrNotFound
+		return
+	}
+
+	if len(vol.Mounts) > 0 && !force {
+		err = errors.Wrapf(ErrInUse,
+			"volume %s is mounted by %s",
+			volume, strings.Join(vol.Mounts, ", "))
+		return
+	}
+
+	snapshot, found, err := m.getSnapshot(volume, name)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrSnapshotNotFound
+		return
+	}
+
+	if snapshot.UsedSize > vol.Size || (vol.INode != 0 && snapshot.UsedINode > vol.INode) {
+		err = errors.Wrapf(xfs.ErrQuotaExceeded,
+			"snapshot %s (%s, %d inodes) doesn't fit in volume %s (%s, %d inodes)",
+			name, HumanSize(snapshot.UsedSize), snapshot.UsedINode,
+			volume, HumanSize(vol.Size), vol.INode)
+		return
+	}
+
+	err = m.journal.BeginRestore(volume, name)
+	if err != nil {
+		return
+	}
+
+	err = m.restore(vol, snapshot)
+
+	finishErr := m.journal.Finish(volume)
+	if err == nil {
+		err = finishErr
+	}
+
+	return
+}
+
+// restore replaces the contents of a volume with those of a
+// snapshot.
+//
+// Callers are expected to hold the volume lock.
+func (m *Manager) restore(vol Volume, snapshot Snapshot) (err error) {
+	entries, err := ioutil.ReadDir(vol.Path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't list contents of volume %s", vol.Name)
+		return
+	}
+
+	// the volume directory itself is kept (with its project
+	// id) such that restored files are accounted against the
+	// volume's quota.
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(vol.Path, entry.Name()))
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't clear contents of volume %s", vol.Name)
+			return
+		}
+	}
+
+	err = copyTree(filepath.Join(snapshot.Path, snapshotDataDirName), vol.Path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't restore snapshot %s into volume %s",
+			snapshot.Name, vol.Name)
+		return
+	}
+
+	return
+}
+
+// DeleteSnapshot deletes a snapshot of a volume, releasing the
+// project that was associated with it.
+func (m *Manager) DeleteSnapshot(volume, name string) (err error) {
+	if !isValidName(volume) || !isValidName(name) {
+		err = ErrInvalidName
+		return
+	}
+
+	unlock, err := m.lockVolume(volume, true)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	_, found, err := m.getSnapshot(volume, name)
+	if err != nil {
+		return
+	}
+
+	if !found {
+		err = ErrSnapshotNotFound
+		return
+	}
+
+	err = m.deleteSnapshot(volume, name)
+	return
+}
+
+// deleteSnapshot removes a snapshot without taking the volume
+// lock - callers are expected to hold it.
+//
+// The directory goes away like the ones of volumes (see
+// `removeTree`), releasing the quota before the directory itself
+// such that an interrupted deletion can still release it.
+func (m *Manager) deleteSnapshot(volume, name string) (err error) {
+	var absPath = m.snapshotPath(volume, name)
+
+	err = m.removeTree(absPath)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored removing snapshot %s of volume %s at path %s",
+			name, volume, absPath)
+		return
+	}
+
+	err = m.snapshots.Delete(snapshotKey(volume, name))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored removing metadata of snapshot %s of volume %s",
+			name, volume)
+		return
+	}
+
+	return
+}
+
+// getSnapshot retrieves a snapshot without taking any lock.
+//
+// Snapshot directories without metadata (e.g., left behind by
+// an interrupted creation) are not considered snapshots.
+func (m *Manager) getSnapshot(volume, name string) (snapshot Snapshot, found bool, err error) {
+	var absPath = m.snapshotPath(volume, name)
+
+	md, found, err := m.snapshots.Load(snapshotKey(volume, name))
+	if err != nil || !found {
+		return
+	}
+
+	_, err = os.Stat(absPath)
+	if err != nil {
+		found = false
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err,
+			"Couldn't stat snapshot directory %s", absPath)
+		return
+	}
+
+	quota, err := m.quotaCtl.GetQuota(absPath)
+	switch {
+	case errors.Is(err, xfs.ErrNoQuota):
+		err = nil
+		quota = &xfs.Quota{}
+	case err != nil:
+		err = errors.Wrapf(err,
+			"Couldn't retrieve usage of snapshot %s of volume %s",
+			name, volume)
+		return
+	}
+
+	snapshot = Snapshot{
+		Name:      name,
+		Volume:    volume,
+		Path:      absPath,
+		UsedSize:  quota.UsedSize,
+		UsedINode: quota.UsedInode,
+		CreatedAt: md.CreatedAt,
+	}
+	return
+}
+
+// listSnapshotKeys lists the volume and snapshot names of the
+// snapshot directories under the root, optionally only those of
+// a given volume.
+func (m *Manager) listSnapshotKeys(volume string) (keys [][2]string, err error) {
+	files, err := ioutil.ReadDir(m.root)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't list files/directories from %s", m.root)
+		return
+	}
+
+	for _, file := range files {
+		if !file.IsDir() || !strings.HasPrefix(file.Name(), snapshotDirPrefix) {
+			continue
+		}
+
+		fields := strings.SplitN(strings.TrimPrefix(file.Name(), snapshotDirPrefix), ".", 2)
+		if len(fields) != 2 || (volume != "" && fields[0] != volume) {
+			continue
+		}
+
+		keys = append(keys, [2]string{fields[0], fields[1]})
+	}
+
+	return
+}
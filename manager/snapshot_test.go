@@ -0,0 +1,175 @@
+package manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeBackend_snapshotsCanBeRestored(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "db", "10MB")
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "data"), []byte("v1"), 0644))
+
+	snapshot, err := m.CreateSnapshot("db", "pre-migration")
+	assert.NoError(t, err)
+	assert.Equal(t, "pre-migration", snapshot.Name)
+	assert.Equal(t, "db", snapshot.Volume)
+	assert.False(t, snapshot.CreatedAt.IsZero())
+
+	volProjectId, _ := backend.GetProjectId(absPath)
+	snapshotProjectId, found := backend.GetProjectId(snapshot.Path)
+	assert.True(t, found)
+	assert.NotEqual(t, volProjectId, snapshotProjectId)
+
+	_, err = m.CreateSnapshot("db", "pre-migration")
+	assert.Equal(t, manager.ErrSnapshotExists, err)
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "data"), []byte("v2"), 0644))
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "new"), []byte("v2"), 0644))
+
+	assert.NoError(t, m.RestoreSnapshot("db", "pre-migration"))
+
+	content, err := ioutil.ReadFile(path.Join(absPath, "data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	_, err = os.Stat(path.Join(absPath, "new"))
+	assert.True(t, os.IsNotExist(err))
+
+	// snapshots are not volumes
+	vols, err := m.List()
+	assert.NoError(t, err)
+	assert.Len(t, vols, 1)
+
+	snapshots, err := m.ListSnapshots("")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+
+	assert.NoError(t, m.DeleteSnapshot("db", "pre-migration"))
+	assert.Equal(t, manager.ErrSnapshotNotFound, m.DeleteSnapshot("db", "pre-migration"))
+	assert.Equal(t, manager.ErrSnapshotNotFound, m.RestoreSnapshot("db", "pre-migration"))
+
+	_, found = backend.GetProjectId(snapshot.Path)
+	assert.False(t, found)
+
+	snapshots, err = m.ListSnapshots("db")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 0)
+}
+
+func TestFakeBackend_snapshotsAreListedPerVolume(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"abc", "def"} {
+		_, err := m.Create(manager.Volume{
+			Name: name,
+			Size: manager.MustFromHumanSize("10MB"),
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err := m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+	_, err = m.CreateSnapshot("abc", "second")
+	assert.NoError(t, err)
+	_, err = m.CreateSnapshot("def", "first")
+	assert.NoError(t, err)
+
+	snapshots, err := m.ListSnapshots("abc")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	for _, snapshot := range snapshots {
+		assert.Equal(t, "abc", snapshot.Volume)
+	}
+
+	snapshots, err = m.ListSnapshots("")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 3)
+
+	_, err = m.CreateSnapshot("ghi", "first")
+	assert.Equal(t, manager.ErrNotFound, err)
+}
+
+func TestFakeBackend_deletingVolumeDeletesSnapshots(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "10MB")
+
+	snapshot, err := m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Delete("abc"))
+
+	snapshots, err := m.ListSnapshots("")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 0)
+
+	_, err = os.Stat(snapshot.Path)
+	assert.True(t, os.IsNotExist(err))
+
+	assertNoQuotas(t, backend)
+}
+
+func TestFakeBackend_restoreRefusesSnapshotsThatDontFit(t *testing.T) {
+	m, backend, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	createVolume(t, m, "abc", "2MB")
+
+	snapshot, err := m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+
+	assert.NoError(t, backend.Use(snapshot.Path, 1500*1000, 1))
+
+	_, err = m.Resize("abc", xfs.Quota{
+		Size: manager.MustFromHumanSize("1MB"),
+	}, false)
+	assert.NoError(t, err)
+
+	err = m.RestoreSnapshot("abc", "first")
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, xfs.ErrQuotaExceeded))
+}
+
+func TestFakeBackend_restoreRefusesMountedVolumes(t *testing.T) {
+	m, _, dir := newFakeManager(t)
+	defer os.RemoveAll(dir)
+
+	absPath := createVolume(t, m, "abc", "10MB")
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("first"), 0644))
+
+	_, err := m.CreateSnapshot("abc", "first")
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(absPath, "file"), []byte("second"), 0644))
+
+	_, err = m.Mount("abc", "container")
+	assert.NoError(t, err)
+
+	err = m.RestoreSnapshot("abc", "first")
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, manager.ErrInUse))
+
+	content, err := ioutil.ReadFile(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(content))
+
+	assert.NoError(t, m.ForceRestoreSnapshot("abc", "first"))
+
+	content, err = ioutil.ReadFile(path.Join(absPath, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(content))
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"os"
-	"sync"
+	"strconv"
+	"time"
 
 	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/ventu-io/go-shortid"
@@ -15,16 +17,46 @@ import (
 type DriverConfig struct {
 	HostMountpoint string
 	DefaultSize    string
+	MinProjectId   uint32
+	MaxProjectId   uint32
+	LockTimeout    time.Duration
+
+	// BlockDeviceMode is the textual representation of
+	// the `xfs.BlockDeviceMode` to resolve the block device
+	// with (empty for the default).
+	BlockDeviceMode string
+
+	// PreflightMode is the textual representation of the
+	// `xfs.PreflightMode` that determines whether the driver
+	// refuses to start when the filesystem is not fit for
+	// enforcing project quotas (empty for the default).
+	PreflightMode string
+
+	// ProjectsFile and ProjIdFile are the paths of the project
+	// files to keep in sync with the volumes (empty to use the
+	// ones recorded under the root, if any).
+	ProjectsFile string
+	ProjIdFile   string
+
+	// DefaultINode is the inode limit of volumes created without
+	// the `inode` option (0 for no limit).
+	DefaultINode uint64
 }
 
+// Driver implements the docker volume plugin API on top
+// of a volume manager.
+//
+// Concurrency is handled by the manager: requests that
+// target the same volume are serialized while requests
+// for different volumes are served in parallel.
 type Driver struct {
-	defaultSize string
-	logger      zerolog.Logger
-	manager     *manager.Manager
-	sync.Mutex
+	defaultSize  uint64
+	defaultINode uint64
+	logger       zerolog.Logger
+	manager      *manager.Manager
 }
 
-func NewDriver(cfg DriverConfig) (d Driver, err error) {
+func NewDriver(cfg DriverConfig) (d *Driver, err error) {
 	if cfg.HostMountpoint == "" {
 		err = errors.Errorf("HostMountpoint must be specified")
 		return
@@ -35,9 +67,42 @@ func NewDriver(cfg DriverConfig) (d Driver, err error) {
 		return
 	}
 
-	m, err := manager.New(manager.Config{
-		Root: cfg.HostMountpoint,
-	})
+	defaultSize, err := manager.FromHumanSize(cfg.DefaultSize)
+	if err != nil || defaultSize == 0 {
+		err = errors.Errorf(
+			"DefaultSize (%s) must be a size such as 512M or 10G",
+			cfg.DefaultSize)
+		return
+	}
+
+	blockDeviceMode, err := xfs.ParseBlockDeviceMode(cfg.BlockDeviceMode)
+	if err != nil {
+		return
+	}
+
+	preflightMode, err := xfs.ParsePreflightMode(cfg.PreflightMode)
+	if err != nil {
+		return
+	}
+
+	var managerCfg = manager.Config{
+		Root:            cfg.HostMountpoint,
+		LockTimeout:     cfg.LockTimeout,
+		BlockDeviceMode: blockDeviceMode,
+		PreflightMode:   preflightMode,
+		ProjectsFile:    cfg.ProjectsFile,
+		ProjIdFile:      cfg.ProjIdFile,
+	}
+
+	if cfg.MinProjectId != 0 {
+		managerCfg.StartingProjectId = &cfg.MinProjectId
+	}
+
+	if cfg.MaxProjectId != 0 {
+		managerCfg.MaxProjectId = &cfg.MaxProjectId
+	}
+
+	m, err := manager.New(managerCfg)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Couldn't initiate fs manager mounting at %s",
@@ -45,51 +110,61 @@ func NewDriver(cfg DriverConfig) (d Driver, err error) {
 		return
 	}
 
+	d = new(Driver)
 	d.logger = zerolog.New(os.Stdout).With().Str("from", "driver").Logger()
-	d.defaultSize = cfg.DefaultSize
+	d.defaultSize = defaultSize
+	d.defaultINode = cfg.DefaultINode
 	d.logger.Info().Msg("driver initiated")
-	d.manager = &m
+	d.manager = m
 
 	return
 }
 
-func (d Driver) Create(req *v.CreateRequest) (err error) {
+func (d *Driver) Create(req *v.CreateRequest) (err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
 		Str("method", "create").
 		Str("name", req.Name).
-		Str("opts-size", req.Options["size"]).
-		Str("opts-inode", req.Options["inode"]).
+		Interface("opts", req.Options).
 		Logger()
 
-	size, present := req.Options["size"]
-	if !present {
+	opts, err := parseCreateOptions(req.Options)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create volume %s", req.Name)
+		return
+	}
+
+	var vol = opts.vol
+	vol.Name = req.Name
+
+	// clones take the limits that aren't specified from the
+	// volume they're cloned from (see `manager.Clone`).
+	if !opts.hasSize && opts.from == "" {
 		logger.Debug().
-			Str("default", d.defaultSize).
+			Uint64("default", d.defaultSize).
 			Msg("no size opt found, using default")
-		size = d.defaultSize
+		vol.Size = d.defaultSize
 	}
 
-	sizeInBytes, err := manager.FromHumanSize(size)
-	if err != nil {
-		err = errors.Errorf(
-			"couldn't convert specified size [%s] into bytes",
-			size)
-		return
+	if !opts.hasINode && opts.from == "" {
+		vol.INode = d.defaultINode
 	}
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().
 		Msg("starting creation")
 
-	absHostPath, err := d.manager.Create(manager.Volume{
-		Name: req.Name,
-		Size: sizeInBytes,
-	})
+	var absHostPath string
+	switch {
+	case opts.from != "":
+		absHostPath, err = d.manager.Clone(opts.from, vol)
+	case opts.adopt:
+		absHostPath, err = d.manager.Adopt(vol)
+	default:
+		absHostPath, err = d.manager.Create(vol)
+	}
 	if err != nil {
-		err = errors.Wrapf(err,
+		err = describeError(err,
 			"manager failed to create volume %s",
 			req.Name)
 		return
@@ -101,21 +176,18 @@ func (d Driver) Create(req *v.CreateRequest) (err error) {
 	return
 }
 
-func (d Driver) List() (resp *v.ListResponse, err error) {
+func (d *Driver) List() (resp *v.ListResponse, err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
 		Str("method", "list").
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().
 		Msg("starting volume listing")
 
 	vols, err := d.manager.List()
 	if err != nil {
-		err = errors.Wrapf(err,
+		err = describeError(err,
 			"manager failed to list volumes")
 		return
 	}
@@ -124,7 +196,8 @@ func (d Driver) List() (resp *v.ListResponse, err error) {
 	resp.Volumes = make([]*v.Volume, len(vols))
 	for idx, vol := range vols {
 		resp.Volumes[idx] = &v.Volume{
-			Name: vol.Name,
+			Name:       vol.Name,
+			Mountpoint: vol.Path,
 		}
 	}
 
@@ -134,22 +207,19 @@ func (d Driver) List() (resp *v.ListResponse, err error) {
 	return
 }
 
-func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
+func (d *Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
 		Str("method", "get").
 		Str("name", req.Name).
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().
 		Msg("starting volume retrieval")
 
 	vol, found, err := d.manager.Get(req.Name)
 	if err != nil {
-		err = errors.Wrapf(err,
+		err = describeError(err,
 			"manager failed to get volume named %s",
 			req.Name)
 		return
@@ -164,6 +234,7 @@ func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 	resp.Volume = &v.Volume{
 		Name:       req.Name,
 		Mountpoint: vol.Path,
+		Status:     volumeStatus(vol),
 	}
 
 	logger.Debug().
@@ -172,22 +243,102 @@ func (d Driver) Get(req *v.GetRequest) (resp *v.GetResponse, err error) {
 	return
 }
 
-func (d Driver) Remove(req *v.RemoveRequest) (err error) {
+// Resize changes the limits of an existing volume, keeping the
+// ones that the request doesn't specify.
+//
+// It's not part of docker's volume plugin API (which has no way
+// of changing a volume after it got created), being served on
+// the plugin's socket by `handleResize` instead.
+func (d *Driver) Resize(req *ResizeRequest) (resp *ResizeResponse, err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
-		Str("method", "remove").
+		Str("method", "resize").
 		Str("name", req.Name).
+		Interface("opts", req.Options).
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
+	opts, err := parseResizeOptions(req.Options)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't resize volume %s", req.Name)
+		return
+	}
+
+	logger.Debug().
+		Msg("starting resize")
+
+	vol, found, err := d.manager.Get(req.Name)
+	if err != nil {
+		err = describeError(err,
+			"manager failed to get volume named %s",
+			req.Name)
+		return
+	}
+
+	if !found {
+		err = describeError(manager.ErrNotFound,
+			"couldn't resize volume %s", req.Name)
+		return
+	}
+
+	var quota = xfs.Quota{
+		Size:      vol.Size,
+		SoftSize:  vol.SoftSize,
+		INode:     vol.INode,
+		SoftINode: vol.SoftINode,
+	}
+
+	if opts.set["size"] {
+		quota.Size = opts.vol.Size
+	}
+
+	if opts.set["soft-size"] {
+		quota.SoftSize = opts.vol.SoftSize
+	}
+
+	if opts.set["inode"] {
+		quota.INode = opts.vol.INode
+	}
+
+	if opts.set["soft-inode"] {
+		quota.SoftINode = opts.vol.SoftINode
+	}
+
+	vol, err = d.manager.Resize(req.Name, quota, opts.force)
+	if err != nil {
+		err = describeError(err,
+			"manager failed to resize volume named %s",
+			req.Name)
+		return
+	}
+
+	resp = new(ResizeResponse)
+	resp.Volume = &v.Volume{
+		Name:       req.Name,
+		Mountpoint: vol.Path,
+		Status:     volumeStatus(vol),
+	}
+
+	logger.Debug().
+		Uint64("size", quota.Size).
+		Uint64("inode", quota.INode).
+		Msg("finished resizing volume")
+	return
+}
+
+func (d *Driver) Remove(req *v.RemoveRequest) (err error) {
+	var logger = d.logger.With().
+		Str("log-id", shortid.MustGenerate()).
+		Str("method", "remove").
+		Str("name", req.Name).
+		Logger()
 
 	logger.Debug().
 		Msg("starting removal")
 
 	err = d.manager.Delete(req.Name)
 	if err != nil {
-		err = errors.Wrapf(err,
+		err = describeError(err,
 			"manager failed to delete volume named %s",
 			req.Name)
 		return
@@ -198,22 +349,19 @@ func (d Driver) Remove(req *v.RemoveRequest) (err error) {
 	return
 }
 
-func (d Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
+func (d *Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
 		Str("method", "path").
 		Str("name", req.Name).
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().
 		Msg("starting path retrieval")
 
 	vol, found, err := d.manager.Get(req.Name)
 	if err != nil {
-		err = errors.Wrapf(err,
+		err = describeError(err,
 			"manager failed to retrieve volume named %s",
 			req.Name)
 		return
@@ -233,7 +381,7 @@ func (d Driver) Path(req *v.PathRequest) (resp *v.PathResponse, err error) {
 	return
 }
 
-func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
+func (d *Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
 		Str("method", "mount").
@@ -241,27 +389,20 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 		Str("id", req.ID).
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().
 		Msg("starting mount")
 
-	vol, found, err := d.manager.Get(req.Name)
+	vol, err := d.manager.Mount(req.Name, req.ID)
 	if err != nil {
-		err = errors.Wrapf(err,
-			"failed to retrieve volume named %s",
+		err = describeError(err,
+			"failed to mount volume named %s",
 			req.Name)
 		return
 	}
 
-	if !found {
-		err = errors.Errorf("volume %s not found", req.Name)
-		return
-	}
-
 	logger.Debug().
 		Str("mountpoint", vol.Path).
+		Strs("mounts", vol.Mounts).
 		Msg("finished mounting volume")
 
 	resp = new(v.MountResponse)
@@ -269,25 +410,65 @@ func (d Driver) Mount(req *v.MountRequest) (resp *v.MountResponse, err error) {
 	return
 }
 
-func (d Driver) Unmount(req *v.UnmountRequest) (err error) {
+func (d *Driver) Unmount(req *v.UnmountRequest) (err error) {
 	var logger = d.logger.With().
 		Str("log-id", shortid.MustGenerate()).
-		Str("method", "mount").
+		Str("method", "unmount").
 		Str("name", req.Name).
 		Str("id", req.ID).
 		Logger()
 
-	d.Lock()
-	defer d.Unlock()
-
 	logger.Debug().Msg("started unmounting")
+
+	err = d.manager.Unmount(req.Name, req.ID)
+	if err != nil {
+		err = describeError(err,
+			"failed to unmount volume named %s",
+			req.Name)
+		return
+	}
+
 	logger.Debug().Msg("finished unmounting")
 
 	return
 }
 
+// volumeStatus builds the status of a volume displayed by
+// `docker volume inspect`: its project, limits and usage as
+// well as its recorded metadata.
+func volumeStatus(vol manager.Volume) (status map[string]interface{}) {
+	status = map[string]interface{}{
+		"project-id":   vol.ProjectId,
+		"size":         manager.HumanSize(vol.Size),
+		"soft-size":    manager.HumanSize(vol.SoftSize),
+		"inode":        vol.INode,
+		"soft-inode":   vol.SoftINode,
+		"used-size":    manager.HumanSize(vol.UsedSize),
+		"used-inode":   vol.UsedINode,
+		"percent-used": strconv.FormatFloat(vol.PercentUsed, 'f', 1, 64) + "%",
+	}
+
+	if !vol.CreatedAt.IsZero() {
+		status["created-at"] = vol.CreatedAt.Format(time.RFC3339)
+	}
+
+	if len(vol.Options) > 0 {
+		status["options"] = vol.Options
+	}
+
+	if len(vol.Labels) > 0 {
+		status["labels"] = vol.Labels
+	}
+
+	if len(vol.Mounts) > 0 {
+		status["mounts"] = vol.Mounts
+	}
+
+	return
+}
+
 // TODO is it global?
-func (d Driver) Capabilities() (resp *v.CapabilitiesResponse) {
+func (d *Driver) Capabilities() (resp *v.CapabilitiesResponse) {
 	resp = &v.CapabilitiesResponse{
 		Capabilities: v.Capability{
 			Scope: "global",
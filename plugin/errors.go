@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+)
+
+// errorHints maps the conditions that users can act upon to
+// messages that tell them what's wrong (and how to fix it).
+var errorHints = []struct {
+	err  error
+	hint string
+}{
+	{manager.ErrNotFound,
+		"volume not found"},
+	{manager.ErrExists,
+		"a volume with that name already exists"},
+	{manager.ErrConflict,
+		"a volume with that name already exists with different options - resize it with 'xfsvolctl resize' against the root of the plugin (or at /XfsVol.Resize on its socket), remove it first or create it with the same options"},
+	{manager.ErrNotAVolume,
+		"a directory with that name already exists but is not a volume - create the volume with '--opt adopt=true' to turn it into one"},
+	{manager.ErrInUse,
+		"volume is mounted - stop the containers using it first (or delete it with 'xfsvolctl delete --force')"},
+	{xfs.ErrNoProjectId,
+		"directory is not a volume managed by xfsvol (it has no project id)"},
+	{xfs.ErrNoQuota,
+		"volume has no quota limits set"},
+	{xfs.ErrQuotaNotEnabled,
+		"project quotas are not enabled on the filesystem - mount it with 'pquota' (xfs) or 'prjquota' (ext4)"},
+	{xfs.ErrPermissionDenied,
+		"not permitted to manage project quotas - the plugin requires CAP_SYS_ADMIN"},
+	{xfs.ErrQuotaExceeded,
+		"quota exceeded"},
+	{xfs.ErrInvalidBlockDevice,
+		"the block device backing the volumes is invalid or stale - check that the filesystem is still mounted"},
+	{xfs.ErrProjectIdsExhausted,
+		"no project ids left to assign to new volumes - remove unused volumes or widen the project id range"},
+}
+
+// describeError wraps an error returned by the manager with
+// a message and, if it corresponds to a condition that users
+// can act upon, with a hint describing it.
+func describeError(err error, format string, args ...interface{}) error {
+	err = errors.Wrapf(err, format, args...)
+
+	for _, candidate := range errorHints {
+		if errors.Is(err, candidate.err) {
+			return errors.WithMessage(err, candidate.hint)
+		}
+	}
+
+	return err
+}
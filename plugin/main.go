@@ -2,8 +2,11 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
 	v "github.com/docker/go-plugins-helpers/volume"
@@ -14,18 +17,29 @@ const (
 )
 
 type config struct {
-	HostMountpoint string `arg:"--host-mountpoint,env:HOST_MOUNTPOINT,help:xfs-mounted filesystem to create volumes"`
-	DefaultSize    string `arg:"--default-size,env:DEFAULT_SIZE,help:default size to use as quota"`
-	Debug          bool   `arg:"env:DEBUG,help:enable debug logs"`
+	HostMountpoint  string        `arg:"--host-mountpoint,env:HOST_MOUNTPOINT,help:xfs-mounted filesystem to create volumes"`
+	DefaultSize     string        `arg:"--default-size,env:DEFAULT_SIZE,help:default size to use as quota"`
+	DefaultINode    uint64        `arg:"--default-inode,env:DEFAULT_INODE,help:default inode limit to use as quota (0 for no limit)"`
+	MinProjectId    uint32        `arg:"--min-project-id,env:MIN_PROJECT_ID,help:minimum project id to assign to volumes"`
+	MaxProjectId    uint32        `arg:"--max-project-id,env:MAX_PROJECT_ID,help:maximum project id to assign to volumes"`
+	LockTimeout     time.Duration `arg:"--lock-timeout,env:LOCK_TIMEOUT,help:maximum time to wait for other processes to release the locks of the root and its volumes"`
+	BlockDeviceMode string        `arg:"--block-device-mode,env:BLOCK_DEVICE_MODE,help:how to resolve the block device to issue quota commands against (auto|mountinfo|mknod|lookup)"`
+	PreflightMode   string        `arg:"--preflight-mode,env:PREFLIGHT_MODE,help:whether to fail or warn when the filesystem is not fit for enforcing project quotas, or skip checking it (fail|warn|skip)"`
+	ProjectsFile    string        `arg:"--projects-file,env:PROJECTS_FILE,help:file (/etc/projects format) to record the project of each volume in"`
+	ProjIdFile      string        `arg:"--projid-file,env:PROJID_FILE,help:file (/etc/projid format) to record the name of each volume project in"`
+	Debug           bool          `arg:"env:DEBUG,help:enable debug logs"`
 }
 
 var (
 	version string = "master-dev"
 	logger         = zerolog.New(os.Stdout)
 	args           = &config{
-		HostMountpoint: "/mnt/xfs/volumes",
-		DefaultSize:    "512M",
-		Debug:          false,
+		HostMountpoint:  "/mnt/xfs/volumes",
+		DefaultSize:     "512M",
+		LockTimeout:     30 * time.Second,
+		BlockDeviceMode: "auto",
+		PreflightMode:   "fail",
+		Debug:           false,
 	}
 )
 
@@ -43,9 +57,27 @@ func main() {
 	}
 
 	d, err := NewDriver(DriverConfig{
-		HostMountpoint: args.HostMountpoint,
-		DefaultSize:    args.DefaultSize,
+		HostMountpoint:  args.HostMountpoint,
+		DefaultSize:     args.DefaultSize,
+		DefaultINode:    args.DefaultINode,
+		MinProjectId:    args.MinProjectId,
+		MaxProjectId:    args.MaxProjectId,
+		LockTimeout:     args.LockTimeout,
+		BlockDeviceMode: args.BlockDeviceMode,
+		PreflightMode:   args.PreflightMode,
+		ProjectsFile:    args.ProjectsFile,
+		ProjIdFile:      args.ProjIdFile,
 	})
+	var preflightErr *xfs.PreflightError
+	if errors.As(err, &preflightErr) {
+		logger.Fatal().
+			Str("host-mountpoint", preflightErr.BasePath).
+			Strs("failures", preflightErr.Failures).
+			Msg("refusing to start: filesystem not fit for enforcing project quotas " +
+				"(set PREFLIGHT_MODE=warn to start anyway)")
+		os.Exit(1)
+	}
+
 	if err != nil {
 		logger.Fatal().
 			Err(err).
@@ -54,6 +86,8 @@ func main() {
 	}
 
 	h := v.NewHandler(d)
+	handleResize(h, d)
+
 	err = h.ServeUnix(socketAddress, 0)
 	if err != nil {
 		logger.Fatal().
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/pkg/errors"
+)
+
+// createOptions are the options that a volume can be created
+// with (`docker volume create --opt <name>=<value>`).
+type createOptions struct {
+	// vol holds the specification of the volume to create
+	// (limits, ownership and labels).
+	vol manager.Volume
+
+	// from is the name of the volume to clone (if any).
+	from string
+
+	// adopt tells whether an existing directory that is not a
+	// volume can be turned into one (see `manager.Adopt`).
+	adopt bool
+
+	// hasSize and hasINode tell whether the limits were
+	// specified (instead of taken from the defaults).
+	hasSize  bool
+	hasINode bool
+}
+
+// createOption describes an option accepted on volume creation.
+type createOption struct {
+	usage string
+	parse func(opts *createOptions, value string) error
+}
+
+// createOptionsSchema is the set of options accepted on volume
+// creation - any other option is rejected.
+var createOptionsSchema = map[string]createOption{
+	"size": {
+		usage: "hard limit of the volume size (e.g.: 10G)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.Size, err = parseSizeOption(value)
+			opts.hasSize = true
+			return
+		},
+	},
+	"soft-size": {
+		usage: "size after which the volume is over quota (e.g.: 8G)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.SoftSize, err = parseSizeOption(value)
+			return
+		},
+	},
+	"inode": {
+		usage: "hard limit of the number of inodes (e.g.: 10000)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.INode, err = parseCountOption(value)
+			opts.hasINode = true
+			return
+		},
+	},
+	"soft-inode": {
+		usage: "number of inodes after which the volume is over quota (e.g.: 8000)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.SoftINode, err = parseCountOption(value)
+			return
+		},
+	},
+	"uid": {
+		usage: "numeric id of the user that owns the volume (e.g.: 1000)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.Uid, err = parseIdOption(value)
+			return
+		},
+	},
+	"gid": {
+		usage: "numeric id of the group that owns the volume (e.g.: 1000)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.Gid, err = parseIdOption(value)
+			return
+		},
+	},
+	"mode": {
+		usage: "octal permission bits of the volume directory (e.g.: 0750)",
+		parse: func(opts *createOptions, value string) (err error) {
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || mode == 0 || mode > 0777 {
+				err = errors.Errorf("must be octal permission bits between 1 and 0777")
+				return
+			}
+
+			opts.vol.Mode = os.FileMode(mode)
+			return
+		},
+	},
+	"labels": {
+		usage: "comma-separated key=value labels (e.g.: team=ci,env=prod)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.vol.Labels = make(map[string]string)
+
+			for _, label := range strings.Split(value, ",") {
+				fields := strings.SplitN(label, "=", 2)
+				if len(fields) != 2 || strings.TrimSpace(fields[0]) == "" {
+					err = errors.Errorf("label '%s' must be specified as key=value", label)
+					return
+				}
+
+				opts.vol.Labels[strings.TrimSpace(fields[0])] = fields[1]
+			}
+
+			return
+		},
+	},
+	"adopt": {
+		usage: "whether to turn an existing directory that is not a volume into one (true or false)",
+		parse: func(opts *createOptions, value string) (err error) {
+			opts.adopt, err = strconv.ParseBool(value)
+			if err != nil {
+				err = errors.Errorf("must be either true or false")
+				return
+			}
+
+			return
+		},
+	},
+	"from": {
+		usage: "name of an existing volume to clone",
+		parse: func(opts *createOptions, value string) (err error) {
+			if value == "" {
+				err = errors.Errorf("must be the name of a volume")
+				return
+			}
+
+			opts.from = value
+			return
+		},
+	},
+}
+
+// parseCreateOptions validates the options of a volume creation
+// request against `createOptionsSchema`, failing with an error
+// that describes what's wrong with the first invalid option.
+func parseCreateOptions(options map[string]string) (opts createOptions, err error) {
+	// options are parsed in a deterministic order such that
+	// the same request always fails with the same error.
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		option, known := createOptionsSchema[name]
+		if !known {
+			err = errors.Errorf(
+				"unknown option '%s' - supported options are: %s",
+				name, describeCreateOptions())
+			return
+		}
+
+		err = option.parse(&opts, options[name])
+		if err != nil {
+			err = errors.Wrapf(err,
+				"invalid value '%s' for option '%s' (%s)",
+				options[name], name, option.usage)
+			return
+		}
+	}
+
+	opts.vol.Options = options
+	return
+}
+
+// resizableOptions are the creation options that a volume can
+// be resized with (see `parseResizeOptions`).
+var resizableOptions = []string{"size", "soft-size", "inode", "soft-inode"}
+
+// resizeOptions are the options that a volume can be resized
+// with through the plugin's socket (see `Driver.Resize`).
+type resizeOptions struct {
+	// vol holds the limits to apply.
+	vol manager.Volume
+
+	// set tells which of the limits were specified - those that
+	// weren't are kept as they are.
+	set map[string]bool
+
+	// force tells whether limits below the current usage of the
+	// volume can be applied.
+	force bool
+}
+
+// parseResizeOptions validates the options of a resize request,
+// accepting the limits as they're specified on creation (see
+// `createOptionsSchema`) together with `force`.
+func parseResizeOptions(options map[string]string) (opts resizeOptions, err error) {
+	var limits = make(map[string]string, len(options))
+
+	opts.set = make(map[string]bool, len(options))
+	for _, name := range resizableOptions {
+		value, present := options[name]
+		if present {
+			limits[name] = value
+			opts.set[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if opts.set[name] {
+			continue
+		}
+
+		if name != "force" {
+			err = errors.Errorf(
+				"unknown option '%s' - supported options are: %s, force",
+				name, strings.Join(resizableOptions, ", "))
+			return
+		}
+
+		opts.force, err = strconv.ParseBool(options[name])
+		if err != nil {
+			err = errors.Errorf(
+				"invalid value '%s' for option 'force' (must be either true or false)",
+				options[name])
+			return
+		}
+	}
+
+	if len(limits) == 0 {
+		err = errors.Errorf(
+			"no limits to change - supported options are: %s",
+			strings.Join(resizableOptions, ", "))
+		return
+	}
+
+	created, err := parseCreateOptions(limits)
+	if err != nil {
+		return
+	}
+
+	opts.vol = created.vol
+	opts.vol.Options = nil
+	return
+}
+
+// describeCreateOptions lists the supported options together
+// with their descriptions.
+func describeCreateOptions() string {
+	names := make([]string, 0, len(createOptionsSchema))
+	for name := range createOptionsSchema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	descriptions := make([]string, len(names))
+	for idx, name := range names {
+		descriptions[idx] = name + " (" + createOptionsSchema[name].usage + ")"
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+func parseSizeOption(value string) (size uint64, err error) {
+	size, err = manager.FromHumanSize(value)
+	if err != nil {
+		err = errors.Errorf("must be a size such as 512M or 10G")
+		return
+	}
+
+	return
+}
+
+func parseCountOption(value string) (count uint64, err error) {
+	count, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		err = errors.Errorf("must be a non-negative integer")
+		return
+	}
+
+	return
+}
+
+func parseIdOption(value string) (id int, err error) {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		err = errors.Errorf("must be a non-negative integer")
+		return
+	}
+
+	id = int(parsed)
+	return
+}
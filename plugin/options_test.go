@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCreateOptions_parsesEveryOption(t *testing.T) {
+	var options = map[string]string{
+		"size":       "10M",
+		"soft-size":  "8M",
+		"inode":      "1000",
+		"soft-inode": "800",
+		"uid":        "1000",
+		"gid":        "1001",
+		"mode":       "0750",
+		"labels":     "team=ci,env=prod",
+		"from":       "abc",
+		"adopt":      "true",
+	}
+
+	opts, err := parseCreateOptions(options)
+	assert.NoError(t, err)
+	assert.True(t, opts.hasSize)
+	assert.True(t, opts.hasINode)
+	assert.Equal(t, "abc", opts.from)
+	assert.True(t, opts.adopt)
+	assert.Equal(t, manager.Volume{
+		Size:      manager.MustFromHumanSize("10M"),
+		SoftSize:  manager.MustFromHumanSize("8M"),
+		INode:     1000,
+		SoftINode: 800,
+		Uid:       1000,
+		Gid:       1001,
+		Mode:      os.FileMode(0750),
+		Labels:    map[string]string{"team": "ci", "env": "prod"},
+		Options:   options,
+	}, opts.vol)
+}
+
+func TestParseCreateOptions_acceptsNoOptions(t *testing.T) {
+	opts, err := parseCreateOptions(nil)
+	assert.NoError(t, err)
+	assert.False(t, opts.hasSize)
+	assert.False(t, opts.hasINode)
+}
+
+func TestParseCreateOptions_clonesWithPartialLimits(t *testing.T) {
+	opts, err := parseCreateOptions(map[string]string{
+		"from":  "abc",
+		"inode": "1000",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", opts.from)
+	assert.False(t, opts.hasSize)
+	assert.True(t, opts.hasINode)
+
+	// the size is left unset for the clone to take it from
+	// the source volume, while the inode limit is kept.
+	assert.Equal(t, uint64(0), opts.vol.Size)
+	assert.Equal(t, uint64(0), opts.vol.SoftSize)
+	assert.Equal(t, uint64(1000), opts.vol.INode)
+}
+
+func TestParseCreateOptions_rejectsUnknownOptions(t *testing.T) {
+	_, err := parseCreateOptions(map[string]string{
+		"sise": "10G",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown option 'sise'")
+	assert.Contains(t, err.Error(), "size (")
+}
+
+func TestParseCreateOptions_rejectsMalformedValues(t *testing.T) {
+	var testCases = []map[string]string{
+		{"size": "ten"},
+		{"soft-size": ""},
+		{"inode": "-1"},
+		{"soft-inode": "1.5"},
+		{"uid": "root"},
+		{"gid": "-1"},
+		{"mode": "0999"},
+		{"mode": "01777"},
+		{"labels": "team"},
+		{"labels": "=ci"},
+		{"from": ""},
+		{"adopt": "maybe"},
+	}
+
+	for _, options := range testCases {
+		_, err := parseCreateOptions(options)
+		assert.Error(t, err, "options: %v", options)
+	}
+}
+
+func TestParseResizeOptions_keepsUnspecifiedLimits(t *testing.T) {
+	opts, err := parseResizeOptions(map[string]string{
+		"size":  "20M",
+		"inode": "0",
+		"force": "true",
+	})
+	assert.NoError(t, err)
+	assert.True(t, opts.force)
+	assert.Equal(t, map[string]bool{"size": true, "inode": true}, opts.set)
+	assert.Equal(t, manager.MustFromHumanSize("20M"), opts.vol.Size)
+	assert.Equal(t, uint64(0), opts.vol.INode)
+}
+
+func TestParseResizeOptions_rejectsInvalidOptions(t *testing.T) {
+	var testCases = []map[string]string{
+		nil,
+		{"force": "true"},
+		{"size": "ten"},
+		{"size": "20M", "force": "maybe"},
+		{"size": "20M", "labels": "team=ci"},
+		{"size": "20M", "from": "abc"},
+	}
+
+	for _, options := range testCases {
+		_, err := parseResizeOptions(options)
+		assert.Error(t, err, "options: %v", options)
+	}
+}
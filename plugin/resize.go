@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/docker/go-plugins-helpers/sdk"
+
+	v "github.com/docker/go-plugins-helpers/volume"
+)
+
+// resizePath is the endpoint of the plugin's socket that resizes
+// volumes - docker's volume plugin API has no way of changing a
+// volume after it got created, so it's only reachable by talking
+// to the socket directly.
+const resizePath = "/XfsVol.Resize"
+
+// ResizeRequest is the body of a request to `resizePath`, with
+// the options being the limits accepted on creation (`size`,
+// `soft-size`, `inode` and `soft-inode`) and `force`.
+type ResizeRequest struct {
+	Name    string
+	Options map[string]string
+}
+
+// ResizeResponse is the body of a successful response to a
+// request to `resizePath`, describing the resized volume the
+// same way that `Get` does.
+type ResizeResponse struct {
+	Volume *v.Volume
+}
+
+// handleResize serves `Driver.Resize` on the plugin's socket,
+// answering failures the same way that docker's volume plugin
+// API does (an `Err` field).
+func handleResize(h *v.Handler, d *Driver) {
+	h.HandleFunc(resizePath, func(w http.ResponseWriter, r *http.Request) {
+		req := &ResizeRequest{}
+		err := sdk.DecodeRequest(w, r, req)
+		if err != nil {
+			return
+		}
+
+		res, err := d.Resize(req)
+		if err != nil {
+			sdk.EncodeResponse(w, v.NewErrorResponse(err.Error()), true)
+			return
+		}
+
+		sdk.EncodeResponse(w, res, false)
+	})
+}
@@ -0,0 +1,127 @@
+package xfs
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMinProjectId is the minimum project id handed out
+	// when no `StartingProjectId` is specified.
+	//
+	// Project id 0 is never handed out as it's the one that
+	// every file gets by default (and holds the filesystem
+	// quota defaults).
+	DefaultMinProjectId uint32 = 1
+
+	// DefaultMaxProjectId is the maximum project id handed out
+	// when no `MaxProjectId` is specified.
+	//
+	// (uint32)-1 is kept out of the range as it's commonly used
+	// as an invalid id.
+	DefaultMaxProjectId uint32 = 1<<32 - 2
+)
+
+var (
+	// ErrProjectIdsExhausted indicates that every project id in
+	// the configured range is either in use or taken by other
+	// projects in the filesystem.
+	ErrProjectIdsExhausted = errors.Errorf("no project ids available in the configured range")
+)
+
+// projectIdAllocator hands out project ids from a fixed range
+// ([min, max]) making sure that ids that are already in use
+// (either by us or by other tools sharing the filesystem) are
+// never handed out.
+//
+// It holds no state of its own on disk: it's meant to be filled
+// (via `reserve`) with every project id known by the filesystem -
+// those set on directories and those that have quota records -
+// whenever it's created (see `Control.Refresh`). As a quota record
+// with no limits and no usage vanishes from the filesystem,
+// released ids become available to fresh allocators as well.
+type projectIdAllocator struct {
+	min uint32
+	max uint32
+
+	// next is the lowest id that might be available: every
+	// id in [min, next) is taken.
+	//
+	// It's 64bit wide so that reaching `max` when it's
+	// the biggest uint32 doesn't wrap it around.
+	next uint64
+
+	// taken holds the ids that can't be handed out.
+	taken map[uint32]bool
+}
+
+// newProjectIdAllocator creates an allocator that hands out
+// ids from the range [min, max].
+func newProjectIdAllocator(min, max uint32) (a *projectIdAllocator, err error) {
+	if min == 0 {
+		err = errors.Errorf("minimum project id must be greater than 0")
+		return
+	}
+
+	if min > max {
+		err = errors.Errorf(
+			"minimum project id (%d) can't be greater than maximum (%d)",
+			min, max)
+		return
+	}
+
+	a = &projectIdAllocator{
+		min:   min,
+		max:   max,
+		next:  uint64(min),
+		taken: make(map[uint32]bool),
+	}
+	return
+}
+
+// reserve marks a given project id as taken such that it's
+// not handed out.
+func (a *projectIdAllocator) reserve(projectId uint32) {
+	a.taken[projectId] = true
+}
+
+// isReserved checks whether a given project id is taken.
+func (a *projectIdAllocator) isReserved(projectId uint32) bool {
+	return a.taken[projectId]
+}
+
+// allocate hands out the lowest project id that is available.
+func (a *projectIdAllocator) allocate() (projectId uint32, err error) {
+	for ; a.next <= uint64(a.max); a.next++ {
+		projectId = uint32(a.next)
+		if a.taken[projectId] {
+			continue
+		}
+
+		a.taken[projectId] = true
+		a.next++
+		return
+	}
+
+	err = errors.Wrapf(ErrProjectIdsExhausted,
+		"all project ids in [%d, %d] are in use", a.min, a.max)
+	return
+}
+
+// release makes a project id that has been previously handed
+// out (or reserved) available again.
+//
+// Ids that are out of the allocator range are just forgotten.
+func (a *projectIdAllocator) release(projectId uint32) {
+	if !a.taken[projectId] {
+		return
+	}
+
+	delete(a.taken, projectId)
+	if projectId < a.min || projectId > a.max {
+		return
+	}
+
+	if uint64(projectId) < a.next {
+		a.next = uint64(projectId)
+	}
+}
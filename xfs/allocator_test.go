@@ -0,0 +1,113 @@
+package xfs
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectIdAllocator_failsWithInvalidRange(t *testing.T) {
+	_, err := newProjectIdAllocator(0, 10)
+	assert.Error(t, err)
+
+	_, err = newProjectIdAllocator(10, 5)
+	assert.Error(t, err)
+}
+
+func TestProjectIdAllocator_allocatesWithinRangeSkippingTaken(t *testing.T) {
+	a, err := newProjectIdAllocator(10, 14)
+	assert.NoError(t, err)
+
+	a.reserve(11)
+	a.reserve(13)
+	a.reserve(200)
+
+	var allocated []uint32
+	for i := 0; i < 3; i++ {
+		projectId, err := a.allocate()
+		assert.NoError(t, err)
+		allocated = append(allocated, projectId)
+	}
+
+	assert.Equal(t, []uint32{10, 12, 14}, allocated)
+
+	_, err = a.allocate()
+	assert.Error(t, err)
+	assert.Equal(t, ErrProjectIdsExhausted, errors.Cause(err))
+}
+
+func TestProjectIdAllocator_reusesReleasedIds(t *testing.T) {
+	a, err := newProjectIdAllocator(1, 3)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = a.allocate()
+		assert.NoError(t, err)
+	}
+
+	_, err = a.allocate()
+	assert.Error(t, err)
+
+	a.release(2)
+
+	projectId, err := a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), projectId)
+
+	_, err = a.allocate()
+	assert.Error(t, err)
+}
+
+func TestProjectIdAllocator_handsOutLowestReleasedIdFirst(t *testing.T) {
+	a, err := newProjectIdAllocator(1, 5)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = a.allocate()
+		assert.NoError(t, err)
+	}
+
+	a.release(4)
+	a.release(2)
+
+	projectId, err := a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), projectId)
+
+	projectId, err = a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(4), projectId)
+}
+
+func TestProjectIdAllocator_doesntWrapAround(t *testing.T) {
+	a, err := newProjectIdAllocator(1<<32-2, 1<<32-1)
+	assert.NoError(t, err)
+
+	projectId, err := a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1<<32-2), projectId)
+
+	projectId, err = a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1<<32-1), projectId)
+
+	_, err = a.allocate()
+	assert.Error(t, err)
+}
+
+func TestProjectIdAllocator_ignoresReleaseOfIdsOutOfRange(t *testing.T) {
+	a, err := newProjectIdAllocator(5, 5)
+	assert.NoError(t, err)
+
+	a.reserve(100)
+	a.release(100)
+	a.release(3)
+
+	projectId, err := a.allocate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(5), projectId)
+
+	_, err = a.allocate()
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+// +build linux
+
+package xfs
+
+import (
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// BlockDeviceMode determines how the control finds the block
+// device that quotactl(2) calls are issued against.
+type BlockDeviceMode string
+
+const (
+	// BlockDeviceModeAuto resolves the block device from the
+	// mount of the base path, falling back to creating a
+	// device node (`BlockDeviceModeMknod`) when the block device
+	// is not reachable (e.g., inside the plugin rootfs).
+	BlockDeviceModeAuto BlockDeviceMode = "auto"
+
+	// BlockDeviceModeMountInfo only resolves the block device
+	// from the mount of the base path (`/proc/self/mountinfo`),
+	// leaving no device node under the base path.
+	BlockDeviceModeMountInfo BlockDeviceMode = "mountinfo"
+
+	// BlockDeviceModeMknod creates a device node (with the
+	// device number of the base path) under the base path.
+	BlockDeviceModeMknod BlockDeviceMode = "mknod"
+
+	// BlockDeviceModeLookup resolves the block device from the
+	// mount of the base path, falling back to a device node
+	// that already exists under the base path (e.g., created by
+	// the plugin) as long as it still matches its filesystem.
+	//
+	// Nothing gets created, making it fit for inspecting the
+	// quotas of a base path that other processes manage.
+	BlockDeviceModeLookup BlockDeviceMode = "lookup"
+)
+
+// ParseBlockDeviceMode parses the textual representation of
+// a BlockDeviceMode, with the empty string meaning the default
+// (`BlockDeviceModeAuto`).
+func ParseBlockDeviceMode(mode string) (blockDeviceMode BlockDeviceMode, err error) {
+	switch BlockDeviceMode(mode) {
+	case "":
+		blockDeviceMode = BlockDeviceModeAuto
+	case BlockDeviceModeAuto, BlockDeviceModeMountInfo, BlockDeviceModeMknod, BlockDeviceModeLookup:
+		blockDeviceMode = BlockDeviceMode(mode)
+	default:
+		err = errors.Errorf(
+			"unknown block device mode '%s' - must be one of %s, %s, %s or %s",
+			mode, BlockDeviceModeAuto, BlockDeviceModeMountInfo, BlockDeviceModeMknod,
+			BlockDeviceModeLookup)
+	}
+
+	return
+}
+
+// resolveBlockDevice finds (or creates) the block device to
+// issue quotactl calls against according to the configured mode.
+func (c *Control) resolveBlockDevice() (blockDevice string, err error) {
+	if c.blockDeviceMode != BlockDeviceModeMknod {
+		blockDevice, err = ResolveBlockDevice(c.basePath)
+		if err == nil {
+			return
+		}
+
+		if c.blockDeviceMode == BlockDeviceModeMountInfo ||
+			!errors.Is(err, ErrBlockDeviceUnreachable) {
+			err = errors.Wrapf(err,
+				"failed to resolve block device of base path %s",
+				c.basePath)
+			return
+		}
+
+		c.logger.Debug().
+			Err(err).
+			Str("base-path", c.basePath).
+			Msg("block device unreachable - falling back to device node")
+	}
+
+	blockDevice = filepath.Join(c.basePath, blockDeviceName)
+
+	// another process managing the same base path (e.g., the
+	// plugin) might have created it already.
+	if c.isBlockDeviceFresh(blockDevice) {
+		return
+	}
+
+	if c.blockDeviceMode == BlockDeviceModeLookup {
+		err = errors.Wrapf(ErrBlockDeviceUnreachable,
+			"block device of base path %s is not reachable and there's no device node for it at %s",
+			c.basePath, blockDevice)
+		return
+	}
+
+	err = MakeBackingFsDev(c.basePath, blockDeviceName)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to create backingfs dev for base path %s",
+			c.basePath)
+		return
+	}
+
+	return
+}
+
+// blockDevice retrieves the block device that quotactl calls
+// must be issued against, making sure that it still corresponds
+// to the filesystem of the base path.
+//
+// The filesystem might have been remounted (possibly with a
+// new device number) since the device was resolved, in which
+// case it gets resolved again.
+func (c *Control) blockDevice() (blockDevice string, err error) {
+	c.mu.RLock()
+	blockDevice = c.backingFsBlockDev
+	c.mu.RUnlock()
+
+	if c.isBlockDeviceFresh(blockDevice) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.backingFsBlockDev != blockDevice {
+		blockDevice = c.backingFsBlockDev
+		return
+	}
+
+	c.logger.Info().
+		Str("base-path", c.basePath).
+		Str("block-device", blockDevice).
+		Msg("block device doesn't match base path anymore - resolving it again")
+
+	staleBlockDevice := blockDevice
+
+	blockDevice, err = c.resolveBlockDevice()
+	if err != nil {
+		err = errors.Wrapf(ErrInvalidBlockDevice,
+			"block device %s doesn't match base path %s and couldn't be resolved again (%s)",
+			staleBlockDevice, c.basePath, err)
+		return
+	}
+
+	c.backingFsBlockDev = blockDevice
+	return
+}
+
+// isBlockDeviceFresh checks whether a block device has the
+// same device number as the filesystem of the base path.
+func (c *Control) isBlockDeviceFresh(blockDevice string) bool {
+	var basePathStat, blockDeviceStat syscall.Stat_t
+
+	if blockDevice == "" {
+		return false
+	}
+
+	err := syscall.Stat(c.basePath, &basePathStat)
+	if err != nil {
+		return false
+	}
+
+	err = syscall.Stat(blockDevice, &blockDeviceStat)
+	if err != nil {
+		return false
+	}
+
+	return blockDeviceStat.Mode&syscall.S_IFMT == syscall.S_IFBLK &&
+		uint64(blockDeviceStat.Rdev) == uint64(basePathStat.Dev)
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -15,19 +16,46 @@ import (
 
 // blockDeviceName corresponds to the name of the
 // special file that is meant to be used by xfs to
-// keep track of the project quotas.
+// keep track of the project quotas when the actual
+// block device is not reachable.
 const blockDeviceName = "__control-device"
 
 // Control gives the context to be used by storage driver
 // who wants to apply project quotas to container dirs.
+//
+// It's safe for concurrent use.
 type Control struct {
 	logger zerolog.Logger
 
+	// mu guards the projectIdCache, the allocator and
+	// the backingFsBlockDev.
+	mu sync.RWMutex
+
+	// basePath is the root of the project quota tree.
+	basePath string
+
+	// fsType is the type of the filesystem that holds
+	// basePath, which determines how quotas are managed.
+	fsType FsType
+
+	// quotas holds the project quota operations that
+	// apply to the filesystem of basePath.
+	quotas projectQuotas
+
+	// minProjectId and maxProjectId delimit the range of
+	// project ids that can be handed out.
+	minProjectId uint32
+	maxProjectId uint32
+
 	// backingFsBlockDev is the absolute path to the
 	// block device that keeps track of quotas under
 	// a given basePath (root of the project quota tree).
 	backingFsBlockDev string
 
+	// blockDeviceMode determines how backingFsBlockDev
+	// is found.
+	blockDeviceMode BlockDeviceMode
+
 	// projectIdCache keeps track of the relation between
 	// directories and project-ids.
 	//
@@ -36,12 +64,14 @@ type Control struct {
 	// `projectId` of a given directory.
 	projectIdCache map[string]uint32
 
-	// lastProjectId keeps track of the last projectId
-	// that has beem used. The purpose of it is to not
-	// have a conflict with existing projectIds while at
-	// the same time also have not to iterate over the
-	// projectIdCache map.
-	lastProjectId uint32
+	// allocator hands out project ids to directories
+	// that don't have one yet, keeping track of those
+	// that are already taken in the filesystem.
+	allocator *projectIdAllocator
+
+	// projectFiles keeps the xfs_quota(8) project files
+	// naming the projects under basePath (if configured).
+	projectFiles projectFiles
 }
 
 // ControlConfig specifies the configuration to be used by
@@ -49,130 +79,412 @@ type Control struct {
 type ControlConfig struct {
 	// StartingProjectId specifies the minimum projectid that
 	// should be used in the projectid allocation.
+	//
+	// Defaults to `DefaultMinProjectId`.
 	StartingProjectId *uint32
 
+	// MaxProjectId specifies the maximum projectid that
+	// should be used in the projectid allocation.
+	//
+	// Together with `StartingProjectId` it allows multiple
+	// tools sharing the same filesystem to each make use of
+	// their own band of project ids.
+	//
+	// Defaults to `DefaultMaxProjectId`.
+	MaxProjectId *uint32
+
 	// BasePath is the base in which all the directories
 	// which quotas are applied get created from.
 	//
 	// Right in `BasePath` is also where a block device
-	// is put to keep track of the quotas.
+	// is put to keep track of the quotas in case the one
+	// that backs the filesystem is not reachable.
 	BasePath string
+
+	// BlockDeviceMode determines how the block device to
+	// issue quotactl calls against is found.
+	//
+	// Defaults to `BlockDeviceModeAuto`.
+	BlockDeviceMode BlockDeviceMode
+
+	// PreflightMode determines whether failing to verify that
+	// the filesystem holding BasePath is fit for enforcing
+	// project quotas (see `Preflight`) makes the control
+	// creation fail or just logs a warning.
+	//
+	// Defaults to `PreflightModeFail`.
+	PreflightMode PreflightMode
+
+	// ProjectsFile and ProjIdFile are the paths of the files
+	// in the format of `/etc/projects` (`id:path`) and
+	// `/etc/projid` (`name:id`) to record the projects of the
+	// directories under BasePath in, such that xfs_quota(8)
+	// reports show directory names instead of numeric ids.
+	//
+	// Entries are added when a directory gets a project id and
+	// removed when its quota is removed. Entries that don't
+	// belong to BasePath are left untouched.
+	//
+	// Empty paths (the default) disable the files.
+	ProjectsFile string
+	ProjIdFile   string
 }
 
 // NewControl initializes project quota support under a given
 // preconfigured BasePath.
 //
-// It does so by creating a block device right at BasePath
-// and then having XFS manage quotas under this path by assigning
-// project ids to each directory and binding such project ids
-// with quotas.
-func NewControl(cfg ControlConfig) (c Control, err error) {
+// It does so by finding the block device that backs the
+// filesystem of BasePath (or creating a device node right at
+// BasePath) and then having XFS manage quotas under this path
+// by assigning project ids to each directory and binding such
+// project ids with quotas.
+//
+// The filesystem holding BasePath can either be XFS or ext4 (with
+// the `project` and `quota` features), in which case the generic
+// quotactl interface is used.
+func NewControl(cfg ControlConfig) (c *Control, err error) {
 	if cfg.BasePath == "" {
 		err = errors.Errorf("BasePath must be provided")
 		return
 	}
 
+	// paths under the base path are matched against it (e.g.,
+	// `filepath.Dir(targetPath)`), which yields clean paths.
+	var basePath = filepath.Clean(cfg.BasePath)
+
+	fsType, err := GetFsType(basePath)
+	if err != nil {
+		return
+	}
+
+	blockDeviceMode, err := ParseBlockDeviceMode(string(cfg.BlockDeviceMode))
+	if err != nil {
+		return
+	}
+
+	preflightMode, err := ParsePreflightMode(string(cfg.PreflightMode))
+	if err != nil {
+		return
+	}
+
+	c = &Control{
+		basePath:        basePath,
+		fsType:          fsType,
+		quotas:          projectQuotasByFsType[fsType],
+		blockDeviceMode: blockDeviceMode,
+		minProjectId:    DefaultMinProjectId,
+		maxProjectId:    DefaultMaxProjectId,
+		projectFiles: projectFiles{
+			basePath:     basePath,
+			projectsPath: cfg.ProjectsFile,
+			projIdPath:   cfg.ProjIdFile,
+		},
+	}
+
 	if cfg.StartingProjectId != nil {
-		c.lastProjectId = *cfg.StartingProjectId
+		c.minProjectId = *cfg.StartingProjectId
+	}
+
+	if cfg.MaxProjectId != nil {
+		c.maxProjectId = *cfg.MaxProjectId
 	}
 
-	err = MakeBackingFsDev(cfg.BasePath, blockDeviceName)
+	_, err = newProjectIdAllocator(c.minProjectId, c.maxProjectId)
 	if err != nil {
 		err = errors.Wrapf(err,
-			"failed to create backingfs dev for base path %s",
-			cfg.BasePath)
+			"invalid project id range")
 		return
 	}
 
-	c.backingFsBlockDev = filepath.Join(cfg.BasePath, blockDeviceName)
 	c.logger = zerolog.New(os.Stdout).With().
 		Str("from", "control").
 		Logger()
 
-	c.projectIdCache, err = GeneratePathToProjectIdMap(cfg.BasePath)
+	c.backingFsBlockDev, err = c.resolveBlockDevice()
+	if err != nil {
+		return
+	}
+
+	if preflightMode != PreflightModeSkip {
+		err = Preflight(basePath, c.backingFsBlockDev)
+		if err != nil {
+			if preflightMode == PreflightModeFail {
+				return
+			}
+
+			c.logger.Warn().
+				Err(err).
+				Str("base-path", basePath).
+				Msg("filesystem not fit for enforcing project quotas - proceeding anyway")
+			err = nil
+		}
+	}
+
+	err = c.Refresh()
+	if err != nil {
+		return
+	}
+
+	c.logger.Debug().
+		Str("base-path", basePath).
+		Str("fs-type", string(c.fsType)).
+		Str("block-device", c.backingFsBlockDev).
+		Uint32("min-project-id", c.minProjectId).
+		Uint32("max-project-id", c.maxProjectId).
+		Msg("new control created")
+
+	return
+}
+
+// Refresh rebuilds the in-memory state of the control (the
+// projectId cache and the allocator) from the filesystem.
+//
+// This is meant to be used when other processes might have
+// assigned project ids under the same filesystem since the
+// control was created (e.g., right after acquiring a lock
+// shared between those processes).
+func (c *Control) Refresh() (err error) {
+	allocator, err := newProjectIdAllocator(c.minProjectId, c.maxProjectId)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"invalid project id range")
+		return
+	}
+
+	projectIdCache, err := GeneratePathToProjectIdMap(c.basePath)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to create projectid cache from basepath %s",
-			cfg.BasePath)
+			c.basePath)
 		return
 	}
 
-	for _, projectId := range c.projectIdCache {
-		if projectId > c.lastProjectId {
-			c.lastProjectId = projectId
+	for _, projectId := range projectIdCache {
+		allocator.reserve(projectId)
+	}
+
+	// Projects that have quota records but no directory under
+	// BasePath are either leftovers or belong to other tools
+	// sharing the filesystem - in both cases their ids must
+	// not be handed out.
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	quotas, err := c.quotas.list(blockDevice)
+	if err != nil {
+		c.logger.Warn().
+			Err(err).
+			Str("base-path", c.basePath).
+			Msg("couldn't enumerate project quotas - foreign project ids won't be detected")
+		err = nil
+	}
+
+	for _, quota := range quotas {
+		if !allocator.isReserved(quota.ProjectId) {
+			c.logger.Debug().
+				Uint32("project-id", quota.ProjectId).
+				Msg("project id taken by project outside base path")
 		}
+
+		allocator.reserve(quota.ProjectId)
 	}
 
+	c.mu.Lock()
+	c.projectIdCache = projectIdCache
+	c.allocator = allocator
+	c.mu.Unlock()
+
 	c.logger.Debug().
-		Str("base-path", cfg.BasePath).
-		Uint32("last-project-id", c.lastProjectId).
-		Msg("new control created")
+		Int("projects", len(projectIdCache)).
+		Int("quotas", len(quotas)).
+		Msg("refreshed project id state")
 
 	return
 }
 
+// GetFsType retrieves the type of the filesystem that holds
+// the base path.
+func (c *Control) GetFsType() (fsType FsType) {
+	fsType = c.fsType
+	return
+}
+
+// GetSizeGranularity retrieves the unit (in bytes) in which the
+// filesystem stores size limits - requested ones get rounded
+// down to a multiple of it.
+func (c *Control) GetSizeGranularity() (granularity uint64) {
+	granularity = c.quotas.sizeGranularity
+	return
+}
+
 // GetBackingFsBlockDev retrieves the absolute path of the backing
 // block device configured for the current quota control instance.
 func (c *Control) GetBackingFsBlockDev() (blockDev string) {
+	c.mu.RLock()
 	blockDev = c.backingFsBlockDev
+	c.mu.RUnlock()
 	return
 }
 
 // GetQuota retrieves the quota settings associated with a targetPath
 // that previously had a quota set for it.
 //
-// TODO differentiate between real errors and no quota being set
-//	for the path.
+// Paths that have no project id get an error matching `ErrNoProjectId`
+// while those whose project has no limits set get one matching
+// `ErrNoQuota`.
 func (c *Control) GetQuota(targetPath string) (q *Quota, err error) {
-	projectId, ok := c.projectIdCache[targetPath]
+	projectId, ok := c.GetProjectId(targetPath)
 	if !ok {
-		err = errors.Errorf(
-			"no projectId associated with the path %s",
+		err = errors.Wrapf(ErrNoProjectId,
+			"couldn't retrieve quota of path %s",
 			targetPath)
 		return
 	}
 
-	q, err = GetProjectQuota(c.backingFsBlockDev, projectId)
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	q, err = c.quotas.get(blockDevice, projectId)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to retrieve quota")
 		return
 	}
 
+	if q.Size == 0 && q.SoftSize == 0 && q.INode == 0 && q.SoftINode == 0 {
+		q = nil
+		err = errors.Wrapf(ErrNoQuota,
+			"project %d of path %s",
+			projectId, targetPath)
+		return
+	}
+
 	return
 }
 
-// SetQuota assigns a unique project id to a directory and then set the
-// quota for that projectId.
-func (c *Control) SetQuota(targetPath string, quota Quota) (err error) {
-	c.logger.Debug().Interface("cache", c.projectIdCache).Msg("will set quota")
+// GetProjectId retrieves the project id associated with a
+// targetPath that previously had a quota set for it.
+//
+// Directories right under the base path are looked up in the
+// filesystem first (falling back to the cache if that fails) such
+// that changes made by other processes (e.g., a directory that got
+// removed and created again with another project id) are seen.
+func (c *Control) GetProjectId(targetPath string) (projectId uint32, found bool) {
+	if filepath.Dir(targetPath) != c.basePath {
+		c.mu.RLock()
+		projectId, found = c.projectIdCache[targetPath]
+		c.mu.RUnlock()
+		return
+	}
 
-	projectId, ok := c.projectIdCache[targetPath]
-	if !ok {
-		projectId = c.lastProjectId + 1
-		err = SetProjectId(targetPath, projectId)
-		if err != nil {
-			err = errors.Wrapf(err,
-				"couldn't set project id to path %s",
-				targetPath)
-			return
-		}
+	current, err := GetProjectId(targetPath)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		projectId, found = c.projectIdCache[targetPath]
+		return
+	}
+
+	if current == 0 {
+		delete(c.projectIdCache, targetPath)
+		return
+	}
+
+	c.projectIdCache[targetPath] = current
+	c.allocator.reserve(current)
+	projectId, found = current, true
+	return
+}
+
+// ListProjectQuotas retrieves the quotas of every project
+// known by the controlled filesystem, including those that
+// don't have a directory under the base path.
+func (c *Control) ListProjectQuotas() (quotas []ProjectQuota, err error) {
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	quotas, err = c.quotas.list(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to list project quotas")
+		return
+	}
+
+	return
+}
 
-		c.projectIdCache[targetPath] = projectId
-		c.lastProjectId = projectId
+// GetGracePeriods retrieves the grace periods that apply to
+// the soft limits of every project under the controlled filesystem.
+func (c *Control) GetGracePeriods() (g *GracePeriods, err error) {
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	g, err = c.quotas.getGracePeriods(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to retrieve grace periods")
+		return
+	}
+
+	return
+}
+
+// SetGracePeriods sets the grace periods that apply to the soft
+// limits of every project under the controlled filesystem.
+func (c *Control) SetGracePeriods(g GracePeriods) (err error) {
+	c.logger.Debug().
+		Dur("size-period", g.Size).
+		Dur("inode-period", g.INode).
+		Msg("setting grace periods")
+
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	err = c.quotas.setGracePeriods(blockDevice, &g)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't set grace periods %+v", g)
+		return
+	}
+
+	return
+}
 
-		c.logger.Debug().Uint32("project-id", projectId).Msg("setting new project id")
+// SetQuota assigns a unique project id to a directory and then set the
+// quota for that projectId.
+func (c *Control) SetQuota(targetPath string, quota Quota) (err error) {
+	projectId, err := c.AssignProjectId(targetPath)
+	if err != nil {
+		return
 	}
 
 	c.logger.Debug().
 		Uint32("project-id", projectId).
-		Uint32("last-project-id", c.lastProjectId).
 		Str("target-path", targetPath).
 		Uint64("quota-size", quota.Size).
+		Uint64("quota-soft-size", quota.SoftSize).
 		Uint64("quota-inode", quota.INode).
+		Uint64("quota-soft-inode", quota.SoftINode).
 		Msg("setting quota")
 
-	err = SetProjectQuota(c.backingFsBlockDev, projectId, &quota)
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	err = c.quotas.set(blockDevice, projectId, &quota)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Couldn't set project quota %+v for target-path %s",
@@ -183,6 +495,146 @@ func (c *Control) SetQuota(targetPath string, quota Quota) (err error) {
 	return
 }
 
+// AssignProjectId retrieves the project id associated with
+// a targetPath, assigning a fresh one to it in case it has none.
+func (c *Control) AssignProjectId(targetPath string) (projectId uint32, err error) {
+	projectId, ok := c.GetProjectId(targetPath)
+	if ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	projectId, ok = c.projectIdCache[targetPath]
+	if ok {
+		return
+	}
+
+	projectId, err = c.allocator.allocate()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't allocate project id for path %s",
+			targetPath)
+		return
+	}
+
+	err = SetProjectId(targetPath, projectId)
+	if err != nil {
+		c.allocator.release(projectId)
+		err = errors.Wrapf(err,
+			"couldn't set project id to path %s",
+			targetPath)
+		return
+	}
+
+	c.projectIdCache[targetPath] = projectId
+
+	c.logger.Debug().Uint32("project-id", projectId).Msg("setting new project id")
+
+	c.writeProjectFiles(c.projectIdCache)
+	return
+}
+
+// RemoveQuota releases the quota associated with a targetPath
+// that previously had a quota set for it.
+//
+// The limits of the project are reset (so that the filesystem
+// doesn't keep a record for it once its usage drops to zero) and
+// the project id is made available for reuse by other directories.
+//
+// The directory itself is not touched, thus, callers are expected
+// to remove its contents first, otherwise its files would be
+// accounted to the next directory that reuses the project id.
+func (c *Control) RemoveQuota(targetPath string) (err error) {
+	projectId, ok := c.GetProjectId(targetPath)
+	if !ok {
+		err = errors.Wrapf(ErrNoProjectId,
+			"couldn't remove quota of path %s",
+			targetPath)
+		return
+	}
+
+	c.logger.Debug().
+		Uint32("project-id", projectId).
+		Str("target-path", targetPath).
+		Msg("removing quota")
+
+	blockDevice, err := c.blockDevice()
+	if err != nil {
+		return
+	}
+
+	err = c.quotas.set(blockDevice, projectId, &Quota{})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't reset project quota for target-path %s",
+			targetPath)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.projectIdCache[targetPath] != projectId {
+		return
+	}
+
+	delete(c.projectIdCache, targetPath)
+	c.allocator.release(projectId)
+
+	c.writeProjectFiles(c.projectIdCache, projectId)
+	return
+}
+
+// WriteProjectFiles regenerates the entries of the configured
+// project files (see `ControlConfig.ProjectsFile`) from the
+// directories under the base path that have a project id.
+func (c *Control) WriteProjectFiles() (err error) {
+	if !c.projectFiles.enabled() {
+		err = errors.Errorf("no project files configured")
+		return
+	}
+
+	err = c.Refresh()
+	if err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	err = c.projectFiles.write(c.projectIdCache)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't write project files of base path %s",
+			c.basePath)
+		return
+	}
+
+	return
+}
+
+// writeProjectFiles updates the project files (if configured)
+// to match a given mapping of paths to project ids, with the ids
+// of projects just released passed in `released`.
+//
+// Failing to update the files doesn't fail the operation that
+// changed the projects (they're a convenience for xfs_quota(8)
+// reports) - it's logged instead, with `WriteProjectFiles` being
+// able to regenerate them later.
+//
+// Callers are expected to hold the control lock.
+func (c *Control) writeProjectFiles(projects map[string]uint32, released ...uint32) {
+	err := c.projectFiles.write(projects, released...)
+	if err != nil {
+		c.logger.Warn().
+			Err(err).
+			Str("base-path", c.basePath).
+			Msg("couldn't update project files")
+	}
+}
+
 // GeneratePathToProjectIdMap creates a map that maps the
 // projectIds associated with paths directly under a giving
 // root path.
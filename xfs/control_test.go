@@ -1,12 +1,15 @@
 package xfs_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 	"testing"
 
 	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
 	utils "github.com/cirocosta/xfsvol/test_utils"
@@ -165,3 +168,252 @@ func TestControl_flatlyEnforcesINodeQuota(t *testing.T) {
 	assert.Error(t, utils.CreateFiles(dirA, 100))
 	assert.NoError(t, utils.CreateFiles(dirB, 100))
 }
+
+func TestControl_removeQuotaResetsLimitsAndReleasesProjectId(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dirA := path.Join(dir, "A")
+	dirB := path.Join(dir, "B")
+
+	assert.NoError(t, os.MkdirAll(dirA, 0755))
+	assert.NoError(t, os.MkdirAll(dirB, 0755))
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ctl.SetQuota(dirA, xfs.Quota{
+		Size: 2 * (1 << 20),
+	}))
+
+	projectIdA, found := ctl.GetProjectId(dirA)
+	assert.True(t, found)
+
+	assert.NoError(t, os.RemoveAll(dirA))
+	assert.NoError(t, ctl.RemoveQuota(dirA))
+
+	_, found = ctl.GetProjectId(dirA)
+	assert.False(t, found)
+
+	quota, err := xfs.GetProjectQuota(ctl.GetBackingFsBlockDev(), projectIdA)
+	if err == nil {
+		assert.Zero(t, quota.Size)
+	}
+
+	assert.NoError(t, ctl.SetQuota(dirB, xfs.Quota{
+		Size: 2 * (1 << 20),
+	}))
+
+	projectIdB, found := ctl.GetProjectId(dirB)
+	assert.True(t, found)
+	assert.Equal(t, projectIdA, projectIdB)
+}
+
+func TestControl_removeQuotaFailsForUnknownPath(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	assert.Error(t, ctl.RemoveQuota(path.Join(dir, "inexistent")))
+}
+
+func TestControl_findsProjectIdsWithTrailingSlashInBasePath(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir + "/",
+	})
+	assert.NoError(t, err)
+
+	// assigned behind the control's back such that it can only
+	// be found by looking at the directory.
+	dirA := path.Join(dir, "A")
+	assert.NoError(t, os.MkdirAll(dirA, 0755))
+	assert.NoError(t, xfs.SetProjectId(dirA, 4242))
+
+	projectId, found := ctl.GetProjectId(dirA)
+	assert.True(t, found)
+	assert.Equal(t, uint32(4242), projectId)
+}
+
+func TestControl_allocatesProjectIdsWithinConfiguredRange(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		minProjectId uint32 = 5000
+		maxProjectId uint32 = 5001
+		dirs                = []string{
+			path.Join(dir, "A"),
+			path.Join(dir, "B"),
+			path.Join(dir, "C"),
+		}
+	)
+
+	for _, d := range dirs {
+		assert.NoError(t, os.MkdirAll(d, 0755))
+	}
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:          dir,
+		StartingProjectId: &minProjectId,
+		MaxProjectId:      &maxProjectId,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ctl.SetQuota(dirs[0], xfs.Quota{Size: 1 << 20}))
+	assert.NoError(t, ctl.SetQuota(dirs[1], xfs.Quota{Size: 1 << 20}))
+
+	err = ctl.SetQuota(dirs[2], xfs.Quota{Size: 1 << 20})
+	assert.Error(t, err)
+	assert.Equal(t, xfs.ErrProjectIdsExhausted, errors.Cause(err))
+
+	for _, d := range dirs[:2] {
+		projectId, found := ctl.GetProjectId(d)
+		assert.True(t, found)
+		assert.True(t, projectId >= minProjectId && projectId <= maxProjectId)
+	}
+}
+
+func TestControl_skipsProjectIdsTakenOutsideBasePath(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		foreignProjectId uint32 = 6000
+		dirInside               = path.Join(dir, "abc")
+	)
+
+	assert.NoError(t, os.MkdirAll(dirInside, 0755))
+	assert.NoError(t, xfs.MakeBackingFsDev(dir, "foreign-device"))
+
+	foreignDevice := path.Join(dir, "foreign-device")
+	assert.NoError(t, xfs.SetProjectQuota(foreignDevice, foreignProjectId, &xfs.Quota{
+		Size: 1 << 20,
+	}))
+	defer xfs.SetProjectQuota(foreignDevice, foreignProjectId, &xfs.Quota{})
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:          dir,
+		StartingProjectId: &foreignProjectId,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ctl.SetQuota(dirInside, xfs.Quota{Size: 1 << 20}))
+
+	projectId, found := ctl.GetProjectId(dirInside)
+	assert.True(t, found)
+	assert.NotEqual(t, foreignProjectId, projectId)
+}
+
+func TestControl_concurrentlyAssignsUniqueProjectIds(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	var (
+		wg   sync.WaitGroup
+		dirs = make([]string, 20)
+	)
+
+	for ndx := range dirs {
+		dirs[ndx] = path.Join(dir, fmt.Sprintf("dir-%d", ndx))
+		assert.NoError(t, os.MkdirAll(dirs[ndx], 0755))
+	}
+
+	for _, d := range dirs {
+		wg.Add(1)
+		go func(d string) {
+			defer wg.Done()
+			assert.NoError(t, ctl.SetQuota(d, xfs.Quota{Size: 1 << 20}))
+		}(d)
+	}
+
+	wg.Wait()
+
+	seen := make(map[uint32]bool)
+	for _, d := range dirs {
+		projectId, found := ctl.GetProjectId(d)
+		assert.True(t, found)
+		assert.False(t, seen[projectId])
+		seen[projectId] = true
+	}
+}
+
+func TestControl_refreshPicksUpProjectIdsAssignedByOthers(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dirA := path.Join(dir, "A")
+	dirB := path.Join(dir, "B")
+
+	assert.NoError(t, os.MkdirAll(dirA, 0755))
+	assert.NoError(t, os.MkdirAll(dirB, 0755))
+
+	ctl1, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	ctl2, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ctl1.SetQuota(dirA, xfs.Quota{Size: 1 << 20}))
+
+	quota, err := ctl2.GetQuota(dirA)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<20), quota.Size)
+
+	assert.NoError(t, ctl2.Refresh())
+	assert.NoError(t, ctl2.SetQuota(dirB, xfs.Quota{Size: 2 << 20}))
+
+	projectIdA, found := ctl1.GetProjectId(dirA)
+	assert.True(t, found)
+
+	projectIdB, found := ctl2.GetProjectId(dirB)
+	assert.True(t, found)
+	assert.NotEqual(t, projectIdA, projectIdB)
+}
+
+func TestControl_getQuotaDistinguishesMissingProjectsFromMissingLimits(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+
+	var volume = path.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(volume, 0755))
+
+	_, err = ctl.GetQuota(volume)
+	assert.True(t, errors.Is(err, xfs.ErrNoProjectId))
+
+	_, err = ctl.AssignProjectId(volume)
+	assert.NoError(t, err)
+
+	_, err = ctl.GetQuota(volume)
+	assert.True(t, errors.Is(err, xfs.ErrNoQuota))
+}
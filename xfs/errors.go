@@ -0,0 +1,103 @@
+package xfs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoProjectId indicates that a path has no project id
+	// associated with it (i.e., it never had a quota set).
+	ErrNoProjectId = errors.Errorf("path has no project id")
+
+	// ErrNoQuota indicates that a project exists (e.g., a
+	// directory has its id) but has no quota limits set.
+	ErrNoQuota = errors.Errorf("project has no quota limits")
+
+	// ErrQuotaNotEnabled indicates that the filesystem doesn't
+	// have project quotas turned on (ESRCH).
+	ErrQuotaNotEnabled = errors.Errorf("project quotas not enabled")
+
+	// ErrInvalidBlockDevice indicates that the block device that
+	// quota commands are issued against doesn't exist, is not a
+	// block device or doesn't back the filesystem anymore.
+	ErrInvalidBlockDevice = errors.Errorf("invalid or stale block device")
+
+	// ErrPermissionDenied indicates that the process lacks the
+	// privileges (CAP_SYS_ADMIN) to manage quotas.
+	ErrPermissionDenied error = syscall.EPERM
+
+	// ErrQuotaExceeded indicates that an operation would go
+	// beyond the limits of a project.
+	ErrQuotaExceeded error = syscall.EDQUOT
+)
+
+// QuotaError describes the failure of a quota command issued
+// against a block device.
+//
+// Besides unwrapping to the `syscall.Errno` returned by the
+// kernel, it matches (via `errors.Is`) the error that describes
+// the condition that made the command fail:
+//
+//   - ESRCH: `ErrQuotaNotEnabled`;
+//   - ENOENT: `ErrNoQuota` when the block device exists, and
+//     `ErrInvalidBlockDevice` otherwise;
+//   - ENOTBLK and ENODEV: `ErrInvalidBlockDevice`.
+type QuotaError struct {
+	BlockDevice string
+	ProjectId   uint32
+	Errno       syscall.Errno
+
+	// kind is the error describing the condition that
+	// made the command fail (if known).
+	kind error
+}
+
+// newQuotaError builds a QuotaError out of an error returned
+// by a quota command, leaving errors other than `syscall.Errno`
+// untouched.
+func newQuotaError(err error, blockDevice string, projectId uint32) error {
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return err
+	}
+
+	quotaErr := &QuotaError{
+		BlockDevice: blockDevice,
+		ProjectId:   projectId,
+		Errno:       errno,
+	}
+
+	switch errno {
+	case syscall.ESRCH:
+		quotaErr.kind = ErrQuotaNotEnabled
+	case syscall.ENOTBLK, syscall.ENODEV:
+		quotaErr.kind = ErrInvalidBlockDevice
+	case syscall.ENOENT:
+		quotaErr.kind = ErrNoQuota
+
+		_, statErr := os.Stat(blockDevice)
+		if statErr != nil {
+			quotaErr.kind = ErrInvalidBlockDevice
+		}
+	}
+
+	return quotaErr
+}
+
+func (e *QuotaError) Error() string {
+	return e.Errno.Error()
+}
+
+// Unwrap retrieves the errno returned by the kernel.
+func (e *QuotaError) Unwrap() error {
+	return e.Errno
+}
+
+// Is reports whether the error describes the condition
+// represented by `target` (see `QuotaError`).
+func (e *QuotaError) Is(target error) bool {
+	return e.kind != nil && e.kind == target
+}
@@ -0,0 +1,63 @@
+package xfs
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQuotaError_classifiesErrnos(t *testing.T) {
+	file, err := ioutil.TempFile("", "")
+	assert.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	var testCases = []struct {
+		desc        string
+		errno       syscall.Errno
+		blockDevice string
+		expected    error
+	}{
+		{"esrch", syscall.ESRCH, file.Name(), ErrQuotaNotEnabled},
+		{"eperm", syscall.EPERM, file.Name(), ErrPermissionDenied},
+		{"edquot", syscall.EDQUOT, file.Name(), ErrQuotaExceeded},
+		{"enotblk", syscall.ENOTBLK, file.Name(), ErrInvalidBlockDevice},
+		{"enoent with device", syscall.ENOENT, file.Name(), ErrNoQuota},
+		{"enoent without device", syscall.ENOENT, "/inexistent/device", ErrInvalidBlockDevice},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := errors.Wrapf(newQuotaError(tc.errno, tc.blockDevice, 123),
+				"failed to do something")
+
+			assert.True(t, errors.Is(err, tc.expected))
+			assert.True(t, errors.Is(err, tc.errno))
+
+			var quotaErr *QuotaError
+			assert.True(t, errors.As(err, &quotaErr))
+			assert.Equal(t, uint32(123), quotaErr.ProjectId)
+			assert.Equal(t, tc.blockDevice, quotaErr.BlockDevice)
+		})
+	}
+}
+
+func TestNewQuotaError_doesntMatchOtherConditions(t *testing.T) {
+	err := newQuotaError(syscall.ESRCH, "/dev/null", 0)
+	assert.False(t, errors.Is(err, ErrNoQuota))
+	assert.False(t, errors.Is(err, ErrInvalidBlockDevice))
+	assert.False(t, errors.Is(err, syscall.EPERM))
+
+	err = newQuotaError(syscall.EINVAL, "/dev/null", 0)
+	assert.False(t, errors.Is(err, ErrQuotaNotEnabled))
+	assert.True(t, errors.Is(err, syscall.EINVAL))
+}
+
+func TestNewQuotaError_leavesOtherErrorsUntouched(t *testing.T) {
+	var original = errors.Errorf("something")
+	assert.Equal(t, original, newQuotaError(original, "/dev/null", 0))
+}
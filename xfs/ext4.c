@@ -0,0 +1,168 @@
+// +build cgo,!nocgo
+
+#include "./ext4.h"
+
+int
+ext4_set_project_quota(const char*  fs_block_dev,
+                       __u32        project_id,
+                       xfs_quota_t* quota)
+{
+	int             err = 0;
+	struct if_dqblk dqblk = {
+		.dqb_bhardlimit = quota->size / QIF_DQBLKSIZE,
+		.dqb_bsoftlimit = quota->soft_size / QIF_DQBLKSIZE,
+		.dqb_ihardlimit = quota->inodes,
+		.dqb_isoftlimit = quota->soft_inodes,
+		.dqb_valid      = QIF_LIMITS,
+	};
+
+	err = quotactl(QCMD(Q_SETQUOTA, PRJQUOTA),
+	               fs_block_dev,
+	               project_id,
+	               (void*)&dqblk);
+	if (err == -1) {
+		return -1;
+	}
+
+	return 0;
+}
+
+/**
+ * Fills a quota configuration from the generic quota
+ * block retrieved from the kernel.
+ */
+static void
+ext4_quota_from_dqblk(xfs_quota_t* quota, struct if_dqblk* dqblk)
+{
+	quota->size         = dqblk->dqb_bhardlimit * QIF_DQBLKSIZE;
+	quota->soft_size    = dqblk->dqb_bsoftlimit * QIF_DQBLKSIZE;
+	quota->inodes       = dqblk->dqb_ihardlimit;
+	quota->soft_inodes  = dqblk->dqb_isoftlimit;
+	quota->used_size    = dqblk->dqb_curspace;
+	quota->used_inodes  = dqblk->dqb_curinodes;
+	quota->size_timer   = dqblk->dqb_btime;
+	quota->inodes_timer = dqblk->dqb_itime;
+}
+
+int
+ext4_get_project_quota(const char*  fs_block_dev,
+                       __u32        project_id,
+                       xfs_quota_t* quota)
+{
+	int             err   = 0;
+	struct if_dqblk dqblk = { 0 };
+
+	err = quotactl(QCMD(Q_GETQUOTA, PRJQUOTA),
+	               fs_block_dev,
+	               project_id,
+	               (void*)&dqblk);
+	if (err == -1) {
+		return -1;
+	}
+
+	ext4_quota_from_dqblk(quota, &dqblk);
+
+	return 0;
+}
+
+int
+ext4_get_next_project_quota(const char*  fs_block_dev,
+                            __u32        project_id,
+                            __u32*       next_project_id,
+                            xfs_quota_t* quota)
+{
+	int                 err       = 0;
+	struct if_nextdqblk nextdqblk = { 0 };
+	struct if_dqblk     dqblk     = { 0 };
+	enum { ERR     = -1,
+	       FOUND   = 0,
+	       NO_MORE = 1,
+	};
+
+	/**
+	 * ENOENT is used by the kernel to indicate that there
+	 * are no more ids, thus, make sure that it can't come
+	 * from an inexistent block device.
+	 */
+	err = access(fs_block_dev, F_OK);
+	if (err == -1) {
+		return ERR;
+	}
+
+	err = quotactl(QCMD(Q_GETNEXTQUOTA, PRJQUOTA),
+	               fs_block_dev,
+	               project_id,
+	               (void*)&nextdqblk);
+	if (err == -1) {
+		if (errno == ENOENT) {
+			errno = 0;
+			return NO_MORE;
+		}
+
+		return ERR;
+	}
+
+	dqblk.dqb_bhardlimit = nextdqblk.dqb_bhardlimit;
+	dqblk.dqb_bsoftlimit = nextdqblk.dqb_bsoftlimit;
+	dqblk.dqb_curspace   = nextdqblk.dqb_curspace;
+	dqblk.dqb_ihardlimit = nextdqblk.dqb_ihardlimit;
+	dqblk.dqb_isoftlimit = nextdqblk.dqb_isoftlimit;
+	dqblk.dqb_curinodes  = nextdqblk.dqb_curinodes;
+	dqblk.dqb_btime      = nextdqblk.dqb_btime;
+	dqblk.dqb_itime      = nextdqblk.dqb_itime;
+
+	*next_project_id = nextdqblk.dqb_id;
+	ext4_quota_from_dqblk(quota, &dqblk);
+
+	return FOUND;
+}
+
+int
+ext4_get_project_grace_periods(const char*          fs_block_dev,
+                               xfs_grace_periods_t* grace_periods)
+{
+	int              err    = 0;
+	struct if_dqinfo dqinfo = { 0 };
+
+	err = quotactl(
+	  QCMD(Q_GETINFO, PRJQUOTA), fs_block_dev, 0, (void*)&dqinfo);
+	if (err == -1) {
+		return -1;
+	}
+
+	grace_periods->size   = dqinfo.dqi_bgrace;
+	grace_periods->inodes = dqinfo.dqi_igrace;
+
+	return 0;
+}
+
+int
+ext4_set_project_grace_periods(const char*          fs_block_dev,
+                               xfs_grace_periods_t* grace_periods)
+{
+	int              err    = 0;
+	struct if_dqinfo dqinfo = {
+		.dqi_bgrace = grace_periods->size,
+		.dqi_igrace = grace_periods->inodes,
+	};
+
+	if (grace_periods->size != 0) {
+		dqinfo.dqi_valid |= IIF_BGRACE;
+	}
+
+	if (grace_periods->inodes != 0) {
+		dqinfo.dqi_valid |= IIF_IGRACE;
+	}
+
+	if (dqinfo.dqi_valid == 0) {
+		return 0;
+	}
+
+	err = quotactl(
+	  QCMD(Q_SETINFO, PRJQUOTA), fs_block_dev, 0, (void*)&dqinfo);
+	if (err == -1) {
+		return -1;
+	}
+
+	return 0;
+}
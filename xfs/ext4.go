@@ -0,0 +1,113 @@
+package xfs
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SetExt4ProjectQuota is the ext4 counterpart of `SetProjectQuota`,
+// setting the limits of a project through the generic quotactl
+// interface (`Q_SETQUOTA`).
+//
+// Size limits are truncated to multiples of 1KiB (the unit of the
+// generic quota api).
+func SetExt4ProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	err = ValidateQuota(q)
+	if err != nil {
+		return
+	}
+
+	err = ops.setExt4ProjectQuota(blockDevice, projectId, q)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, projectId),
+			"failed to set ext4 project quota "+
+				"prj=%d dev=%s quota-size=%d quota-soft-size=%d "+
+				"quota-inodes=%d quota-soft-inodes=%d",
+			projectId, blockDevice, q.Size, q.SoftSize,
+			q.INode, q.SoftINode)
+		return
+	}
+
+	return
+}
+
+// GetExt4ProjectQuota is the ext4 counterpart of `GetProjectQuota`
+// (`Q_GETQUOTA`).
+func GetExt4ProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	q, err = ops.getExt4ProjectQuota(blockDevice, projectId)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, projectId),
+			"failed to retrieve ext4 project quota - prj=%d dev=%s",
+			projectId, blockDevice)
+		return
+	}
+
+	return
+}
+
+// NewExt4ProjectQuotaIterator is the ext4 counterpart of
+// `NewProjectQuotaIterator` (`Q_GETNEXTQUOTA`).
+func NewExt4ProjectQuotaIterator(blockDevice string) (it *ProjectQuotaIterator) {
+	it = newProjectQuotaIterator(blockDevice, ops.getNextExt4ProjectQuota)
+	return
+}
+
+// ListExt4ProjectQuotas is the ext4 counterpart of
+// `ListProjectQuotas`.
+func ListExt4ProjectQuotas(blockDevice string) (quotas []ProjectQuota, err error) {
+	quotas, err = listProjectQuotas(NewExt4ProjectQuotaIterator(blockDevice))
+	return
+}
+
+// GetExt4ProjectGracePeriods is the ext4 counterpart of
+// `GetProjectGracePeriods` (`Q_GETINFO`).
+func GetExt4ProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	g, err = ops.getExt4ProjectGracePeriods(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
+			"failed to retrieve ext4 project grace periods - dev=%s",
+			blockDevice)
+		return
+	}
+
+	return
+}
+
+// SetExt4ProjectGracePeriods is the ext4 counterpart of
+// `SetProjectGracePeriods` (`Q_SETINFO`).
+func SetExt4ProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	err = validateGracePeriods(g)
+	if err != nil {
+		return
+	}
+
+	err = ops.setExt4ProjectGracePeriods(blockDevice, g)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
+			"failed to set ext4 project grace periods "+
+				"dev=%s size-period=%s inode-period=%s",
+			blockDevice, g.Size, g.INode)
+		return
+	}
+
+	return
+}
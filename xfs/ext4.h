@@ -0,0 +1,86 @@
+#ifndef __EXT4_H
+#define __EXT4_H
+
+#include "./xfs.h"
+
+/**
+ * ext4 (with the `project` and `quota` features) shares the
+ * project ids model with XFS (FS_IOC_FSSETXATTR), but its
+ * quotas are managed through the generic quotactl commands
+ * (Q_SETQUOTA, Q_GETQUOTA, ...) that operate on `struct
+ * if_dqblk` rather than on the XFS-specific `fs_disk_quota`.
+ *
+ * The functions below mirror the `xfs_*` ones, taking and
+ * filling the same structures.
+ */
+
+#ifndef Q_GETNEXTQUOTA
+#define Q_GETNEXTQUOTA 0x800009
+#endif
+
+/**
+ * The size of a block as defined by the generic quota api
+ * (`if_dqblk` limits are expressed in such unit).
+ */
+#ifndef QIF_DQBLKSIZE
+#define QIF_DQBLKSIZE 1024
+#endif
+
+/**
+ * Sets the limits of a project.
+ *
+ * Returns -1 in case of errors.
+ */
+int
+ext4_set_project_quota(const char*  fs_block_dev,
+                       __u32        project_id,
+                       xfs_quota_t* quota);
+
+/**
+ * Retrieves the limits and usage of a project.
+ *
+ * Returns -1 in case of errors.
+ */
+int
+ext4_get_project_quota(const char*  fs_block_dev,
+                       __u32        project_id,
+                       xfs_quota_t* quota);
+
+/**
+ * Retrieves the limits and usage of the first project that
+ * has an id greater than or equal to `project_id`.
+ *
+ * Returns:
+ *      - -1 in case of errors;
+ *      - 0 if a project has been found;
+ *      - 1 if there are no more projects.
+ */
+int
+ext4_get_next_project_quota(const char*  fs_block_dev,
+                            __u32        project_id,
+                            __u32*       next_project_id,
+                            xfs_quota_t* quota);
+
+/**
+ * Retrieves the project quota grace periods of the
+ * filesystem (Q_GETINFO).
+ *
+ * Returns -1 in case of errors.
+ */
+int
+ext4_get_project_grace_periods(const char*          fs_block_dev,
+                               xfs_grace_periods_t* grace_periods);
+
+/**
+ * Sets the project quota grace periods of the filesystem
+ * (Q_SETINFO).
+ *
+ * Fields set to 0 are left untouched.
+ *
+ * Returns -1 in case of errors.
+ */
+int
+ext4_set_project_grace_periods(const char*          fs_block_dev,
+                               xfs_grace_periods_t* grace_periods);
+
+#endif
@@ -0,0 +1,162 @@
+package xfs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/stretchr/testify/assert"
+
+	utils "github.com/cirocosta/xfsvol/test_utils"
+)
+
+const (
+	// ext4MountPath corresponds to the mount path of an
+	// ext4 filesystem with the `project` and `quota`
+	// features, mounted with `prjquota`.
+	//
+	// Check `.travis/setup.sh` for some more information on
+	// how to have this properly done.
+	ext4MountPath = "/mnt/ext4"
+)
+
+func TestGetFsType(t *testing.T) {
+	fsType, err := xfs.GetFsType(xfsMountPath)
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.FsTypeXFS, fsType)
+
+	fsType, err = xfs.GetFsType(ext4MountPath)
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.FsTypeExt4, fsType)
+}
+
+func TestGetFsType_failsForFilesystemsWithoutProjectQuotas(t *testing.T) {
+	_, err := xfs.GetFsType("/proc")
+	assert.Error(t, err)
+}
+
+func TestGetFsType_failsIfPathDoesntExist(t *testing.T) {
+	_, err := xfs.GetFsType("/inexistent/path")
+	assert.Error(t, err)
+}
+
+func TestSetExt4ProjectQuota_setsSoftAndHardLimits(t *testing.T) {
+	root, err := setupTestFs(ext4MountPath, []string{"/dir"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		blockDevice        = filepath.Join(root, "block-device")
+		projectId   uint32 = 777
+		expected           = &xfs.Quota{
+			Size:      10 << 20,
+			SoftSize:  8 << 20,
+			INode:     100,
+			SoftINode: 80,
+		}
+	)
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	err = xfs.SetProjectId(filepath.Join(root, "dir"), projectId)
+	assert.NoError(t, err)
+
+	err = xfs.SetExt4ProjectQuota(blockDevice, projectId, expected)
+	assert.NoError(t, err)
+
+	actual, err := xfs.GetExt4ProjectQuota(blockDevice, projectId)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Size, actual.Size)
+	assert.Equal(t, expected.SoftSize, actual.SoftSize)
+	assert.Equal(t, expected.INode, actual.INode)
+	assert.Equal(t, expected.SoftINode, actual.SoftINode)
+
+	quotas, err := xfs.ListExt4ProjectQuotas(blockDevice)
+	assert.NoError(t, err)
+
+	var found bool
+	for _, quota := range quotas {
+		if quota.ProjectId == projectId {
+			found = true
+			assert.Equal(t, expected.Size, quota.Size)
+		}
+	}
+	assert.True(t, found)
+
+	err = xfs.SetExt4ProjectQuota(blockDevice, projectId, &xfs.Quota{})
+	assert.NoError(t, err)
+}
+
+func TestSetExt4ProjectQuota_failsIfSoftLimitAboveHardLimit(t *testing.T) {
+	err := xfs.SetExt4ProjectQuota("/dev/null", 1, &xfs.Quota{
+		Size:     1 << 20,
+		SoftSize: 2 << 20,
+	})
+	assert.Error(t, err)
+}
+
+func TestSetExt4ProjectGracePeriods(t *testing.T) {
+	root, err := setupTestFs(ext4MountPath, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	var blockDevice = filepath.Join(root, "block-device")
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	original, err := xfs.GetExt4ProjectGracePeriods(blockDevice)
+	assert.NoError(t, err)
+	defer xfs.SetExt4ProjectGracePeriods(blockDevice, original)
+
+	err = xfs.SetExt4ProjectGracePeriods(blockDevice, &xfs.GracePeriods{
+		Size: 2 * time.Hour,
+	})
+	assert.NoError(t, err)
+
+	gracePeriods, err := xfs.GetExt4ProjectGracePeriods(blockDevice)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, gracePeriods.Size)
+	assert.Equal(t, original.INode, gracePeriods.INode)
+}
+
+func TestControl_enforcesQuotaOnExt4(t *testing.T) {
+	dir, err := ioutil.TempDir(filepath.Join(ext4MountPath, "tmp"), "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath: dir,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.FsTypeExt4, ctl.GetFsType())
+
+	var volume = filepath.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(volume, 0755))
+
+	err = ctl.SetQuota(volume, xfs.Quota{
+		Size: 1 << 20,
+	})
+	assert.NoError(t, err)
+
+	quota, err := ctl.GetQuota(volume)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<20), quota.Size)
+
+	file, err := os.Create(filepath.Join(volume, "file"))
+	assert.NoError(t, err)
+	defer file.Close()
+
+	err = utils.WriteBytes(file, 'c', 2<<20)
+	if err == nil {
+		err = file.Sync()
+	}
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Remove(filepath.Join(volume, "file")))
+	assert.NoError(t, ctl.RemoveQuota(volume))
+}
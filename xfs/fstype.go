@@ -0,0 +1,89 @@
+// +build linux
+
+package xfs
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FsType identifies a filesystem that supports project quotas.
+type FsType string
+
+const (
+	FsTypeXFS  FsType = "xfs"
+	FsTypeExt4 FsType = "ext4"
+)
+
+const (
+	// xfsSuperMagic and ext4SuperMagic are the `f_type`
+	// values reported by statfs(2) (see linux/magic.h).
+	//
+	// ext2 and ext3 share the magic number with ext4 - as
+	// neither supports project quotas, these end up being
+	// detected as ext4 and then failing once quotas are set.
+	xfsSuperMagic  = 0x58465342
+	ext4SuperMagic = 0xef53
+)
+
+// GetFsType detects the type of the filesystem that holds
+// a given path, failing if it doesn't support project quotas.
+func GetFsType(path string) (fsType FsType, err error) {
+	var statfs syscall.Statfs_t
+
+	err = syscall.Statfs(path, &statfs)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't statfs path %s", path)
+		return
+	}
+
+	switch int64(statfs.Type) {
+	case xfsSuperMagic:
+		fsType = FsTypeXFS
+	case ext4SuperMagic:
+		fsType = FsTypeExt4
+	default:
+		err = errors.Errorf(
+			"filesystem of path %s (type 0x%x) doesn't support project quotas - must be xfs or ext4",
+			path, statfs.Type)
+	}
+
+	return
+}
+
+// projectQuotas groups the project quota operations whose
+// quotactl commands depend on the type of the filesystem.
+type projectQuotas struct {
+	set             func(blockDevice string, projectId uint32, q *Quota) error
+	get             func(blockDevice string, projectId uint32) (*Quota, error)
+	list            func(blockDevice string) ([]ProjectQuota, error)
+	getGracePeriods func(blockDevice string) (*GracePeriods, error)
+	setGracePeriods func(blockDevice string, g *GracePeriods) error
+
+	// sizeGranularity is the unit (in bytes) in which size
+	// limits get stored, with requested ones rounded down.
+	sizeGranularity uint64
+}
+
+// projectQuotasByFsType maps each supported filesystem to
+// the operations that manage its project quotas.
+var projectQuotasByFsType = map[FsType]projectQuotas{
+	FsTypeXFS: {
+		set:             SetProjectQuota,
+		get:             GetProjectQuota,
+		list:            ListProjectQuotas,
+		getGracePeriods: GetProjectGracePeriods,
+		setGracePeriods: SetProjectGracePeriods,
+		sizeGranularity: basicBlockSize,
+	},
+	FsTypeExt4: {
+		set:             SetExt4ProjectQuota,
+		get:             GetExt4ProjectQuota,
+		list:            ListExt4ProjectQuotas,
+		getGracePeriods: GetExt4ProjectGracePeriods,
+		setGracePeriods: SetExt4ProjectGracePeriods,
+		sizeGranularity: qifDqBlkSize,
+	},
+}
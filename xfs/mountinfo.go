@@ -0,0 +1,284 @@
+// +build linux
+
+package xfs
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// mountInfoPath is the path of the file that describes the
+// mounts of the mount namespace of the current process.
+const mountInfoPath = "/proc/self/mountinfo"
+
+// ErrBlockDeviceUnreachable indicates that the block device
+// that backs a filesystem couldn't be found (e.g., because the
+// process runs in a mount namespace - like the plugin rootfs -
+// that doesn't expose it under `/dev`).
+var ErrBlockDeviceUnreachable = errors.Errorf("block device not reachable")
+
+// Mount describes an entry of `/proc/self/mountinfo`.
+type Mount struct {
+	// Id and ParentId are the unique identifiers of the
+	// mount and its parent.
+	Id       int
+	ParentId int
+
+	// Major and Minor form the device number (st_dev) of
+	// the files under the mount.
+	Major uint32
+	Minor uint32
+
+	// Root is the directory of the filesystem that forms
+	// the root of the mount.
+	Root string
+
+	// MountPoint is where the mount is placed.
+	MountPoint string
+
+	// FsType is the type of the filesystem (e.g., xfs).
+	FsType string
+
+	// Source is the filesystem-specific source of the
+	// mount (e.g., /dev/loop0).
+	Source string
+}
+
+// ParseMountInfo parses the contents of a mountinfo file
+// (see proc(5)).
+func ParseMountInfo(r io.Reader) (mounts []Mount, err error) {
+	var scanner = bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		var mount Mount
+
+		mount, err = parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		err = errors.Wrapf(err, "failed to read mountinfo")
+		return
+	}
+
+	return
+}
+
+// parseMountInfoLine parses a single mountinfo line, e.g.:
+//
+//	36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw
+//
+// The optional fields (`master:1`) are terminated by a single
+// hyphen, after which come the filesystem type and the source.
+func parseMountInfoLine(line string) (mount Mount, err error) {
+	var (
+		fields    = strings.Fields(line)
+		separator = -1
+	)
+
+	for ndx := 6; ndx < len(fields); ndx++ {
+		if fields[ndx] == "-" {
+			separator = ndx
+			break
+		}
+	}
+
+	if len(fields) < 6 || separator == -1 || separator+2 >= len(fields) {
+		err = errors.Errorf("malformed mountinfo line '%s'", line)
+		return
+	}
+
+	mount.Id, err = strconv.Atoi(fields[0])
+	if err != nil {
+		err = errors.Wrapf(err, "malformed mount id in line '%s'", line)
+		return
+	}
+
+	mount.ParentId, err = strconv.Atoi(fields[1])
+	if err != nil {
+		err = errors.Wrapf(err, "malformed parent id in line '%s'", line)
+		return
+	}
+
+	majorMinor := strings.SplitN(fields[2], ":", 2)
+	if len(majorMinor) != 2 {
+		err = errors.Errorf("malformed device number in line '%s'", line)
+		return
+	}
+
+	major, err := strconv.ParseUint(majorMinor[0], 10, 32)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed major in line '%s'", line)
+		return
+	}
+
+	minor, err := strconv.ParseUint(majorMinor[1], 10, 32)
+	if err != nil {
+		err = errors.Wrapf(err, "malformed minor in line '%s'", line)
+		return
+	}
+
+	mount.Major = uint32(major)
+	mount.Minor = uint32(minor)
+	mount.Root = unescapeMountInfo(fields[3])
+	mount.MountPoint = unescapeMountInfo(fields[4])
+	mount.FsType = fields[separator+1]
+	mount.Source = unescapeMountInfo(fields[separator+2])
+	return
+}
+
+// unescapeMountInfo decodes the octal escapes (e.g., `\040`
+// for spaces) that the kernel uses in mountinfo paths.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for ndx := 0; ndx < len(s); ndx++ {
+		if s[ndx] == '\\' && ndx+3 < len(s) {
+			code, err := strconv.ParseUint(s[ndx+1:ndx+4], 8, 8)
+			if err == nil {
+				b.WriteByte(byte(code))
+				ndx += 3
+				continue
+			}
+		}
+
+		b.WriteByte(s[ndx])
+	}
+
+	return b.String()
+}
+
+// GetMount finds the mount that holds a given path.
+//
+// The candidates are the mounts whose device number matches the
+// one of the path, out of which the one with the longest mount
+// point that prefixes the path is picked.
+func GetMount(path string) (mount *Mount, err error) {
+	var stat syscall.Stat_t
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't make path %s absolute", path)
+		return
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve path %s", absPath)
+		return
+	}
+
+	err = syscall.Stat(resolvedPath, &stat)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't stat path %s", resolvedPath)
+		return
+	}
+
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open %s", mountInfoPath)
+		return
+	}
+	defer file.Close()
+
+	mounts, err := ParseMountInfo(file)
+	if err != nil {
+		return
+	}
+
+	for ndx := range mounts {
+		var candidate = &mounts[ndx]
+
+		if candidate.Major != devMajor(uint64(stat.Dev)) || candidate.Minor != devMinor(uint64(stat.Dev)) {
+			continue
+		}
+
+		if !isSubPath(candidate.MountPoint, resolvedPath) {
+			continue
+		}
+
+		if mount == nil || len(candidate.MountPoint) > len(mount.MountPoint) {
+			mount = candidate
+		}
+	}
+
+	if mount == nil {
+		err = errors.Errorf(
+			"couldn't find mount of path %s (dev %d:%d) in %s",
+			resolvedPath, devMajor(uint64(stat.Dev)), devMinor(uint64(stat.Dev)), mountInfoPath)
+		return
+	}
+
+	return
+}
+
+// ResolveBlockDevice finds the block device that backs the
+// filesystem holding a given path by looking at the source of
+// its mount.
+//
+// `ErrBlockDeviceUnreachable` is returned (as the cause) when
+// the source is not a block device with the same device number
+// as the path.
+func ResolveBlockDevice(path string) (blockDevice string, err error) {
+	var stat syscall.Stat_t
+
+	mount, err := GetMount(path)
+	if err != nil {
+		return
+	}
+
+	err = syscall.Stat(mount.Source, &stat)
+	if err != nil {
+		err = errors.Wrapf(ErrBlockDeviceUnreachable,
+			"couldn't stat mount source %s of path %s (%s)",
+			mount.Source, path, err)
+		return
+	}
+
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFBLK ||
+		devMajor(uint64(stat.Rdev)) != mount.Major ||
+		devMinor(uint64(stat.Rdev)) != mount.Minor {
+		err = errors.Wrapf(ErrBlockDeviceUnreachable,
+			"mount source %s of path %s is not block device %d:%d",
+			mount.Source, path, mount.Major, mount.Minor)
+		return
+	}
+
+	blockDevice = mount.Source
+	return
+}
+
+// isSubPath checks whether path is either equal to or under
+// a given parent directory.
+func isSubPath(parent, path string) bool {
+	if parent == "/" || parent == path {
+		return true
+	}
+
+	return strings.HasPrefix(path, parent+"/")
+}
+
+// devMajor and devMinor extract the major and minor numbers
+// of a device number (as encoded by glibc's makedev).
+func devMajor(dev uint64) uint32 {
+	return uint32((dev&0x00000000000fff00)>>8 | (dev&0xfffff00000000000)>>32)
+}
+
+func devMinor(dev uint64) uint32 {
+	return uint32(dev&0x00000000000000ff | (dev&0x00000ffffff00000)>>12)
+}
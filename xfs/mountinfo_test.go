@@ -0,0 +1,174 @@
+package xfs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleMountInfo = `23 28 0:22 / /proc rw,relatime - proc proc rw
+28 1 254:0 / / rw,relatime shared:1 - ext4 /dev/vda rw
+36 28 7:0 / /mnt/xfs rw,relatime shared:2 master:1 - xfs /dev/loop0 rw,prjquota
+37 28 7:0 /volumes /mnt/with\040space rw,relatime - xfs /dev/loop0 rw,prjquota
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := xfs.ParseMountInfo(strings.NewReader(sampleMountInfo))
+	assert.NoError(t, err)
+	assert.Len(t, mounts, 4)
+
+	assert.Equal(t, xfs.Mount{
+		Id:         36,
+		ParentId:   28,
+		Major:      7,
+		Minor:      0,
+		Root:       "/",
+		MountPoint: "/mnt/xfs",
+		FsType:     "xfs",
+		Source:     "/dev/loop0",
+	}, mounts[2])
+
+	assert.Equal(t, "/volumes", mounts[3].Root)
+	assert.Equal(t, "/mnt/with space", mounts[3].MountPoint)
+	assert.Equal(t, uint32(254), mounts[1].Major)
+}
+
+func TestParseMountInfo_failsWithMalformedLines(t *testing.T) {
+	for _, line := range []string{
+		"23 28 0:22 / /proc rw,relatime proc proc rw",
+		"23 28 0:22 / /proc rw,relatime -",
+		"a 28 0:22 / /proc rw,relatime - proc proc rw",
+		"23 28 022 / /proc rw,relatime - proc proc rw",
+	} {
+		_, err := xfs.ParseMountInfo(strings.NewReader(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestGetMount(t *testing.T) {
+	mount, err := xfs.GetMount("/")
+	assert.NoError(t, err)
+	assert.Equal(t, "/", mount.MountPoint)
+
+	mount, err = xfs.GetMount("/proc/self")
+	assert.NoError(t, err)
+	assert.Equal(t, "/proc", mount.MountPoint)
+	assert.Equal(t, "proc", mount.FsType)
+}
+
+func TestGetMount_failsIfPathDoesntExist(t *testing.T) {
+	_, err := xfs.GetMount("/inexistent/path")
+	assert.Error(t, err)
+}
+
+func TestResolveBlockDevice(t *testing.T) {
+	root, err := ioutil.TempDir(xfsMountPath, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	blockDevice, err := xfs.ResolveBlockDevice(root)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(blockDevice, "/dev/"))
+
+	finfo, err := os.Stat(blockDevice)
+	assert.NoError(t, err)
+	assert.True(t, finfo.Mode()&os.ModeDevice != 0)
+}
+
+func TestResolveBlockDevice_unreachableForVirtualFilesystems(t *testing.T) {
+	_, err := xfs.ResolveBlockDevice("/proc")
+	assert.Error(t, err)
+	assert.Equal(t, xfs.ErrBlockDeviceUnreachable, errors.Cause(err))
+}
+
+func TestParseBlockDeviceMode(t *testing.T) {
+	mode, err := xfs.ParseBlockDeviceMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.BlockDeviceModeAuto, mode)
+
+	mode, err = xfs.ParseBlockDeviceMode("mknod")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.BlockDeviceModeMknod, mode)
+
+	mode, err = xfs.ParseBlockDeviceMode("lookup")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.BlockDeviceModeLookup, mode)
+
+	_, err = xfs.ParseBlockDeviceMode("something")
+	assert.Error(t, err)
+}
+
+func TestControl_mountInfoModeLeavesNoDeviceNode(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        dir,
+		BlockDeviceMode: xfs.BlockDeviceModeMountInfo,
+	})
+	assert.NoError(t, err)
+	assert.False(t, strings.HasPrefix(ctl.GetBackingFsBlockDev(), dir))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+
+	var volume = filepath.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(volume, 0755))
+	assert.NoError(t, ctl.SetQuota(volume, xfs.Quota{Size: 1 << 20}))
+
+	quota, err := ctl.GetQuota(volume)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<20), quota.Size)
+}
+
+func TestControl_lookupModeLeavesNoDeviceNode(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        dir,
+		BlockDeviceMode: xfs.BlockDeviceModeLookup,
+		PreflightMode:   xfs.PreflightModeSkip,
+	})
+	assert.NoError(t, err)
+	assert.False(t, strings.HasPrefix(ctl.GetBackingFsBlockDev(), dir))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+
+	_, err = ctl.ListProjectQuotas()
+	assert.NoError(t, err)
+}
+
+func TestControl_recreatesStaleDeviceNode(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        dir,
+		BlockDeviceMode: xfs.BlockDeviceModeMknod,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(ctl.GetBackingFsBlockDev()))
+
+	assert.NoError(t, os.Remove(ctl.GetBackingFsBlockDev()))
+
+	var volume = filepath.Join(dir, "abc")
+	assert.NoError(t, os.Mkdir(volume, 0755))
+	assert.NoError(t, ctl.SetQuota(volume, xfs.Quota{Size: 1 << 20}))
+
+	finfo, err := os.Stat(ctl.GetBackingFsBlockDev())
+	assert.NoError(t, err)
+	assert.True(t, finfo.Mode()&os.ModeDevice != 0)
+}
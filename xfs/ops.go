@@ -0,0 +1,54 @@
+package xfs
+
+// quotaOps is the set of low-level operations (quotactl(2) and
+// ioctl(2) calls) that the package builds upon.
+//
+// There are two implementations:
+//
+//   - cgoOps, which goes through `xfs.c` and requires the xfs
+//     headers (`xfslibs-dev`) at build time; and
+//   - syscallOps, written in pure Go on top of raw syscalls.
+//
+// cgoOps is used by default. syscallOps is used when building
+// with the `nocgo` tag (e.g., `go build -tags nocgo`) or when
+// cgo is disabled (`CGO_ENABLED=0`).
+//
+// Implementations return bare errors (e.g., `syscall.Errno`)
+// that the exported functions wrap with context.
+type quotaOps interface {
+	setProjectQuota(blockDevice string, projectId uint32, q *Quota) error
+	getProjectQuota(blockDevice string, projectId uint32) (*Quota, error)
+
+	// getNextProjectQuota retrieves the quota of the project
+	// with the smallest id that is greater than or equal to the
+	// supplied one, with `found` indicating whether there's any.
+	getNextProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error)
+
+	// getQuotaState reports every quota type as off in case
+	// the filesystem doesn't support quotas at all.
+	getQuotaState(blockDevice string) (*QuotaState, error)
+
+	getProjectGracePeriods(blockDevice string) (*GracePeriods, error)
+	setProjectGracePeriods(blockDevice string, g *GracePeriods) error
+
+	getProjectId(directory string) (uint32, error)
+	setProjectId(directory string, projectId uint32) error
+
+	makeBackingFsDev(root, file string) error
+
+	// getFsGeometryFlags retrieves the feature flags
+	// (`XFS_FSOP_GEOM_FLAGS_*`) of the xfs filesystem that
+	// holds a given directory.
+	getFsGeometryFlags(directory string) (uint32, error)
+
+	// The following are the counterparts of the project quota
+	// operations for ext4, which goes through the generic quotactl
+	// commands (`Q_SETQUOTA`, `Q_GETQUOTA`, ...) instead of the XFS
+	// ones.
+
+	setExt4ProjectQuota(blockDevice string, projectId uint32, q *Quota) error
+	getExt4ProjectQuota(blockDevice string, projectId uint32) (*Quota, error)
+	getNextExt4ProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error)
+	getExt4ProjectGracePeriods(blockDevice string) (*GracePeriods, error)
+	setExt4ProjectGracePeriods(blockDevice string, g *GracePeriods) error
+}
@@ -0,0 +1,370 @@
+// +build cgo,!nocgo
+
+package xfs
+
+// #include "./ext4.h"
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+var ops quotaOps = cgoOps{}
+
+// cgoOps implements the quota operations by calling the
+// functions from `xfs.c`.
+type cgoOps struct{}
+
+func (cgoOps) setProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = &C.struct_xfs_quota{
+			inodes:      C.__u64(q.INode),
+			soft_inodes: C.__u64(q.SoftINode),
+			size:        C.__u64(q.Size),
+			soft_size:   C.__u64(q.SoftSize),
+		}
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_set_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		quota)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (cgoOps) getQuotaState(blockDevice string) (state *QuotaState, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		statv             = new(C.struct_fs_quota_statv)
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_get_quota_state(blockDeviceString, statv)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+
+	var flags = uint16(statv.qs_flags)
+
+	state = &QuotaState{
+		User: QuotaTypeState{
+			Accounting:  flags&C.FS_QUOTA_UDQ_ACCT != 0,
+			Enforcement: flags&C.FS_QUOTA_UDQ_ENFD != 0,
+			File:        quotaFileFromC(&statv.qs_uquota),
+		},
+		Group: QuotaTypeState{
+			Accounting:  flags&C.FS_QUOTA_GDQ_ACCT != 0,
+			Enforcement: flags&C.FS_QUOTA_GDQ_ENFD != 0,
+			File:        quotaFileFromC(&statv.qs_gquota),
+		},
+		Project: QuotaTypeState{
+			Accounting:  flags&C.FS_QUOTA_PDQ_ACCT != 0,
+			Enforcement: flags&C.FS_QUOTA_PDQ_ENFD != 0,
+			File:        quotaFileFromC(&statv.qs_pquota),
+		},
+		IncoreDquots: uint32(statv.qs_incoredqs),
+		GracePeriods: GracePeriods{
+			Size:  time.Duration(statv.qs_btimelimit) * time.Second,
+			INode: time.Duration(statv.qs_itimelimit) * time.Second,
+		},
+		SizeWarnLimit:  uint16(statv.qs_bwarnlimit),
+		INodeWarnLimit: uint16(statv.qs_iwarnlimit),
+	}
+
+	return
+}
+
+// quotaFileFromC converts the C representation of a quota
+// file stat to its Go counterpart.
+func quotaFileFromC(file *C.struct_fs_qfilestatv) QuotaFile {
+	return QuotaFile{
+		INode:   uint64(file.qfs_ino),
+		Blocks:  uint64(file.qfs_nblks),
+		Extents: uint32(file.qfs_nextents),
+	}
+}
+
+func (cgoOps) getProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = new(C.struct_xfs_quota)
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_get_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		quota)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	q = quotaFromC(quota)
+	return
+}
+
+// quotaFromC converts the C representation of a project
+// quota to its Go counterpart.
+func quotaFromC(quota *C.struct_xfs_quota) (q *Quota) {
+	q = new(Quota)
+	q.INode = uint64(quota.inodes)
+	q.SoftINode = uint64(quota.soft_inodes)
+	q.Size = uint64(quota.size)
+	q.SoftSize = uint64(quota.soft_size)
+	q.UsedInode = uint64(quota.used_inodes)
+	q.UsedSize = uint64(quota.used_size)
+
+	if quota.size_timer != 0 {
+		q.SizeGraceExpiresAt = time.Unix(int64(quota.size_timer), 0)
+	}
+
+	if quota.inodes_timer != 0 {
+		q.INodeGraceExpiresAt = time.Unix(int64(quota.inodes_timer), 0)
+	}
+
+	return
+}
+
+func (cgoOps) getNextProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = new(C.struct_xfs_quota)
+		nextId            C.__u32
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_get_next_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		&nextId,
+		quota)
+	switch ret {
+	case -1:
+		return
+	case 1:
+		err = nil
+		return
+	}
+
+	err = nil
+	found = true
+	nextProjectId = uint32(nextId)
+	q = quotaFromC(quota)
+	return
+}
+
+func (cgoOps) getProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		gracePeriods      = new(C.struct_xfs_grace_periods)
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_get_project_grace_periods(blockDeviceString, gracePeriods)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	g = new(GracePeriods)
+	g.Size = time.Duration(gracePeriods.size) * time.Second
+	g.INode = time.Duration(gracePeriods.inodes) * time.Second
+
+	return
+}
+
+func (cgoOps) setProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		gracePeriods      = &C.struct_xfs_grace_periods{
+			size:   C.__s32(g.Size / time.Second),
+			inodes: C.__s32(g.INode / time.Second),
+		}
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.xfs_set_project_grace_periods(blockDeviceString, gracePeriods)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (cgoOps) getProjectId(directory string) (projectId uint32, err error) {
+	var directoryString = C.CString(directory)
+	defer C.free(unsafe.Pointer(directoryString))
+
+	ret, err := C.xfs_get_project_id(directoryString)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	projectId = uint32(ret)
+	return
+}
+
+func (cgoOps) getFsGeometryFlags(directory string) (flags uint32, err error) {
+	var directoryString = C.CString(directory)
+	defer C.free(unsafe.Pointer(directoryString))
+
+	var cflags C.__u32
+
+	ret, err := C.xfs_get_fs_geometry_flags(directoryString, &cflags)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	flags = uint32(cflags)
+	return
+}
+
+func (cgoOps) setProjectId(directory string, projectId uint32) (err error) {
+	var directoryString = C.CString(directory)
+	defer C.free(unsafe.Pointer(directoryString))
+
+	ret, err := C.xfs_set_project_id(directoryString, C.__u32(projectId))
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (cgoOps) makeBackingFsDev(root, file string) (err error) {
+	var (
+		rootString = C.CString(root)
+		fileString = C.CString(file)
+	)
+
+	defer C.free(unsafe.Pointer(rootString))
+	defer C.free(unsafe.Pointer(fileString))
+
+	ret, err := C.xfs_create_fs_block_dev(rootString, fileString)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (cgoOps) setExt4ProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = &C.struct_xfs_quota{
+			inodes:      C.__u64(q.INode),
+			soft_inodes: C.__u64(q.SoftINode),
+			size:        C.__u64(q.Size),
+			soft_size:   C.__u64(q.SoftSize),
+		}
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.ext4_set_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		quota)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+func (cgoOps) getExt4ProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = new(C.struct_xfs_quota)
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.ext4_get_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		quota)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	q = quotaFromC(quota)
+	return
+}
+
+func (cgoOps) getNextExt4ProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		quota             = new(C.struct_xfs_quota)
+		nextId            C.__u32
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.ext4_get_next_project_quota(blockDeviceString,
+		C.__u32(projectId),
+		&nextId,
+		quota)
+	switch ret {
+	case -1:
+		return
+	case 1:
+		err = nil
+		return
+	}
+
+	err = nil
+	found = true
+	nextProjectId = uint32(nextId)
+	q = quotaFromC(quota)
+	return
+}
+
+func (cgoOps) getExt4ProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		gracePeriods      = new(C.struct_xfs_grace_periods)
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.ext4_get_project_grace_periods(blockDeviceString, gracePeriods)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	g = new(GracePeriods)
+	g.Size = time.Duration(gracePeriods.size) * time.Second
+	g.INode = time.Duration(gracePeriods.inodes) * time.Second
+
+	return
+}
+
+func (cgoOps) setExt4ProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	var (
+		blockDeviceString = C.CString(blockDevice)
+		gracePeriods      = &C.struct_xfs_grace_periods{
+			size:   C.__s32(g.Size / time.Second),
+			inodes: C.__s32(g.INode / time.Second),
+		}
+	)
+	defer C.free(unsafe.Pointer(blockDeviceString))
+
+	ret, err := C.ext4_set_project_grace_periods(blockDeviceString, gracePeriods)
+	if ret == -1 {
+		return
+	}
+
+	err = nil
+	return
+}
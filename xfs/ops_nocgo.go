@@ -0,0 +1,6 @@
+// +build linux
+// +build !cgo nocgo
+
+package xfs
+
+var ops quotaOps = syscallOps{}
@@ -0,0 +1,163 @@
+// +build cgo,!nocgo
+
+package xfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// opsPairs lists the combinations of implementations used to
+// verify that what one of them writes is read back the same way
+// by the other.
+var opsPairs = []struct {
+	name   string
+	writer quotaOps
+	reader quotaOps
+}{
+	{"cgo-to-syscall", cgoOps{}, syscallOps{}},
+	{"syscall-to-cgo", syscallOps{}, cgoOps{}},
+}
+
+// setupParityFs creates a directory under the project-quota
+// enabled xfs mount with a backing block device.
+func setupParityFs(t *testing.T, writer quotaOps) (root, blockDevice string) {
+	root, err := ioutil.TempDir("/mnt/xfs", "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	err = writer.makeBackingFsDev(root, "block-device")
+	if !assert.NoError(t, err) {
+		os.RemoveAll(root)
+		t.FailNow()
+	}
+
+	blockDevice = filepath.Join(root, "block-device")
+	return
+}
+
+func TestOpsParity_projectId(t *testing.T) {
+	for _, pair := range opsPairs {
+		t.Run(pair.name, func(t *testing.T) {
+			root, _ := setupParityFs(t, pair.writer)
+			defer os.RemoveAll(root)
+
+			var dir = filepath.Join(root, "dir")
+			assert.NoError(t, os.Mkdir(dir, 0755))
+
+			assert.NoError(t, pair.writer.setProjectId(dir, 1234))
+
+			projectId, err := pair.reader.getProjectId(dir)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(1234), projectId)
+		})
+	}
+}
+
+func TestOpsParity_projectQuota(t *testing.T) {
+	for _, pair := range opsPairs {
+		t.Run(pair.name, func(t *testing.T) {
+			root, blockDevice := setupParityFs(t, pair.writer)
+			defer os.RemoveAll(root)
+
+			var expected = &Quota{
+				Size:      10 << 20,
+				SoftSize:  8 << 20,
+				INode:     100,
+				SoftINode: 80,
+			}
+
+			assert.NoError(t, pair.writer.setProjectQuota(blockDevice, 4321, expected))
+
+			actual, err := pair.reader.getProjectQuota(blockDevice, 4321)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+
+			nextProjectId, next, found, err := pair.reader.getNextProjectQuota(blockDevice, 4321)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, uint32(4321), nextProjectId)
+			assert.Equal(t, expected, next)
+
+			assert.NoError(t, pair.writer.setProjectQuota(blockDevice, 4321, &Quota{}))
+		})
+	}
+}
+
+func TestOpsParity_gracePeriodsAndState(t *testing.T) {
+	for _, pair := range opsPairs {
+		t.Run(pair.name, func(t *testing.T) {
+			root, blockDevice := setupParityFs(t, pair.writer)
+			defer os.RemoveAll(root)
+
+			original, err := pair.reader.getProjectGracePeriods(blockDevice)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer pair.writer.setProjectGracePeriods(blockDevice, original)
+
+			assert.NoError(t, pair.writer.setProjectGracePeriods(blockDevice, &GracePeriods{
+				Size:  2 * time.Hour,
+				INode: 3 * time.Hour,
+			}))
+
+			gracePeriods, err := pair.reader.getProjectGracePeriods(blockDevice)
+			assert.NoError(t, err)
+			assert.Equal(t, 2*time.Hour, gracePeriods.Size)
+			assert.Equal(t, 3*time.Hour, gracePeriods.INode)
+
+			writerState, err := pair.writer.getQuotaState(blockDevice)
+			assert.NoError(t, err)
+
+			readerState, err := pair.reader.getQuotaState(blockDevice)
+			assert.NoError(t, err)
+
+			readerState.IncoreDquots = writerState.IncoreDquots
+			assert.Equal(t, writerState, readerState)
+		})
+	}
+}
+
+func TestOpsParity_ext4ProjectQuota(t *testing.T) {
+	for _, pair := range opsPairs {
+		t.Run(pair.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("/mnt/ext4", "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer os.RemoveAll(root)
+
+			assert.NoError(t, pair.writer.makeBackingFsDev(root, "block-device"))
+
+			var (
+				blockDevice = filepath.Join(root, "block-device")
+				expected    = &Quota{
+					Size:      10 << 20,
+					SoftSize:  8 << 20,
+					INode:     100,
+					SoftINode: 80,
+				}
+			)
+
+			assert.NoError(t, pair.writer.setExt4ProjectQuota(blockDevice, 4321, expected))
+
+			actual, err := pair.reader.getExt4ProjectQuota(blockDevice, 4321)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+
+			nextProjectId, next, found, err := pair.reader.getNextExt4ProjectQuota(blockDevice, 4321)
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, uint32(4321), nextProjectId)
+			assert.Equal(t, expected, next)
+
+			assert.NoError(t, pair.writer.setExt4ProjectQuota(blockDevice, 4321, &Quota{}))
+		})
+	}
+}
@@ -0,0 +1,636 @@
+// +build linux
+
+package xfs
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The following definitions mirror those from the kernel
+// headers (linux/quota.h, linux/dqblk_xfs.h and linux/fs.h)
+// that `xfs.c` gets from the system headers and that
+// golang.org/x/sys/unix doesn't provide.
+const (
+	// basicBlockSize is the size of a disk block as
+	// defined by the quota api.
+	basicBlockSize = 512
+
+	prjQuota = 2
+
+	qXGetQuota      = 'X'<<8 + 3
+	qXSetQLim       = 'X'<<8 + 4
+	qXGetQStatV     = 'X'<<8 + 8
+	qXGetNextQuota  = 'X'<<8 + 9
+	fsDQuotVersion  = 1
+	fsQStatVVersion = 1
+	fsProjQuota     = 2
+
+	fsDQISoft  = 1 << 0
+	fsDQIHard  = 1 << 1
+	fsDQBSoft  = 1 << 2
+	fsDQBHard  = 1 << 3
+	fsDQBTimer = 1 << 6
+	fsDQITimer = 1 << 7
+
+	fsQuotaUDQAcct = 1 << 0
+	fsQuotaUDQEnfd = 1 << 1
+	fsQuotaGDQAcct = 1 << 2
+	fsQuotaGDQEnfd = 1 << 3
+	fsQuotaPDQAcct = 1 << 4
+	fsQuotaPDQEnfd = 1 << 5
+
+	fsXFlagProjInherit = 0x00000200
+
+	qGetInfo      = 0x800005
+	qSetInfo      = 0x800006
+	qGetQuota     = 0x800007
+	qSetQuota     = 0x800008
+	qGetNextQuota = 0x800009
+
+	// qifDqBlkSize is the size of a block as defined by the
+	// generic quota api.
+	qifDqBlkSize = 1024
+
+	qifBLimits = 1 << 0
+	qifILimits = 1 << 2
+	qifLimits  = qifBLimits | qifILimits
+
+	iifBGrace = 1
+	iifIGrace = 2
+
+	// fsIocFsGetXAttr and fsIocFsSetXAttr correspond to
+	// _IOR('X', 31, struct fsxattr) and _IOW('X', 32,
+	// struct fsxattr).
+	fsIocFsGetXAttr = 0x801c581f
+	fsIocFsSetXAttr = 0x401c5820
+
+	// xfsIocFsGeometryV1 corresponds to _IOR('X', 100,
+	// struct xfs_fsop_geom_v1), which (differently from
+	// newer versions) every kernel supports.
+	xfsIocFsGeometryV1 = 0x80705864
+)
+
+// fsDiskQuota mirrors `struct fs_disk_quota`.
+type fsDiskQuota struct {
+	Version      int8
+	Flags        int8
+	FieldMask    uint16
+	Id           uint32
+	BlkHardLimit uint64
+	BlkSoftLimit uint64
+	InoHardLimit uint64
+	InoSoftLimit uint64
+	BCount       uint64
+	ICount       uint64
+	ITimer       int32
+	BTimer       int32
+	IWarns       uint16
+	BWarns       uint16
+	ITimerHi     int8
+	BTimerHi     int8
+	RtbTimerHi   int8
+	Padding2     int8
+	RtbHardLimit uint64
+	RtbSoftLimit uint64
+	RtbCount     uint64
+	RtbTimer     int32
+	RtbWarns     uint16
+	Padding3     int16
+	Padding4     [8]byte
+}
+
+// fsQFileStatV mirrors `struct fs_qfilestatv`.
+type fsQFileStatV struct {
+	Ino      uint64
+	NBlks    uint64
+	NExtents uint32
+	Pad      uint32
+}
+
+// fsQuotaStatV mirrors `struct fs_quota_statv`.
+type fsQuotaStatV struct {
+	Version      int8
+	Pad1         uint8
+	Flags        uint16
+	IncoreDqs    uint32
+	UQuota       fsQFileStatV
+	GQuota       fsQFileStatV
+	PQuota       fsQFileStatV
+	BTimeLimit   int32
+	ITimeLimit   int32
+	RtbTimeLimit int32
+	BWarnLimit   uint16
+	IWarnLimit   uint16
+	RtbWarnLimit uint16
+	Pad3         uint16
+	Pad4         uint32
+	Pad2         [7]uint64
+}
+
+// ifDqBlk mirrors `struct if_dqblk`.
+type ifDqBlk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+}
+
+// ifNextDqBlk mirrors `struct if_nextdqblk`.
+//
+// It can't embed `ifDqBlk` as the id takes the place of the
+// padding at the end of `struct if_dqblk`.
+type ifNextDqBlk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	Id         uint32
+}
+
+// ifDqInfo mirrors `struct if_dqinfo`.
+type ifDqInfo struct {
+	BGrace uint64
+	IGrace uint64
+	Flags  uint32
+	Valid  uint32
+}
+
+// fsXAttr mirrors `struct fsxattr`.
+type fsXAttr struct {
+	XFlags     uint32
+	ExtSize    uint32
+	NExtents   uint32
+	ProjId     uint32
+	CowExtSize uint32
+	Pad        [8]byte
+}
+
+// xfsFsopGeomV1 mirrors `struct xfs_fsop_geom_v1`.
+type xfsFsopGeomV1 struct {
+	BlockSize    uint32
+	RtExtSize    uint32
+	AgBlocks     uint32
+	AgCount      uint32
+	LogBlocks    uint32
+	SectSize     uint32
+	INodeSize    uint32
+	IMaxPct      uint32
+	DataBlocks   uint64
+	RtBlocks     uint64
+	RtExtents    uint64
+	LogStart     uint64
+	Uuid         [16]byte
+	SUnit        uint32
+	SWidth       uint32
+	Version      int32
+	Flags        uint32
+	LogSectSize  uint32
+	RtSectSize   uint32
+	DirBlockSize uint32
+	Pad          [4]byte
+}
+
+// syscallOps implements the quota operations in pure Go
+// by issuing the syscalls directly.
+type syscallOps struct{}
+
+// quotactl performs a quotactl(2) call for project quotas.
+func quotactl(cmd int, blockDevice string, id uint32, addr unsafe.Pointer) (err error) {
+	blockDevicePtr, err := unix.BytePtrFromString(blockDevice)
+	if err != nil {
+		return
+	}
+
+	_, _, errno := unix.Syscall6(unix.SYS_QUOTACTL,
+		uintptr(cmd<<8|prjQuota),
+		uintptr(unsafe.Pointer(blockDevicePtr)),
+		uintptr(id),
+		uintptr(addr),
+		0, 0)
+	if errno != 0 {
+		err = errno
+		return
+	}
+
+	return
+}
+
+// ioctlXAttr performs an FS_IOC_FS{GET,SET}XATTR ioctl(2) call.
+func ioctlXAttr(file *os.File, req uintptr, xattr *fsXAttr) (err error) {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL,
+		file.Fd(),
+		req,
+		uintptr(unsafe.Pointer(xattr)))
+	if errno != 0 {
+		err = errno
+		return
+	}
+
+	return
+}
+
+func (syscallOps) setProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
+	var diskQuota = fsDiskQuota{
+		Version:      fsDQuotVersion,
+		Id:           projectId,
+		Flags:        fsProjQuota,
+		BlkHardLimit: q.Size / basicBlockSize,
+		BlkSoftLimit: q.SoftSize / basicBlockSize,
+		InoHardLimit: q.INode,
+		InoSoftLimit: q.SoftINode,
+		FieldMask:    fsDQBHard | fsDQBSoft | fsDQISoft | fsDQIHard,
+	}
+
+	err = quotactl(qXSetQLim, blockDevice, projectId,
+		unsafe.Pointer(&diskQuota))
+	return
+}
+
+// quotaFromDiskQuota converts the disk quota retrieved from
+// the kernel to a `Quota`.
+func quotaFromDiskQuota(diskQuota *fsDiskQuota) (q *Quota) {
+	q = new(Quota)
+	q.INode = diskQuota.InoHardLimit
+	q.SoftINode = diskQuota.InoSoftLimit
+	q.Size = diskQuota.BlkHardLimit * basicBlockSize
+	q.SoftSize = diskQuota.BlkSoftLimit * basicBlockSize
+	q.UsedInode = diskQuota.ICount
+	q.UsedSize = diskQuota.BCount * basicBlockSize
+
+	if diskQuota.BTimer != 0 {
+		q.SizeGraceExpiresAt = time.Unix(int64(diskQuota.BTimer), 0)
+	}
+
+	if diskQuota.ITimer != 0 {
+		q.INodeGraceExpiresAt = time.Unix(int64(diskQuota.ITimer), 0)
+	}
+
+	return
+}
+
+func (syscallOps) getProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error) {
+	var diskQuota fsDiskQuota
+
+	err = quotactl(qXGetQuota, blockDevice, projectId,
+		unsafe.Pointer(&diskQuota))
+	if err != nil {
+		return
+	}
+
+	q = quotaFromDiskQuota(&diskQuota)
+	return
+}
+
+func (syscallOps) getNextProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error) {
+	var diskQuota fsDiskQuota
+
+	// ENOENT is used by the kernel to indicate that there
+	// are no more ids, thus, make sure that it can't come
+	// from an inexistent block device.
+	err = unix.Access(blockDevice, 0)
+	if err != nil {
+		return
+	}
+
+	err = quotactl(qXGetNextQuota, blockDevice, projectId,
+		unsafe.Pointer(&diskQuota))
+	if err != nil {
+		if err == unix.ENOENT {
+			err = nil
+		}
+
+		return
+	}
+
+	found = true
+	nextProjectId = diskQuota.Id
+	q = quotaFromDiskQuota(&diskQuota)
+	return
+}
+
+func (syscallOps) getQuotaState(blockDevice string) (state *QuotaState, err error) {
+	var statv = fsQuotaStatV{
+		Version: fsQStatVVersion,
+	}
+
+	err = quotactl(qXGetQStatV, blockDevice, 0, unsafe.Pointer(&statv))
+	if err != nil {
+		if err != unix.ENOSYS && err != unix.EINVAL {
+			return
+		}
+
+		err = nil
+		statv = fsQuotaStatV{}
+	}
+
+	state = &QuotaState{
+		User: QuotaTypeState{
+			Accounting:  statv.Flags&fsQuotaUDQAcct != 0,
+			Enforcement: statv.Flags&fsQuotaUDQEnfd != 0,
+			File:        quotaFileFromStatV(&statv.UQuota),
+		},
+		Group: QuotaTypeState{
+			Accounting:  statv.Flags&fsQuotaGDQAcct != 0,
+			Enforcement: statv.Flags&fsQuotaGDQEnfd != 0,
+			File:        quotaFileFromStatV(&statv.GQuota),
+		},
+		Project: QuotaTypeState{
+			Accounting:  statv.Flags&fsQuotaPDQAcct != 0,
+			Enforcement: statv.Flags&fsQuotaPDQEnfd != 0,
+			File:        quotaFileFromStatV(&statv.PQuota),
+		},
+		IncoreDquots: statv.IncoreDqs,
+		GracePeriods: GracePeriods{
+			Size:  time.Duration(statv.BTimeLimit) * time.Second,
+			INode: time.Duration(statv.ITimeLimit) * time.Second,
+		},
+		SizeWarnLimit:  statv.BWarnLimit,
+		INodeWarnLimit: statv.IWarnLimit,
+	}
+
+	return
+}
+
+// quotaFileFromStatV converts the kernel representation of
+// a quota file stat to a `QuotaFile`.
+func quotaFileFromStatV(file *fsQFileStatV) QuotaFile {
+	return QuotaFile{
+		INode:   file.Ino,
+		Blocks:  file.NBlks,
+		Extents: file.NExtents,
+	}
+}
+
+func (syscallOps) getProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	var statv = fsQuotaStatV{
+		Version: fsQStatVVersion,
+	}
+
+	err = quotactl(qXGetQStatV, blockDevice, 0, unsafe.Pointer(&statv))
+	if err != nil {
+		return
+	}
+
+	g = new(GracePeriods)
+	g.Size = time.Duration(statv.BTimeLimit) * time.Second
+	g.INode = time.Duration(statv.ITimeLimit) * time.Second
+
+	return
+}
+
+func (syscallOps) setProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	var diskQuota = fsDiskQuota{
+		Version: fsDQuotVersion,
+		Id:      0,
+		Flags:   fsProjQuota,
+		BTimer:  int32(g.Size / time.Second),
+		ITimer:  int32(g.INode / time.Second),
+	}
+
+	if diskQuota.BTimer != 0 {
+		diskQuota.FieldMask |= fsDQBTimer
+	}
+
+	if diskQuota.ITimer != 0 {
+		diskQuota.FieldMask |= fsDQITimer
+	}
+
+	if diskQuota.FieldMask == 0 {
+		return
+	}
+
+	err = quotactl(qXSetQLim, blockDevice, 0, unsafe.Pointer(&diskQuota))
+	return
+}
+
+// openDirectory opens a directory for issuing ioctls against it.
+func openDirectory(directory string) (file *os.File, err error) {
+	fd, err := unix.Open(directory,
+		unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+
+	file = os.NewFile(uintptr(fd), directory)
+	return
+}
+
+func (syscallOps) getProjectId(directory string) (projectId uint32, err error) {
+	var xattr fsXAttr
+
+	dir, err := openDirectory(directory)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+
+	err = ioctlXAttr(dir, fsIocFsGetXAttr, &xattr)
+	if err != nil {
+		return
+	}
+
+	projectId = xattr.ProjId
+	return
+}
+
+func (syscallOps) getFsGeometryFlags(directory string) (flags uint32, err error) {
+	var geometry xfsFsopGeomV1
+
+	dir, err := openDirectory(directory)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL,
+		dir.Fd(),
+		xfsIocFsGeometryV1,
+		uintptr(unsafe.Pointer(&geometry)))
+	if errno != 0 {
+		err = errno
+		return
+	}
+
+	flags = geometry.Flags
+	return
+}
+
+func (syscallOps) setProjectId(directory string, projectId uint32) (err error) {
+	var xattr fsXAttr
+
+	dir, err := openDirectory(directory)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+
+	err = ioctlXAttr(dir, fsIocFsGetXAttr, &xattr)
+	if err != nil {
+		return
+	}
+
+	xattr.ProjId = projectId
+	xattr.XFlags |= fsXFlagProjInherit
+
+	err = ioctlXAttr(dir, fsIocFsSetXAttr, &xattr)
+	return
+}
+
+func (syscallOps) makeBackingFsDev(root, file string) (err error) {
+	var (
+		stat     unix.Stat_t
+		fullPath = filepath.Join(root, file)
+	)
+
+	err = unix.Stat(root, &stat)
+	if err != nil {
+		return
+	}
+
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		err = unix.ENOTDIR
+		return
+	}
+
+	err = unix.Unlink(fullPath)
+	if err != nil && err != unix.ENOENT {
+		return
+	}
+
+	err = unix.Mknod(fullPath, unix.S_IFBLK|0600, int(stat.Dev))
+	return
+}
+
+func (syscallOps) setExt4ProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
+	var dqblk = ifDqBlk{
+		BHardLimit: q.Size / qifDqBlkSize,
+		BSoftLimit: q.SoftSize / qifDqBlkSize,
+		IHardLimit: q.INode,
+		ISoftLimit: q.SoftINode,
+		Valid:      qifLimits,
+	}
+
+	err = quotactl(qSetQuota, blockDevice, projectId, unsafe.Pointer(&dqblk))
+	return
+}
+
+// quotaFromDqBlk converts the generic quota block retrieved
+// from the kernel to a `Quota`.
+func quotaFromDqBlk(dqblk *ifDqBlk) (q *Quota) {
+	q = new(Quota)
+	q.INode = dqblk.IHardLimit
+	q.SoftINode = dqblk.ISoftLimit
+	q.Size = dqblk.BHardLimit * qifDqBlkSize
+	q.SoftSize = dqblk.BSoftLimit * qifDqBlkSize
+	q.UsedInode = dqblk.CurInodes
+	q.UsedSize = dqblk.CurSpace
+
+	if dqblk.BTime != 0 {
+		q.SizeGraceExpiresAt = time.Unix(int64(dqblk.BTime), 0)
+	}
+
+	if dqblk.ITime != 0 {
+		q.INodeGraceExpiresAt = time.Unix(int64(dqblk.ITime), 0)
+	}
+
+	return
+}
+
+func (syscallOps) getExt4ProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error) {
+	var dqblk ifDqBlk
+
+	err = quotactl(qGetQuota, blockDevice, projectId, unsafe.Pointer(&dqblk))
+	if err != nil {
+		return
+	}
+
+	q = quotaFromDqBlk(&dqblk)
+	return
+}
+
+func (syscallOps) getNextExt4ProjectQuota(blockDevice string, projectId uint32) (nextProjectId uint32, q *Quota, found bool, err error) {
+	var nextDqblk ifNextDqBlk
+
+	// Just like with XFS, ENOENT indicates that there are
+	// no more ids.
+	err = unix.Access(blockDevice, 0)
+	if err != nil {
+		return
+	}
+
+	err = quotactl(qGetNextQuota, blockDevice, projectId,
+		unsafe.Pointer(&nextDqblk))
+	if err != nil {
+		if err == unix.ENOENT {
+			err = nil
+		}
+
+		return
+	}
+
+	found = true
+	nextProjectId = nextDqblk.Id
+	q = quotaFromDqBlk(&ifDqBlk{
+		BHardLimit: nextDqblk.BHardLimit,
+		BSoftLimit: nextDqblk.BSoftLimit,
+		CurSpace:   nextDqblk.CurSpace,
+		IHardLimit: nextDqblk.IHardLimit,
+		ISoftLimit: nextDqblk.ISoftLimit,
+		CurInodes:  nextDqblk.CurInodes,
+		BTime:      nextDqblk.BTime,
+		ITime:      nextDqblk.ITime,
+	})
+	return
+}
+
+func (syscallOps) getExt4ProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	var dqinfo ifDqInfo
+
+	err = quotactl(qGetInfo, blockDevice, 0, unsafe.Pointer(&dqinfo))
+	if err != nil {
+		return
+	}
+
+	g = new(GracePeriods)
+	g.Size = time.Duration(dqinfo.BGrace) * time.Second
+	g.INode = time.Duration(dqinfo.IGrace) * time.Second
+
+	return
+}
+
+func (syscallOps) setExt4ProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	var dqinfo = ifDqInfo{
+		BGrace: uint64(g.Size / time.Second),
+		IGrace: uint64(g.INode / time.Second),
+	}
+
+	if dqinfo.BGrace != 0 {
+		dqinfo.Valid |= iifBGrace
+	}
+
+	if dqinfo.IGrace != 0 {
+		dqinfo.Valid |= iifIGrace
+	}
+
+	if dqinfo.Valid == 0 {
+		return
+	}
+
+	err = quotactl(qSetInfo, blockDevice, 0, unsafe.Pointer(&dqinfo))
+	return
+}
@@ -0,0 +1,41 @@
+// +build linux
+
+package xfs
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyscallOps_structsMatchKernelLayout(t *testing.T) {
+	assert.Equal(t, uintptr(112), unsafe.Sizeof(fsDiskQuota{}))
+	assert.Equal(t, uintptr(24), unsafe.Sizeof(fsQFileStatV{}))
+	assert.Equal(t, uintptr(160), unsafe.Sizeof(fsQuotaStatV{}))
+	assert.Equal(t, uintptr(28), unsafe.Sizeof(fsXAttr{}))
+	assert.Equal(t, uintptr(72), unsafe.Sizeof(ifDqBlk{}))
+	assert.Equal(t, uintptr(72), unsafe.Sizeof(ifNextDqBlk{}))
+	assert.Equal(t, uintptr(24), unsafe.Sizeof(ifDqInfo{}))
+	assert.Equal(t, uintptr(112), unsafe.Sizeof(xfsFsopGeomV1{}))
+
+	assert.Equal(t, uintptr(60), unsafe.Offsetof(fsDiskQuota{}.BTimer))
+	assert.Equal(t, uintptr(80), unsafe.Offsetof(fsQuotaStatV{}.BTimeLimit))
+	assert.Equal(t, uintptr(12), unsafe.Offsetof(fsXAttr{}.ProjId))
+	assert.Equal(t, uintptr(68), unsafe.Offsetof(ifNextDqBlk{}.Id))
+	assert.Equal(t, uintptr(92), unsafe.Offsetof(xfsFsopGeomV1{}.Flags))
+}
+
+func TestSyscallOps_ioctlRequestsMatchKernel(t *testing.T) {
+	var (
+		iocWrite uintptr = 1
+		iocRead  uintptr = 2
+		size             = unsafe.Sizeof(fsXAttr{})
+	)
+
+	assert.Equal(t, iocRead<<30|size<<16|'X'<<8|31, uintptr(fsIocFsGetXAttr))
+	assert.Equal(t, iocWrite<<30|size<<16|'X'<<8|32, uintptr(fsIocFsSetXAttr))
+
+	size = unsafe.Sizeof(xfsFsopGeomV1{})
+	assert.Equal(t, iocRead<<30|size<<16|'X'<<8|100, uintptr(xfsIocFsGeometryV1))
+}
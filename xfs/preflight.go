@@ -0,0 +1,173 @@
+// +build linux
+
+package xfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PreflightMode determines what happens when the checks that
+// verify that the filesystem holding the base path is fit for
+// enforcing project quotas fail.
+type PreflightMode string
+
+const (
+	// PreflightModeFail makes the creation of the control
+	// fail when any of the checks fails.
+	PreflightModeFail PreflightMode = "fail"
+
+	// PreflightModeWarn only logs the checks that failed,
+	// letting the control be created anyway.
+	PreflightModeWarn PreflightMode = "warn"
+
+	// PreflightModeSkip doesn't run the checks at all (e.g.,
+	// when only inspecting the quotas).
+	PreflightModeSkip PreflightMode = "skip"
+)
+
+// ParsePreflightMode parses the textual representation of
+// a PreflightMode, with the empty string meaning the default
+// (`PreflightModeFail`).
+func ParsePreflightMode(mode string) (preflightMode PreflightMode, err error) {
+	switch PreflightMode(mode) {
+	case "":
+		preflightMode = PreflightModeFail
+	case PreflightModeFail, PreflightModeWarn, PreflightModeSkip:
+		preflightMode = PreflightMode(mode)
+	default:
+		err = errors.Errorf(
+			"unknown preflight mode '%s' - must be one of %s, %s or %s",
+			mode, PreflightModeFail, PreflightModeWarn, PreflightModeSkip)
+	}
+
+	return
+}
+
+// PreflightError indicates that the filesystem holding a base
+// path is not fit for enforcing project quotas.
+type PreflightError struct {
+	BasePath string
+
+	// Failures holds a description of each of the
+	// checks that failed.
+	Failures []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("preflight checks failed for %s: %s",
+		e.BasePath, strings.Join(e.Failures, "; "))
+}
+
+// Preflight verifies that the filesystem holding `basePath` (whose
+// quotas are controlled by `blockDevice`) is fit for enforcing
+// project quotas, returning a `*PreflightError` if it's not.
+//
+// The following is checked:
+//
+//   - the filesystem is either xfs or ext4;
+//   - project quota accounting and enforcement are both on -
+//     otherwise volumes get created with no limits at all;
+//   - `basePath` is not the root of the filesystem - otherwise
+//     every directory of the filesystem (e.g., ext4's
+//     `lost+found`) would be taken as a volume;
+//   - for xfs, the filesystem has been formatted with `ftype=1`
+//     so that `d_type` is supported (e.g., by overlayfs).
+func Preflight(basePath, blockDevice string) (err error) {
+	var failures []string
+
+	fsType, err := GetFsType(basePath)
+	if err != nil {
+		failures = append(failures, err.Error())
+		err = &PreflightError{
+			BasePath: basePath,
+			Failures: failures,
+		}
+		return
+	}
+
+	state, err := GetQuotaState(blockDevice)
+	switch {
+	case err != nil:
+		failures = append(failures, err.Error())
+	case !state.Project.Accounting:
+		failures = append(failures, fmt.Sprintf(
+			"project quota accounting is off - the filesystem must be mounted with '%s'",
+			projectQuotaMountOption(fsType)))
+	case !state.Project.Enforcement:
+		failures = append(failures, fmt.Sprintf(
+			"project quota enforcement is off - limits wouldn't be enforced (mount the filesystem with '%s')",
+			projectQuotaMountOption(fsType)))
+	}
+
+	isRoot, err := isFilesystemRoot(basePath)
+	switch {
+	case err != nil:
+		failures = append(failures, err.Error())
+	case isRoot:
+		failures = append(failures,
+			"base path is the root of the filesystem - every directory in it would be taken as a volume (use a subdirectory)")
+	}
+
+	if fsType == FsTypeXFS {
+		isFtypeEnabled, err := IsFtypeEnabled(basePath)
+		switch {
+		case err != nil:
+			failures = append(failures, err.Error())
+		case !isFtypeEnabled:
+			failures = append(failures,
+				"xfs filesystem formatted with ftype=0 - d_type is not supported (format it with 'mkfs.xfs -n ftype=1')")
+		}
+	}
+
+	err = nil
+	if len(failures) != 0 {
+		err = &PreflightError{
+			BasePath: basePath,
+			Failures: failures,
+		}
+	}
+
+	return
+}
+
+// projectQuotaMountOption retrieves the mount option that turns
+// project quota accounting and enforcement on for a given type
+// of filesystem.
+func projectQuotaMountOption(fsType FsType) string {
+	if fsType == FsTypeExt4 {
+		return "prjquota"
+	}
+
+	return "pquota"
+}
+
+// isFilesystemRoot checks whether a given path is the root of
+// the filesystem that holds it.
+//
+// Paths that are mount points of subdirectories of a filesystem
+// (e.g., bind mounts) are not considered roots.
+func isFilesystemRoot(path string) (isRoot bool, err error) {
+	mount, err := GetMount(path)
+	if err != nil {
+		return
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't make path %s absolute", path)
+		return
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't resolve path %s", absPath)
+		return
+	}
+
+	isRoot = mount.Root == "/" && mount.MountPoint == resolvedPath
+	return
+}
@@ -0,0 +1,110 @@
+package xfs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePreflightMode(t *testing.T) {
+	mode, err := xfs.ParsePreflightMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.PreflightModeFail, mode)
+
+	mode, err = xfs.ParsePreflightMode("warn")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.PreflightModeWarn, mode)
+
+	mode, err = xfs.ParsePreflightMode("skip")
+	assert.NoError(t, err)
+	assert.Equal(t, xfs.PreflightModeSkip, mode)
+
+	_, err = xfs.ParsePreflightMode("ignore")
+	assert.Error(t, err)
+}
+
+func TestPreflight_failsForUnsupportedFilesystems(t *testing.T) {
+	err := xfs.Preflight("/proc", "/dev/null")
+	assert.Error(t, err)
+
+	preflightErr, ok := errors.Cause(err).(*xfs.PreflightError)
+	assert.True(t, ok)
+	assert.Equal(t, "/proc", preflightErr.BasePath)
+	assert.Len(t, preflightErr.Failures, 1)
+}
+
+func TestPreflight_succeedsUnderQuotaEnabledXFS(t *testing.T) {
+	dir, err := ioutil.TempDir(xfsMount, "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blockDevice, err := xfs.ResolveBlockDevice(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, xfs.Preflight(dir, blockDevice))
+
+	isFtypeEnabled, err := xfs.IsFtypeEnabled(dir)
+	assert.NoError(t, err)
+	assert.True(t, isFtypeEnabled)
+}
+
+func TestPreflight_succeedsUnderQuotaEnabledExt4(t *testing.T) {
+	dir, err := ioutil.TempDir(ext4MountPath+"/tmp", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	blockDevice, err := xfs.ResolveBlockDevice(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, xfs.Preflight(dir, blockDevice))
+}
+
+func TestPreflight_failsWithoutProjectQuota(t *testing.T) {
+	root, err := setupTestFs(xfsMountPathWithoutQuota, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	blockDevice, err := xfs.ResolveBlockDevice(root)
+	assert.NoError(t, err)
+
+	err = xfs.Preflight(root, blockDevice)
+	assert.Error(t, err)
+
+	preflightErr, ok := errors.Cause(err).(*xfs.PreflightError)
+	assert.True(t, ok)
+	assert.Len(t, preflightErr.Failures, 1)
+}
+
+func TestPreflight_failsAtFilesystemRoot(t *testing.T) {
+	blockDevice, err := xfs.ResolveBlockDevice(xfsMountPath)
+	assert.NoError(t, err)
+
+	err = xfs.Preflight(xfsMountPath, blockDevice)
+	assert.Error(t, err)
+
+	preflightErr, ok := errors.Cause(err).(*xfs.PreflightError)
+	assert.True(t, ok)
+	assert.Len(t, preflightErr.Failures, 1)
+}
+
+func TestControl_preflightModeDeterminesWhetherCreationFails(t *testing.T) {
+	_, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        xfsMountPath,
+		BlockDeviceMode: xfs.BlockDeviceModeMountInfo,
+	})
+	assert.Error(t, err)
+
+	_, ok := errors.Cause(err).(*xfs.PreflightError)
+	assert.True(t, ok)
+
+	_, err = xfs.NewControl(xfs.ControlConfig{
+		BasePath:        xfsMountPath,
+		BlockDeviceMode: xfs.BlockDeviceModeMountInfo,
+		PreflightMode:   xfs.PreflightModeWarn,
+	})
+	assert.NoError(t, err)
+}
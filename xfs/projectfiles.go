@@ -0,0 +1,284 @@
+// +build linux
+
+package xfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultProjectsFile is the path of the file that maps
+	// project ids to directories used by xfs_quota(8).
+	DefaultProjectsFile = "/etc/projects"
+
+	// DefaultProjIdFile is the path of the file that maps
+	// project names to project ids used by xfs_quota(8).
+	DefaultProjIdFile = "/etc/projid"
+)
+
+// projectFiles keeps the files that xfs_quota(8) reads to name
+// projects (`projects` with `id:path` entries and `projid` with
+// `name:id` entries) in sync with the directories under a base
+// path, naming each project after its directory.
+//
+// Entries that don't belong to the base path (e.g., from other
+// tools or other roots) are preserved as they are.
+//
+// Files are replaced atomically (written to a temporary file that
+// is then renamed) while holding a lock (`<file>.lock`) shared by
+// every process that updates them.
+type projectFiles struct {
+	basePath string
+
+	// projectsPath and projIdPath are the paths of the files
+	// to keep in sync - an empty path disables the file.
+	projectsPath string
+	projIdPath   string
+}
+
+// enabled indicates whether any of the files is to be kept.
+func (f *projectFiles) enabled() bool {
+	return f.projectsPath != "" || f.projIdPath != ""
+}
+
+// write updates the files such that the entries of the base path
+// correspond to `projects` (a map of paths to project ids).
+//
+// `released` lists the ids of projects that have just been removed
+// such that their `projid` entries can be dropped even when the
+// `projects` file (which tells which ids belong to the base path)
+// is not kept.
+func (f *projectFiles) write(projects map[string]uint32, released ...uint32) (err error) {
+	if !f.enabled() {
+		return
+	}
+
+	lockPath := f.projectsPath
+	if lockPath == "" {
+		lockPath = f.projIdPath
+	}
+
+	unlock, err := lockFile(lockPath + ".lock")
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	var (
+		ownedIds = make(map[uint32]bool, len(projects))
+		paths    = make([]string, 0, len(projects))
+	)
+
+	for _, projectId := range released {
+		ownedIds[projectId] = true
+	}
+
+	for path, projectId := range projects {
+		if filepath.Dir(path) != f.basePath {
+			continue
+		}
+
+		ownedIds[projectId] = true
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	if f.projectsPath != "" {
+		var lines []string
+
+		lines, err = readLines(f.projectsPath)
+		if err != nil {
+			return
+		}
+
+		var content bytes.Buffer
+		for _, line := range lines {
+			projectId, path, ok := parseProjectFileLine(line)
+			if ok && filepath.Dir(path) == f.basePath {
+				parsedId, parseErr := strconv.ParseUint(projectId, 10, 32)
+				if parseErr == nil {
+					ownedIds[uint32(parsedId)] = true
+				}
+				continue
+			}
+
+			fmt.Fprintln(&content, line)
+		}
+
+		for _, path := range paths {
+			fmt.Fprintf(&content, "%d:%s\n", projects[path], path)
+		}
+
+		err = writeFileAtomically(f.projectsPath, content.Bytes())
+		if err != nil {
+			return
+		}
+	}
+
+	if f.projIdPath != "" {
+		var lines []string
+
+		lines, err = readLines(f.projIdPath)
+		if err != nil {
+			return
+		}
+
+		var content bytes.Buffer
+		for _, line := range lines {
+			_, projectId, ok := parseProjectFileLine(line)
+			if ok {
+				parsedId, parseErr := strconv.ParseUint(projectId, 10, 32)
+				if parseErr == nil && ownedIds[uint32(parsedId)] {
+					continue
+				}
+			}
+
+			fmt.Fprintln(&content, line)
+		}
+
+		for _, path := range paths {
+			fmt.Fprintf(&content, "%s:%d\n", filepath.Base(path), projects[path])
+		}
+
+		err = writeFileAtomically(f.projIdPath, content.Bytes())
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// parseProjectFileLine splits an entry of either the `projects`
+// or the `projid` file into its two fields, telling whether the
+// line is an entry at all (i.e., not a comment nor blank).
+func parseProjectFileLine(line string) (first, second string, ok bool) {
+	var trimmed = strings.TrimSpace(line)
+
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return
+	}
+
+	fields := strings.SplitN(trimmed, ":", 2)
+	if len(fields) != 2 {
+		return
+	}
+
+	first, second, ok = fields[0], fields[1], true
+	return
+}
+
+// readLines reads the lines of a file, considering files that
+// don't exist as empty.
+func readLines(path string) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = errors.Wrapf(err, "couldn't open %s", path)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't read %s", path)
+		return
+	}
+
+	return
+}
+
+// writeFileAtomically replaces the contents of a file by writing
+// them to a temporary file in the same directory that is then
+// renamed over the original one, such that readers never see a
+// partially written file.
+func writeFileAtomically(path string, content []byte) (err error) {
+	var mode os.FileMode = 0644
+
+	finfo, err := os.Stat(path)
+	switch {
+	case err == nil:
+		mode = finfo.Mode().Perm()
+	case !os.IsNotExist(err):
+		err = errors.Wrapf(err, "couldn't stat %s", path)
+		return
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't create temporary file for %s", path)
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't write temporary file for %s", path)
+		return
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't replace %s", path)
+		return
+	}
+
+	return
+}
+
+// lockFile acquires an exclusive advisory lock (flock) on a file,
+// creating it if needed. The returned function releases it.
+func lockFile(path string) (unlock func(), err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		err = errors.Wrapf(err, "couldn't open lock file %s", path)
+		return
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		err = errors.Wrapf(err, "couldn't lock file %s", path)
+		return
+	}
+
+	unlock = func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package xfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupProjectFiles(t *testing.T) (files projectFiles, cleanup func()) {
+	dir, err := ioutil.TempDir("", "projectfiles")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	files = projectFiles{
+		basePath:     "/mnt/xfs/volumes",
+		projectsPath: filepath.Join(dir, "projects"),
+		projIdPath:   filepath.Join(dir, "projid"),
+	}
+	cleanup = func() {
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestProjectFiles_writesEntriesSortedByPath(t *testing.T) {
+	files, cleanup := setupProjectFiles(t)
+	defer cleanup()
+
+	err := files.write(map[string]uint32{
+		"/mnt/xfs/volumes/def": 2,
+		"/mnt/xfs/volumes/abc": 1,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		"1:/mnt/xfs/volumes/abc\n2:/mnt/xfs/volumes/def\n",
+		readFile(t, files.projectsPath))
+	assert.Equal(t,
+		"abc:1\ndef:2\n",
+		readFile(t, files.projIdPath))
+}
+
+func TestProjectFiles_preservesForeignEntries(t *testing.T) {
+	files, cleanup := setupProjectFiles(t)
+	defer cleanup()
+
+	err := ioutil.WriteFile(files.projectsPath, []byte(
+		"# managed by hand\n"+
+			"100:/srv/data\n"+
+			"5:/mnt/xfs/volumes/stale\n"), 0640)
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(files.projIdPath, []byte(
+		"data:100\n"+
+			"stale:5\n"), 0640)
+	assert.NoError(t, err)
+
+	err = files.write(map[string]uint32{
+		"/mnt/xfs/volumes/abc": 1,
+		"/mnt/xfs/other/xyz":   7,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		"# managed by hand\n100:/srv/data\n1:/mnt/xfs/volumes/abc\n",
+		readFile(t, files.projectsPath))
+	assert.Equal(t,
+		"data:100\nabc:1\n",
+		readFile(t, files.projIdPath))
+
+	finfo, err := os.Stat(files.projectsPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), finfo.Mode().Perm())
+}
+
+func TestProjectFiles_dropsReleasedProjects(t *testing.T) {
+	files, cleanup := setupProjectFiles(t)
+	defer cleanup()
+
+	err := files.write(map[string]uint32{
+		"/mnt/xfs/volumes/abc": 1,
+		"/mnt/xfs/volumes/def": 2,
+	})
+	assert.NoError(t, err)
+
+	files.projectsPath = ""
+
+	err = files.write(map[string]uint32{
+		"/mnt/xfs/volumes/abc": 1,
+	}, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		"abc:1\n",
+		readFile(t, files.projIdPath))
+}
+
+func TestProjectFiles_doesNothingIfDisabled(t *testing.T) {
+	files, cleanup := setupProjectFiles(t)
+	defer cleanup()
+
+	files.projectsPath = ""
+	files.projIdPath = ""
+
+	err := files.write(map[string]uint32{
+		"/mnt/xfs/volumes/abc": 1,
+	})
+	assert.NoError(t, err)
+}
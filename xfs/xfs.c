@@ -1,26 +1,53 @@
+// +build cgo,!nocgo
+
 #include "./xfs.h"
 
 int
-xfs_is_quota_enabled(const char* fs_block_dev)
+xfs_get_quota_state(const char* fs_block_dev, struct fs_quota_statv* statv)
 {
-	int                   ret   = 0;
-	struct fs_quota_statv statv = {.qs_version = FS_QSTATV_VERSION1 };
+	int ret = 0;
 	enum { ERR         = -1,
-	       ENABLED     = 0,
-	       NOT_ENABLED = 1,
+	       OK          = 0,
+	       UNSUPPORTED = 1,
 	};
 
+	memset(statv, 0, sizeof(*statv));
+	statv->qs_version = FS_QSTATV_VERSION1;
+
 	ret = quotactl(
-	  QCMD(Q_XGETQSTATV, PRJQUOTA), fs_block_dev, 0, (void*)&statv);
+	  QCMD(Q_XGETQSTATV, PRJQUOTA), fs_block_dev, 0, (void*)statv);
 	if (ret == -1) {
 		if (errno == ENOSYS || errno == EINVAL) {
 			errno = 0;
-			return NOT_ENABLED;
+			memset(statv, 0, sizeof(*statv));
+			return UNSUPPORTED;
 		}
 
 		return ERR;
 	}
 
+	return OK;
+}
+
+int
+xfs_is_quota_enabled(const char* fs_block_dev)
+{
+	int                   ret   = 0;
+	struct fs_quota_statv statv = { 0 };
+	enum { ERR         = -1,
+	       ENABLED     = 0,
+	       NOT_ENABLED = 1,
+	};
+
+	ret = xfs_get_quota_state(fs_block_dev, &statv);
+	if (ret == -1) {
+		return ERR;
+	}
+
+	if (ret == 1) {
+		return NOT_ENABLED;
+	}
+
 	if (statv.qs_flags & (FS_QUOTA_PDQ_ACCT | FS_QUOTA_PDQ_ENFD)) {
 		return ENABLED;
 	}
@@ -39,9 +66,9 @@ xfs_set_project_quota(const char*  fs_block_dev,
 		.d_id            = project_id,
 		.d_flags         = XFS_PROJ_QUOTA,
 		.d_blk_hardlimit = quota->size / BASIC_BLOCK_SIZE,
-		.d_blk_softlimit = quota->size / BASIC_BLOCK_SIZE,
+		.d_blk_softlimit = quota->soft_size / BASIC_BLOCK_SIZE,
 		.d_ino_hardlimit = quota->inodes,
-		.d_ino_softlimit = quota->inodes,
+		.d_ino_softlimit = quota->soft_inodes,
 		.d_fieldmask =
 		  FS_DQ_BHARD | FS_DQ_BSOFT | FS_DQ_ISOFT | FS_DQ_IHARD,
 	};
@@ -57,6 +84,23 @@ xfs_set_project_quota(const char*  fs_block_dev,
 	return 0;
 }
 
+/**
+ * Fills a quota configuration from the disk quota
+ * retrieved from the kernel.
+ */
+static void
+xfs_quota_from_disk_quota(xfs_quota_t* quota, fs_disk_quota_t* disk_quota)
+{
+	quota->size         = disk_quota->d_blk_hardlimit * BASIC_BLOCK_SIZE;
+	quota->soft_size    = disk_quota->d_blk_softlimit * BASIC_BLOCK_SIZE;
+	quota->inodes       = disk_quota->d_ino_hardlimit;
+	quota->soft_inodes  = disk_quota->d_ino_softlimit;
+	quota->used_size    = disk_quota->d_bcount * BASIC_BLOCK_SIZE;
+	quota->used_inodes  = disk_quota->d_icount;
+	quota->size_timer   = disk_quota->d_btimer;
+	quota->inodes_timer = disk_quota->d_itimer;
+}
+
 int
 xfs_get_project_quota(const char*  fs_block_dev,
                       __u32        project_id,
@@ -73,10 +117,102 @@ xfs_get_project_quota(const char*  fs_block_dev,
 		return -1;
 	}
 
-	quota->size        = disk_quota.d_blk_hardlimit * BASIC_BLOCK_SIZE;
-	quota->inodes      = disk_quota.d_ino_hardlimit;
-	quota->used_size   = disk_quota.d_bcount * BASIC_BLOCK_SIZE;
-	quota->used_inodes = disk_quota.d_icount;
+	xfs_quota_from_disk_quota(quota, &disk_quota);
+
+	return 0;
+}
+
+int
+xfs_get_next_project_quota(const char*  fs_block_dev,
+                           __u32        project_id,
+                           __u32*       next_project_id,
+                           xfs_quota_t* quota)
+{
+	int             err        = 0;
+	fs_disk_quota_t disk_quota = { 0 };
+	enum { ERR     = -1,
+	       FOUND   = 0,
+	       NO_MORE = 1,
+	};
+
+	/**
+	 * ENOENT is used by the kernel to indicate that there
+	 * are no more ids, thus, make sure that it can't come
+	 * from an inexistent block device.
+	 */
+	err = access(fs_block_dev, F_OK);
+	if (err == -1) {
+		return ERR;
+	}
+
+	err = quotactl(QCMD(Q_XGETNEXTQUOTA, PRJQUOTA),
+	               fs_block_dev,
+	               project_id,
+	               (void*)&disk_quota);
+	if (err == -1) {
+		if (errno == ENOENT) {
+			errno = 0;
+			return NO_MORE;
+		}
+
+		return ERR;
+	}
+
+	*next_project_id = disk_quota.d_id;
+	xfs_quota_from_disk_quota(quota, &disk_quota);
+
+	return FOUND;
+}
+
+int
+xfs_get_project_grace_periods(const char*          fs_block_dev,
+                              xfs_grace_periods_t* grace_periods)
+{
+	int                   err   = 0;
+	struct fs_quota_statv statv = {.qs_version = FS_QSTATV_VERSION1 };
+
+	err = quotactl(
+	  QCMD(Q_XGETQSTATV, PRJQUOTA), fs_block_dev, 0, (void*)&statv);
+	if (err == -1) {
+		return -1;
+	}
+
+	grace_periods->size   = statv.qs_btimelimit;
+	grace_periods->inodes = statv.qs_itimelimit;
+
+	return 0;
+}
+
+int
+xfs_set_project_grace_periods(const char*          fs_block_dev,
+                              xfs_grace_periods_t* grace_periods)
+{
+	int             err        = 0;
+	fs_disk_quota_t disk_quota = {
+		.d_version = FS_DQUOT_VERSION,
+		.d_id      = 0,
+		.d_flags   = XFS_PROJ_QUOTA,
+		.d_btimer  = grace_periods->size,
+		.d_itimer  = grace_periods->inodes,
+	};
+
+	if (grace_periods->size != 0) {
+		disk_quota.d_fieldmask |= FS_DQ_BTIMER;
+	}
+
+	if (grace_periods->inodes != 0) {
+		disk_quota.d_fieldmask |= FS_DQ_ITIMER;
+	}
+
+	if (disk_quota.d_fieldmask == 0) {
+		return 0;
+	}
+
+	err = quotactl(
+	  QCMD(Q_XSETQLIM, PRJQUOTA), fs_block_dev, 0, (void*)&disk_quota);
+	if (err == -1) {
+		return -1;
+	}
 
 	return 0;
 }
@@ -106,6 +242,32 @@ xfs_get_project_id(const char* dir)
 	return fs_xattr.fsx_projid;
 }
 
+int
+xfs_get_fs_geometry_flags(const char* dir, __u32* flags)
+{
+	int                     err = 0;
+	int                     save_errno;
+	int                     dir_fd;
+	struct xfs_fsop_geom_v1 geometry = { 0 };
+
+	dir_fd = open(dir, O_RDONLY | O_DIRECTORY);
+	if (dir_fd == -1) {
+		return -1;
+	}
+
+	err = ioctl(dir_fd, XFS_IOC_FSGEOMETRY_V1, &geometry);
+	if (err == -1) {
+		save_errno = errno;
+		close(dir_fd);
+		errno = save_errno;
+		return -1;
+	}
+
+	close(dir_fd);
+	*flags = geometry.flags;
+	return 0;
+}
+
 int
 xfs_set_project_id(const char* dir, __u32 project_id)
 {
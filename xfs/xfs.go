@@ -1,10 +1,12 @@
 package xfs
 
-// #include "./xfs.h"
-import "C"
-
 import (
-	"unsafe"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -16,17 +18,57 @@ import (
 // to display how much of the quotah as been used so far.
 type Quota struct {
 	// Size represents total size that can be commited
-	// to a tree of directories under this quota.
+	// to a tree of directories under this quota (hard limit).
 	Size uint64
 
-	// INode tells the maximum number of INodes that can be created;
+	// SoftSize represents the size after which the
+	// project is considered over quota (soft limit).
+	//
+	// Writes are still allowed past it until `Size` is
+	// reached.
+	SoftSize uint64
+
+	// INode tells the maximum number of INodes that can be
+	// created (hard limit).
 	INode uint64
 
+	// SoftINode tells the number of INodes after which the
+	// project is considered over quota (soft limit).
+	SoftINode uint64
+
 	// UsedSize is the disk size that has been used under quota;
 	UsedSize uint64
 
 	// UsedINode is the number of INodes that used so far.
 	UsedInode uint64
+
+	// SizeGraceExpiresAt indicates when the grace period for
+	// the soft size limit expires (after which writes fail).
+	//
+	// It's the zero time if the soft limit hasn't been exceeded.
+	SizeGraceExpiresAt time.Time
+
+	// INodeGraceExpiresAt indicates when the grace period for
+	// the soft inode limit expires.
+	//
+	// It's the zero time if the soft limit hasn't been exceeded.
+	INodeGraceExpiresAt time.Time
+}
+
+// MaxGracePeriod is the longest grace period that can be set: the
+// kernel stores grace periods as a signed 32-bit number of seconds.
+const MaxGracePeriod = math.MaxInt32 * time.Second
+
+// GracePeriods defines for how long soft limits can be exceeded
+// by projects before they start being enforced as hard limits.
+//
+// These are filesystem-wide, applying to every project.
+type GracePeriods struct {
+	// Size is the grace period for the soft size limit.
+	Size time.Duration
+
+	// INode is the grace period for the soft inode limit.
+	INode time.Duration
 }
 
 // SetProjectQuota sets quota settings associated with a given
@@ -37,29 +79,133 @@ type Quota struct {
 //
 // 0 values are meant to indicate that there's no quota (i.e, no
 // limits).
+//
+// Soft limits must not be greater than their corresponding
+// hard limits (when these are set).
 func SetProjectQuota(blockDevice string, projectId uint32, q *Quota) (err error) {
 	if blockDevice == "" {
 		err = errors.Errorf("blockDevice must be specified")
 		return
 	}
 
-	var (
-		blockDeviceString = C.CString(blockDevice)
-		quota             = &C.struct_xfs_quota{
-			inodes: C.__u64(q.INode),
-			size:   C.__u64(q.Size),
-		}
-	)
-	defer C.free(unsafe.Pointer(blockDeviceString))
+	err = ValidateQuota(q)
+	if err != nil {
+		return
+	}
 
-	ret, err := C.xfs_set_project_quota(blockDeviceString,
-		C.__u32(projectId),
-		quota)
-	if ret == -1 {
-		err = errors.Wrapf(err,
+	err = ops.setProjectQuota(blockDevice, projectId, q)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, projectId),
 			"failed to set project quota "+
-				"prj=%d dev=%d quota-size=%d quota-inodes=%d",
-			projectId, blockDevice, q.Size, q.INode)
+				"prj=%d dev=%s quota-size=%d quota-soft-size=%d "+
+				"quota-inodes=%d quota-soft-inodes=%d",
+			projectId, blockDevice, q.Size, q.SoftSize,
+			q.INode, q.SoftINode)
+		return
+	}
+
+	return
+}
+
+// QuotaFile describes the hidden file that a filesystem uses
+// to store the quota records of a given type (user, group or
+// project).
+type QuotaFile struct {
+	// INode is the inode number of the quota file.
+	INode uint64
+
+	// Blocks is the number of 512-byte blocks used by
+	// the quota file.
+	Blocks uint64
+
+	// Extents is the number of extents of the quota file.
+	Extents uint32
+}
+
+// QuotaTypeState describes the state of a given type
+// of quota (user, group or project) in a filesystem.
+type QuotaTypeState struct {
+	// Accounting indicates whether usage is being tracked.
+	Accounting bool
+
+	// Enforcement indicates whether limits are being enforced.
+	Enforcement bool
+
+	// File describes the file that keeps the quota records.
+	File QuotaFile
+}
+
+// QuotaState describes the quota state of a whole filesystem
+// as reported by `Q_XGETQSTATV`.
+//
+// A quota type is considered "off" if it has neither accounting
+// nor enforcement turned on.
+type QuotaState struct {
+	User    QuotaTypeState
+	Group   QuotaTypeState
+	Project QuotaTypeState
+
+	// IncoreDquots is the number of dquots that are
+	// currently in memory.
+	IncoreDquots uint32
+
+	// GracePeriods are the default grace periods applied
+	// when soft limits are exceeded.
+	GracePeriods GracePeriods
+
+	// SizeWarnLimit is the default limit on the number of
+	// warnings issued for going past the soft size limit.
+	SizeWarnLimit uint16
+
+	// INodeWarnLimit is the default limit on the number of
+	// warnings issued for going past the soft inode limit.
+	INodeWarnLimit uint16
+}
+
+// GetQuotaState retrieves the full quota state of the filesystem
+// controlled by a given block device.
+//
+// Filesystems that don't support quotas at all are reported as
+// having every quota type off.
+func GetQuotaState(blockDevice string) (state *QuotaState, err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	state, err = ops.getQuotaState(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
+			"failed to retrieve quota state for dev %s",
+			blockDevice)
+		return
+	}
+
+	return
+}
+
+// ValidateQuota verifies whether the limits of a given quota
+// are coherent, i.e., soft limits don't go past hard limits.
+//
+// A hard limit of 0 means "no limit", thus any soft limit
+// is accepted in that case.
+func ValidateQuota(q *Quota) (err error) {
+	if q == nil {
+		err = errors.Errorf("quota must be specified")
+		return
+	}
+
+	if q.Size != 0 && q.SoftSize > q.Size {
+		err = errors.Errorf(
+			"soft size limit (%d) can't be greater than hard limit (%d)",
+			q.SoftSize, q.Size)
+		return
+	}
+
+	if q.INode != 0 && q.SoftINode > q.INode {
+		err = errors.Errorf(
+			"soft inode limit (%d) can't be greater than hard limit (%d)",
+			q.SoftINode, q.INode)
 		return
 	}
 
@@ -75,21 +221,41 @@ func IsQuotaEnabled(blockDevice string) (isEnabled bool, err error) {
 		return
 	}
 
-	var blockDeviceString = C.CString(blockDevice)
-	defer C.free(unsafe.Pointer(blockDeviceString))
-
-	ret, err := C.xfs_is_quota_enabled(blockDeviceString)
-	switch ret {
-	case -1:
-		err = errors.Wrapf(err,
+	state, err := ops.getQuotaState(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
 			"failed to check whether quota is enabled for dev %s",
 			blockDevice)
 		return
-	case 0:
-		isEnabled = true
-	default:
 	}
 
+	isEnabled = state.Project.Accounting || state.Project.Enforcement
+	return
+}
+
+// xfsFsopGeomFlagsFtype corresponds to the geometry flag
+// (`XFS_FSOP_GEOM_FLAGS_FTYPE`) that indicates that the
+// filesystem stores the type of files in directory entries.
+const xfsFsopGeomFlagsFtype = 0x10000
+
+// IsFtypeEnabled checks whether the xfs filesystem holding a
+// given directory has been formatted with `ftype=1`, i.e.,
+// whether it supports `d_type` in directory entries.
+func IsFtypeEnabled(directory string) (isEnabled bool, err error) {
+	if directory == "" {
+		err = errors.Errorf("directory must be specified")
+		return
+	}
+
+	flags, err := ops.getFsGeometryFlags(directory)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"failed to retrieve xfs geometry of directory %s",
+			directory)
+		return
+	}
+
+	isEnabled = flags&xfsFsopGeomFlagsFtype != 0
 	return
 }
 
@@ -104,27 +270,190 @@ func GetProjectQuota(blockDevice string, projectId uint32) (q *Quota, err error)
 		return
 	}
 
-	var (
-		blockDeviceString = C.CString(blockDevice)
-		quota             = new(C.struct_xfs_quota)
-	)
-	defer C.free(unsafe.Pointer(blockDeviceString))
-
-	ret, err := C.xfs_get_project_quota(blockDeviceString,
-		C.__u32(projectId),
-		quota)
-	if ret == -1 {
-		err = errors.Wrapf(err,
+	q, err = ops.getProjectQuota(blockDevice, projectId)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, projectId),
 			"failed to retrieve project quota - prj=%d dev=%s",
 			projectId, blockDevice)
 		return
 	}
 
-	q = new(Quota)
-	q.INode = uint64(quota.inodes)
-	q.Size = uint64(quota.size)
-	q.UsedInode = uint64(quota.used_inodes)
-	q.UsedSize = uint64(quota.used_size)
+	return
+}
+
+// ProjectQuota associates a quota (limits and usage) with
+// the project it belongs to.
+type ProjectQuota struct {
+	ProjectId uint32
+	Quota
+}
+
+// ProjectQuotaIterator iterates over every project that has a
+// quota record (dquot) in the filesystem controlled by a given
+// block device, in ascending order of project id.
+//
+// Project id 0 is skipped as it holds the filesystem defaults
+// rather than the limits of an actual project.
+//
+// Usage:
+//
+//	it := xfs.NewProjectQuotaIterator(blockDevice)
+//	for it.Next() {
+//		pq := it.ProjectQuota()
+//		...
+//	}
+//	if it.Err() != nil {
+//		...
+//	}
+type ProjectQuotaIterator struct {
+	blockDevice string
+	nextId      uint32
+	done        bool
+	current     ProjectQuota
+	err         error
+
+	// getNext retrieves the first project quota with an
+	// id greater than or equal to the supplied one.
+	getNext func(blockDevice string, projectId uint32) (uint32, *Quota, bool, error)
+}
+
+// NewProjectQuotaIterator creates an iterator over the project
+// quotas of the XFS filesystem controlled by a given block device.
+func NewProjectQuotaIterator(blockDevice string) (it *ProjectQuotaIterator) {
+	it = newProjectQuotaIterator(blockDevice, ops.getNextProjectQuota)
+	return
+}
+
+// newProjectQuotaIterator creates an iterator that retrieves
+// project quotas with a given function.
+func newProjectQuotaIterator(
+	blockDevice string,
+	getNext func(string, uint32) (uint32, *Quota, bool, error),
+) (it *ProjectQuotaIterator) {
+	it = &ProjectQuotaIterator{
+		blockDevice: blockDevice,
+		nextId:      1,
+		getNext:     getNext,
+	}
+
+	if blockDevice == "" {
+		it.err = errors.Errorf("blockDevice must be specified")
+		it.done = true
+	}
+
+	return
+}
+
+// Next advances the iterator to the next project quota, returning
+// false when there are no more projects or an error occurred.
+func (it *ProjectQuotaIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	projectId, quota, found, err := it.getNext(it.blockDevice, it.nextId)
+	if err != nil {
+		it.err = errors.Wrapf(newQuotaError(err, it.blockDevice, it.nextId),
+			"failed to retrieve next project quota - prj>=%d dev=%s",
+			it.nextId, it.blockDevice)
+		it.done = true
+		return false
+	}
+
+	if !found {
+		it.done = true
+		return false
+	}
+
+	it.current = ProjectQuota{
+		ProjectId: projectId,
+		Quota:     *quota,
+	}
+
+	if it.current.ProjectId == math.MaxUint32 {
+		it.done = true
+	} else {
+		it.nextId = it.current.ProjectId + 1
+	}
+
+	return true
+}
+
+// ProjectQuota retrieves the project quota that the iterator
+// currently points to.
+func (it *ProjectQuotaIterator) ProjectQuota() ProjectQuota {
+	return it.current
+}
+
+// Err returns the error (if any) that interrupted the iteration.
+func (it *ProjectQuotaIterator) Err() error {
+	return it.err
+}
+
+// ListProjectQuotas retrieves every project quota of the filesystem
+// controlled by a given block device.
+func ListProjectQuotas(blockDevice string) (quotas []ProjectQuota, err error) {
+	quotas, err = listProjectQuotas(NewProjectQuotaIterator(blockDevice))
+	return
+}
+
+// listProjectQuotas consumes an iterator, gathering every
+// project quota that it goes through.
+func listProjectQuotas(it *ProjectQuotaIterator) (quotas []ProjectQuota, err error) {
+	for it.Next() {
+		quotas = append(quotas, it.ProjectQuota())
+	}
+
+	err = it.Err()
+	return
+}
+
+// GetProjectGracePeriods retrieves the filesystem-wide grace periods
+// applied to project quotas of the filesystem controlled by a given
+// block device.
+func GetProjectGracePeriods(blockDevice string) (g *GracePeriods, err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	g, err = ops.getProjectGracePeriods(blockDevice)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
+			"failed to retrieve project grace periods - dev=%s",
+			blockDevice)
+		return
+	}
+
+	return
+}
+
+// SetProjectGracePeriods sets the filesystem-wide grace periods
+// applied to project quotas of the filesystem controlled by a given
+// block device.
+//
+// Periods are truncated to seconds and must be between a second
+// and `MaxGracePeriod`. 0 values are meant to indicate that the
+// current grace period should be kept.
+func SetProjectGracePeriods(blockDevice string, g *GracePeriods) (err error) {
+	if blockDevice == "" {
+		err = errors.Errorf("blockDevice must be specified")
+		return
+	}
+
+	err = validateGracePeriods(g)
+	if err != nil {
+		return
+	}
+
+	err = ops.setProjectGracePeriods(blockDevice, g)
+	if err != nil {
+		err = errors.Wrapf(newQuotaError(err, blockDevice, 0),
+			"failed to set project grace periods "+
+				"dev=%s size-period=%s inode-period=%s",
+			blockDevice, g.Size, g.INode)
+		return
+	}
 
 	return
 }
@@ -137,18 +466,14 @@ func GetProjectId(directory string) (projectId uint32, err error) {
 		return
 	}
 
-	var directoryString = C.CString(directory)
-	defer C.free(unsafe.Pointer(directoryString))
-
-	ret, err := C.xfs_get_project_id(directoryString)
-	if ret == -1 {
+	projectId, err = ops.getProjectId(directory)
+	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to get project-id from directory %s",
 			directory)
 		return
 	}
 
-	projectId = uint32(ret)
 	return
 }
 
@@ -160,11 +485,8 @@ func SetProjectId(directory string, projectId uint32) (err error) {
 		return
 	}
 
-	var directoryString = C.CString(directory)
-	defer C.free(unsafe.Pointer(directoryString))
-
-	ret, err := C.xfs_set_project_id(directoryString, C.__u32(projectId))
-	if ret == -1 {
+	err = ops.setProjectId(directory, projectId)
+	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to set project-id %d to directory %s",
 			projectId, directory)
@@ -174,29 +496,71 @@ func SetProjectId(directory string, projectId uint32) (err error) {
 	return
 }
 
+// backingFsDevSeq makes the temporary names of the block devices
+// being created unique within the process.
+var backingFsDevSeq uint64
+
 // MakeBackingFsDev creates a block device under the directory
 // specified in the `root` argument.
+//
+// The device is created under a temporary name and then renamed
+// into place, such that other processes issuing calls against an
+// existing device with the same name (e.g., `xfsvolctl` against
+// the root of a running plugin) never find it missing.
 func MakeBackingFsDev(root, file string) (err error) {
 	if root == "" || file == "" {
 		err = errors.Errorf("root and file must be provided")
 		return
 	}
 
-	var (
-		rootString = C.CString(root)
-		fileString = C.CString(file)
-	)
-
-	defer C.free(unsafe.Pointer(rootString))
-	defer C.free(unsafe.Pointer(fileString))
+	var tmpFile = fmt.Sprintf("%s.tmp-%d-%d",
+		file, os.Getpid(), atomic.AddUint64(&backingFsDevSeq, 1))
 
-	ret, err := C.xfs_create_fs_block_dev(rootString, fileString)
-	if ret == -1 {
+	err = ops.makeBackingFsDev(root, tmpFile)
+	if err != nil {
 		err = errors.Wrapf(err,
 			"failed to create fs block device %s/%s",
 			root, file)
 		return
 	}
 
+	err = os.Rename(filepath.Join(root, tmpFile), filepath.Join(root, file))
+	if err != nil {
+		os.Remove(filepath.Join(root, tmpFile))
+		err = errors.Wrapf(err,
+			"failed to move fs block device into %s/%s",
+			root, file)
+		return
+	}
+
+	return
+}
+
+// validateGracePeriods verifies whether grace periods can be
+// represented by the kernel (non-negative numbers of seconds
+// that fit in 32 bits).
+//
+// Periods shorter than a second are refused as they'd get
+// truncated to 0, which the kernel takes as "keep the current
+// period".
+func validateGracePeriods(g *GracePeriods) (err error) {
+	if g.Size < 0 || g.INode < 0 {
+		err = errors.Errorf("grace periods can't be negative")
+		return
+	}
+
+	if (g.Size > 0 && g.Size < time.Second) ||
+		(g.INode > 0 && g.INode < time.Second) {
+		err = errors.Errorf(
+			"grace periods can't be shorter than %s", time.Second)
+		return
+	}
+
+	if g.Size > MaxGracePeriod || g.INode > MaxGracePeriod {
+		err = errors.Errorf(
+			"grace periods can't be longer than %s", MaxGracePeriod)
+		return
+	}
+
 	return
 }
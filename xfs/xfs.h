@@ -61,17 +61,47 @@
 #define XFS_PROJ_QUOTA 2
 #endif
 
+#ifndef XFS_FSOP_GEOM_FLAGS_FTYPE
+#define XFS_FSOP_GEOM_FLAGS_FTYPE 0x10000
+#endif
+
+#ifndef Q_XGETNEXTQUOTA
+#define Q_XGETNEXTQUOTA XQM_CMD(9)
+#endif
+
 /**
  * Provides the configuration to be used when
  * invoking the xfs getter and setter commands.
+ *
+ * `size` and `inodes` correspond to the hard limits
+ * while `soft_size` and `soft_inodes` correspond to
+ * the soft limits.
+ *
+ * `size_timer` and `inodes_timer` are only filled by
+ * getters and hold the time (seconds since epoch) at
+ * which the soft limit grace period expires (0 if no
+ * soft limit has been exceeded).
  */
 typedef struct xfs_quota {
 	__u64 size;
+	__u64 soft_size;
 	__u64 inodes;
+	__u64 soft_inodes;
 	__u64 used_size;
 	__u64 used_inodes;
+	__s64 size_timer;
+	__s64 inodes_timer;
 } xfs_quota_t;
 
+/**
+ * Filesystem-wide grace periods (in seconds) applied
+ * to project quotas once a soft limit is exceeded.
+ */
+typedef struct xfs_grace_periods {
+	__s32 size;
+	__s32 inodes;
+} xfs_grace_periods_t;
+
 /**
  * Sets the project quota for a given path as
  * specified in the arguments provided via the
@@ -99,6 +129,50 @@ xfs_get_project_quota(const char*  fs_block_dev,
                       __u32        project_id,
                       xfs_quota_t* quota);
 
+/**
+ * Retrieves the quota configuration of the first project
+ * that has an id greater than or equal to `project_id`
+ * (as controlled by a specified backing fs block device).
+ *
+ * The id of the project found is stored in `next_project_id`
+ * and its quota in `quota`.
+ *
+ * Returns:
+ *      - -1 in case of errors;
+ *      - 0 if a project has been found;
+ *      - 1 if there are no more projects.
+ */
+int
+xfs_get_next_project_quota(const char*  fs_block_dev,
+                           __u32        project_id,
+                           __u32*       next_project_id,
+                           xfs_quota_t* quota);
+
+/**
+ * Retrieves the filesystem-wide project quota grace
+ * periods of the filesystem controlled by `fs_block_dev`.
+ *
+ * Returns -1 in case of errors.
+ */
+int
+xfs_get_project_grace_periods(const char*          fs_block_dev,
+                              xfs_grace_periods_t* grace_periods);
+
+/**
+ * Sets the filesystem-wide project quota grace periods
+ * of the filesystem controlled by `fs_block_dev`.
+ *
+ * This is done by setting the timers of the project
+ * with id 0 (which holds the defaults).
+ *
+ * Fields set to 0 are left untouched.
+ *
+ * Returns -1 in case of errors.
+ */
+int
+xfs_set_project_grace_periods(const char*          fs_block_dev,
+                              xfs_grace_periods_t* grace_periods);
+
 /**
  * Sets the project_id of a given directory.
  *
@@ -116,6 +190,19 @@ xfs_set_project_id(const char* dir, __u32 project_id);
 int
 xfs_get_project_id(const char* dir);
 
+/**
+ * Retrieves the feature flags (XFS_FSOP_GEOM_FLAGS_*) of
+ * the xfs filesystem that holds `dir`, storing them in
+ * `flags`.
+ *
+ * The v1 geometry ioctl is used as it's supported by
+ * every kernel (newer versions of the structure aren't).
+ *
+ * Returns -1 in case of errors.
+ */
+int
+xfs_get_fs_geometry_flags(const char* dir, __u32* flags);
+
 /**
  * Verifies whether the filesystem has been mounted
  * with quota capabilities.
@@ -135,6 +222,20 @@ xfs_get_project_id(const char* dir);
 int
 xfs_is_quota_enabled(const char* fs_block_dev);
 
+/**
+ * Retrieves the quota state of the filesystem controlled
+ * by `fs_block_dev` by making use of the XGETQSTATV
+ * quotactl call, filling the `statv` reference.
+ *
+ * Returns:
+ *      - -1 in case of unexpected errors;
+ *      - 0 if the state could be retrieved;
+ *      - 1 if the filesystem doesn't support quotas at
+ *        all (`statv` is left zeroed).
+ */
+int
+xfs_get_quota_state(const char* fs_block_dev, struct fs_quota_statv* statv);
+
 /**
  * Creates the filesystem block device to control
  * xfs quotas under a given root.
@@ -4,9 +4,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
 	utils "github.com/cirocosta/xfsvol/test_utils"
@@ -309,6 +312,53 @@ func TestMakeBackingFsDev_succeedsIfAlreadyExists(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestMakeBackingFsDev_neverLeavesDeviceMissing(t *testing.T) {
+	root, err := setupTestFs("", []string{"/dir"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		dir    = filepath.Join(root, "/dir")
+		device = filepath.Join(dir, "device")
+		wg     sync.WaitGroup
+		done   = make(chan struct{})
+	)
+
+	assert.NoError(t, xfs.MakeBackingFsDev(dir, "device"))
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, xfs.MakeBackingFsDev(dir, "device"))
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			files, err := ioutil.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, files, 1)
+			return
+		default:
+			_, err := os.Stat(device)
+			if !assert.NoError(t, err) {
+				<-done
+				return
+			}
+		}
+	}
+}
+
 func TestSetProjectQuota_failsIfBlockDeviceDoesntExist(t *testing.T) {
 	var (
 		fs                           = []string{"/dir"}
@@ -359,6 +409,66 @@ func TestSetProjectQuota_succeeds(t *testing.T) {
 	assert.Equal(t, expectedQuota.INode, actualQuota.INode)
 }
 
+func TestSetProjectQuota_setsSoftAndHardLimits(t *testing.T) {
+	var (
+		fs                   = []string{"/dir"}
+		projectId     uint32 = 998
+		expectedQuota        = &xfs.Quota{
+			Size:      2 << 20,
+			SoftSize:  1 << 20,
+			INode:     200,
+			SoftINode: 100,
+		}
+		actualQuota *xfs.Quota
+		blockDevice string
+	)
+
+	root, err := setupTestFs(xfsMountPath, fs)
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	blockDevice = filepath.Join(root, "block-device")
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	err = xfs.SetProjectId(filepath.Join(root, "dir"), projectId)
+	assert.NoError(t, err)
+
+	err = xfs.SetProjectQuota(blockDevice, projectId, expectedQuota)
+	assert.NoError(t, err)
+
+	actualQuota, err = xfs.GetProjectQuota(blockDevice, projectId)
+	assert.NoError(t, err)
+
+	assert.Equal(t, expectedQuota.Size, actualQuota.Size)
+	assert.Equal(t, expectedQuota.SoftSize, actualQuota.SoftSize)
+	assert.Equal(t, expectedQuota.INode, actualQuota.INode)
+	assert.Equal(t, expectedQuota.SoftINode, actualQuota.SoftINode)
+}
+
+func TestSetProjectQuota_failsIfSoftLimitAboveHardLimit(t *testing.T) {
+	var testCases = []struct {
+		desc  string
+		quota xfs.Quota
+	}{
+		{
+			desc:  "soft size above size",
+			quota: xfs.Quota{Size: 1 << 20, SoftSize: 2 << 20},
+		},
+		{
+			desc:  "soft inode above inode",
+			quota: xfs.Quota{INode: 10, SoftINode: 20},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := xfs.SetProjectQuota("/inexistent-block/_device", 999, &tc.quota)
+			assert.Error(t, err)
+		})
+	}
+}
+
 func TestGetProjectStats(t *testing.T) {
 	root, err := setupTestFs(xfsMountPath, []string{"/dir"})
 	assert.NoError(t, err)
@@ -402,6 +512,100 @@ func TestGetProjectStats(t *testing.T) {
 	assert.True(t, quota2.UsedSize > (1<<20))
 }
 
+func TestGetProjectQuota_reportsGraceExpiration(t *testing.T) {
+	root, err := setupTestFs(xfsMountPath, []string{"/dir"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		blockDevice        = filepath.Join(root, "block-device")
+		directory          = filepath.Join(root, "/dir")
+		projectId   uint32 = 334
+	)
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	err = xfs.SetProjectId(directory, projectId)
+	assert.NoError(t, err)
+
+	err = xfs.SetProjectQuota(blockDevice, projectId, &xfs.Quota{
+		INode:     100,
+		SoftINode: 10,
+	})
+	assert.NoError(t, err)
+
+	quota, err := xfs.GetProjectQuota(blockDevice, projectId)
+	assert.NoError(t, err)
+	assert.True(t, quota.INodeGraceExpiresAt.IsZero())
+
+	err = utils.CreateFiles(directory, 20)
+	assert.NoError(t, err)
+
+	quota, err = xfs.GetProjectQuota(blockDevice, projectId)
+	assert.NoError(t, err)
+	assert.True(t, quota.INodeGraceExpiresAt.After(time.Now()))
+	assert.True(t, quota.SizeGraceExpiresAt.IsZero())
+}
+
+func TestSetProjectGracePeriods(t *testing.T) {
+	root, err := setupTestFs(xfsMountPath, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	blockDevice := filepath.Join(root, "block-device")
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	original, err := xfs.GetProjectGracePeriods(blockDevice)
+	assert.NoError(t, err)
+	defer xfs.SetProjectGracePeriods(blockDevice, original)
+
+	err = xfs.SetProjectGracePeriods(blockDevice, &xfs.GracePeriods{
+		Size:  2 * time.Hour,
+		INode: 3 * time.Hour,
+	})
+	assert.NoError(t, err)
+
+	gracePeriods, err := xfs.GetProjectGracePeriods(blockDevice)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, gracePeriods.Size)
+	assert.Equal(t, 3*time.Hour, gracePeriods.INode)
+
+	err = xfs.SetProjectGracePeriods(blockDevice, &xfs.GracePeriods{
+		Size: 1 * time.Hour,
+	})
+	assert.NoError(t, err)
+
+	gracePeriods, err = xfs.GetProjectGracePeriods(blockDevice)
+	assert.NoError(t, err)
+	assert.Equal(t, 1*time.Hour, gracePeriods.Size)
+	assert.Equal(t, 3*time.Hour, gracePeriods.INode)
+}
+
+func TestSetProjectGracePeriods_failsIfNegative(t *testing.T) {
+	err := xfs.SetProjectGracePeriods("/inexistent-block/_device", &xfs.GracePeriods{
+		Size: -1 * time.Hour,
+	})
+	assert.Error(t, err)
+}
+
+func TestSetProjectGracePeriods_failsIfBelowOneSecond(t *testing.T) {
+	err := xfs.SetProjectGracePeriods("/inexistent-block/_device", &xfs.GracePeriods{
+		Size: 500 * time.Millisecond,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "shorter than")
+}
+
+func TestSetProjectGracePeriods_failsIfAboveMaximum(t *testing.T) {
+	err := xfs.SetProjectGracePeriods("/inexistent-block/_device", &xfs.GracePeriods{
+		INode: xfs.MaxGracePeriod + time.Second,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "longer than")
+}
+
 func TestIsQuotaEnabled_failsIfBlockDeviceDoesntExist(t *testing.T) {
 	_, err := xfs.IsQuotaEnabled("/inexistent-block/_device")
 	assert.Error(t, err)
@@ -444,3 +648,95 @@ func TestIsQuotaEnabled(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, isEnabled)
 }
+
+func TestGetQuotaState(t *testing.T) {
+	root, err := setupTestFs(xfsMountPath, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	state, err := xfs.GetQuotaState(filepath.Join(root, "block-device"))
+	assert.NoError(t, err)
+	assert.True(t, state.Project.Accounting)
+	assert.True(t, state.Project.Enforcement)
+	assert.NotZero(t, state.Project.File.INode)
+	assert.False(t, state.User.Accounting)
+	assert.False(t, state.Group.Accounting)
+}
+
+func TestGetQuotaState_quotaOffIfNoProjectQuotaSet(t *testing.T) {
+	root, err := setupTestFs(xfsMountPathWithoutQuota, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	state, err := xfs.GetQuotaState(filepath.Join(root, "block-device"))
+	assert.NoError(t, err)
+	assert.False(t, state.Project.Accounting)
+	assert.False(t, state.Project.Enforcement)
+}
+
+func TestGetQuotaState_failsIfBlockDeviceDoesntExist(t *testing.T) {
+	_, err := xfs.GetQuotaState("/inexistent-block/_device")
+	assert.Error(t, err)
+}
+
+func TestListProjectQuotas(t *testing.T) {
+	root, err := setupTestFs(xfsMountPath, []string{"/"})
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		blockDevice = filepath.Join(root, "block-device")
+		projectIds  = []uint32{4001, 4002, 4003}
+		found       = map[uint32]xfs.ProjectQuota{}
+	)
+
+	err = xfs.MakeBackingFsDev(root, "block-device")
+	assert.NoError(t, err)
+
+	for _, projectId := range projectIds {
+		err = xfs.SetProjectQuota(blockDevice, projectId, &xfs.Quota{
+			Size: uint64(projectId) << 12,
+		})
+		assert.NoError(t, err)
+	}
+	defer func() {
+		for _, projectId := range projectIds {
+			xfs.SetProjectQuota(blockDevice, projectId, &xfs.Quota{})
+		}
+	}()
+
+	quotas, err := xfs.ListProjectQuotas(blockDevice)
+	assert.NoError(t, err)
+
+	for ndx, quota := range quotas {
+		assert.NotZero(t, quota.ProjectId)
+		if ndx > 0 {
+			assert.True(t, quota.ProjectId > quotas[ndx-1].ProjectId)
+		}
+
+		found[quota.ProjectId] = quota
+	}
+
+	for _, projectId := range projectIds {
+		quota, ok := found[projectId]
+		assert.True(t, ok)
+		assert.Equal(t, uint64(projectId)<<12, quota.Size)
+	}
+}
+
+func TestListProjectQuotas_failsIfBlockDeviceDoesntExist(t *testing.T) {
+	_, err := xfs.ListProjectQuotas("/inexistent-block/_device")
+	assert.Error(t, err)
+}
+
+func TestGetProjectQuota_failsWithInvalidBlockDevice(t *testing.T) {
+	_, err := xfs.GetProjectQuota("/inexistent/block-device", 1)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, xfs.ErrInvalidBlockDevice))
+}
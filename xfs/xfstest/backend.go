@@ -0,0 +1,418 @@
+// xfstest provides an in-memory implementation of the quota
+// operations performed by `xfs.Control` so that code built on top
+// of project quotas can be tested without an XFS filesystem (and
+// without root privileges).
+package xfstest
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultGracePeriod is the grace period that the backend
+	// starts with for both size and inode soft limits (the same
+	// as XFS' default).
+	DefaultGracePeriod = 7 * 24 * time.Hour
+
+	// SizeGranularity is the unit (in bytes) in which the
+	// backend stores size limits, rounding requested ones down
+	// to a multiple of it just like XFS does with its 512 byte
+	// basic blocks.
+	SizeGranularity = 512
+)
+
+// Backend simulates the project quotas of a filesystem in memory.
+//
+// Directories still need to exist in the real filesystem for them
+// to get a project id, but the usage of each project is only
+// changed by calling `Use`, which enforces the limits the same way
+// that XFS would.
+//
+// It's safe for concurrent use.
+type Backend struct {
+	mu sync.Mutex
+
+	nextProjectId uint32
+	gracePeriods  xfs.GracePeriods
+	projectIds    map[string]uint32
+	quotas        map[uint32]*xfs.Quota
+}
+
+// NewBackend creates a backend with no projects.
+func NewBackend() (b *Backend) {
+	b = &Backend{
+		nextProjectId: xfs.DefaultMinProjectId,
+		gracePeriods: xfs.GracePeriods{
+			Size:  DefaultGracePeriod,
+			INode: DefaultGracePeriod,
+		},
+		projectIds: make(map[string]uint32),
+		quotas:     make(map[uint32]*xfs.Quota),
+	}
+	return
+}
+
+// AssignProjectId retrieves the project id associated with
+// a targetPath, assigning a fresh one to it in case it has none.
+func (b *Backend) AssignProjectId(targetPath string) (projectId uint32, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, err = b.assignProjectId(targetPath)
+	return
+}
+
+func (b *Backend) assignProjectId(targetPath string) (projectId uint32, err error) {
+	projectId, ok := b.projectIds[targetPath]
+	if ok {
+		return
+	}
+
+	finfo, err := os.Stat(targetPath)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"couldn't set project id to path %s", targetPath)
+		return
+	}
+
+	if !finfo.IsDir() {
+		err = errors.Errorf(
+			"couldn't set project id to path %s - not a directory",
+			targetPath)
+		return
+	}
+
+	projectId = b.nextProjectId
+	b.nextProjectId++
+	b.projectIds[targetPath] = projectId
+	return
+}
+
+// GetProjectId retrieves the project id associated with a
+// targetPath that previously had a quota set for it.
+func (b *Backend) GetProjectId(targetPath string) (projectId uint32, found bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, found = b.projectIds[targetPath]
+	return
+}
+
+// SetQuota assigns a unique project id to a directory and then
+// sets the limits of that project, keeping its current usage.
+func (b *Backend) SetQuota(targetPath string, quota xfs.Quota) (err error) {
+	err = xfs.ValidateQuota(&quota)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, err := b.assignProjectId(targetPath)
+	if err != nil {
+		return
+	}
+
+	current, ok := b.quotas[projectId]
+	if !ok {
+		current = &xfs.Quota{}
+		b.quotas[projectId] = current
+	}
+
+	current.Size = quota.Size / SizeGranularity * SizeGranularity
+	current.SoftSize = quota.SoftSize / SizeGranularity * SizeGranularity
+	current.INode = quota.INode
+	current.SoftINode = quota.SoftINode
+	return
+}
+
+// GetQuota retrieves the quota (limits and usage) associated
+// with a targetPath that previously had a quota set for it.
+func (b *Backend) GetQuota(targetPath string) (q *xfs.Quota, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, ok := b.projectIds[targetPath]
+	if !ok {
+		err = errors.Wrapf(xfs.ErrNoProjectId,
+			"couldn't retrieve quota of path %s",
+			targetPath)
+		return
+	}
+
+	current, ok := b.quotas[projectId]
+	if !ok || isUnlimited(current) {
+		err = errors.Wrapf(xfs.ErrNoQuota,
+			"project %d of path %s",
+			projectId, targetPath)
+		return
+	}
+
+	q = &xfs.Quota{}
+	*q = *current
+	return
+}
+
+// RemoveQuota releases the quota associated with a targetPath
+// that previously had a quota set for it.
+//
+// As with `xfs.Control`, callers are expected to have removed
+// the contents of the directory first, thus, the usage of the
+// project is dropped together with its limits.
+func (b *Backend) RemoveQuota(targetPath string) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, ok := b.projectIds[targetPath]
+	if !ok {
+		err = errors.Wrapf(xfs.ErrNoProjectId,
+			"couldn't remove quota of path %s",
+			targetPath)
+		return
+	}
+
+	delete(b.quotas, projectId)
+	delete(b.projectIds, targetPath)
+	return
+}
+
+// ListProjectQuotas retrieves the quotas of every project that
+// has either limits or usage, ordered by project id.
+func (b *Backend) ListProjectQuotas() (quotas []xfs.ProjectQuota, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	quotas = make([]xfs.ProjectQuota, 0, len(b.quotas))
+	for projectId, quota := range b.quotas {
+		if *quota == (xfs.Quota{}) {
+			continue
+		}
+
+		quotas = append(quotas, xfs.ProjectQuota{
+			ProjectId: projectId,
+			Quota:     *quota,
+		})
+	}
+
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].ProjectId < quotas[j].ProjectId
+	})
+	return
+}
+
+// GetSizeGranularity retrieves the unit (in bytes) in which the
+// backend stores size limits (see `SizeGranularity`).
+func (b *Backend) GetSizeGranularity() (granularity uint64) {
+	granularity = SizeGranularity
+	return
+}
+
+// Refresh forgets the project ids of directories that don't
+// exist anymore, just like `xfs.Control` does when rebuilding
+// its cache from the filesystem.
+func (b *Backend) Refresh() (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for targetPath := range b.projectIds {
+		_, err = os.Stat(targetPath)
+		if err == nil {
+			continue
+		}
+
+		if !os.IsNotExist(err) {
+			err = errors.Wrapf(err,
+				"couldn't inspect path %s", targetPath)
+			return
+		}
+
+		delete(b.projectIds, targetPath)
+	}
+
+	err = nil
+	return
+}
+
+// GetGracePeriods retrieves the grace periods that apply to
+// the soft limits of every project.
+func (b *Backend) GetGracePeriods() (g *xfs.GracePeriods, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g = &xfs.GracePeriods{}
+	*g = b.gracePeriods
+	return
+}
+
+// SetGracePeriods sets the grace periods that apply to the soft
+// limits of every project. Periods set to 0 are left untouched.
+func (b *Backend) SetGracePeriods(g xfs.GracePeriods) (err error) {
+	if g.Size < 0 || g.INode < 0 {
+		err = errors.Errorf(
+			"grace periods can't be negative (size=%s inode=%s)",
+			g.Size, g.INode)
+		return
+	}
+
+	if (g.Size > 0 && g.Size < time.Second) ||
+		(g.INode > 0 && g.INode < time.Second) {
+		err = errors.Errorf(
+			"grace periods can't be shorter than %s (size=%s inode=%s)",
+			time.Second, g.Size, g.INode)
+		return
+	}
+
+	if g.Size > xfs.MaxGracePeriod || g.INode > xfs.MaxGracePeriod {
+		err = errors.Errorf(
+			"grace periods can't be longer than %s (size=%s inode=%s)",
+			xfs.MaxGracePeriod, g.Size, g.INode)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if g.Size != 0 {
+		b.gracePeriods.Size = g.Size
+	}
+
+	if g.INode != 0 {
+		b.gracePeriods.INode = g.INode
+	}
+
+	return
+}
+
+// Use simulates the allocation (or release, when negative) of
+// bytes and inodes under the directory at targetPath.
+//
+// Allocations that would take the project over a hard limit, or
+// over a soft limit whose grace period has expired, are refused
+// with an error whose cause is `syscall.EDQUOT` - the same error
+// that writes get from the filesystem. Going over a soft limit
+// starts its grace period, which is reset once the usage drops
+// back to (or below) the soft limit.
+func (b *Backend) Use(targetPath string, size, inodes int64) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	projectId, ok := b.projectIds[targetPath]
+	if !ok {
+		err = errors.Errorf(
+			"no projectId associated with the path %s",
+			targetPath)
+		return
+	}
+
+	quota, ok := b.quotas[projectId]
+	if !ok {
+		quota = &xfs.Quota{}
+		b.quotas[projectId] = quota
+	}
+
+	var (
+		now         = time.Now()
+		usedSize    = applyDelta(quota.UsedSize, size)
+		usedInode   = applyDelta(quota.UsedInode, inodes)
+		sizeExpiry  = quota.SizeGraceExpiresAt
+		inodeExpiry = quota.INodeGraceExpiresAt
+	)
+
+	if size > 0 {
+		sizeExpiry, err = checkLimit(usedSize, quota.Size, quota.SoftSize,
+			sizeExpiry, b.gracePeriods.Size, now)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't use %d bytes under path %s",
+				size, targetPath)
+			return
+		}
+	}
+
+	if inodes > 0 {
+		inodeExpiry, err = checkLimit(usedInode, quota.INode, quota.SoftINode,
+			inodeExpiry, b.gracePeriods.INode, now)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"couldn't use %d inodes under path %s",
+				inodes, targetPath)
+			return
+		}
+	}
+
+	if quota.SoftSize == 0 || usedSize <= quota.SoftSize {
+		sizeExpiry = time.Time{}
+	}
+
+	if quota.SoftINode == 0 || usedInode <= quota.SoftINode {
+		inodeExpiry = time.Time{}
+	}
+
+	quota.UsedSize = usedSize
+	quota.UsedInode = usedInode
+	quota.SizeGraceExpiresAt = sizeExpiry
+	quota.INodeGraceExpiresAt = inodeExpiry
+	return
+}
+
+// checkLimit verifies whether a usage is allowed by a pair of
+// hard and soft limits (0 meaning no limit), returning the time
+// at which the grace period of the soft limit expires.
+func checkLimit(
+	used, hard, soft uint64,
+	expiry time.Time, grace time.Duration, now time.Time,
+) (newExpiry time.Time, err error) {
+	newExpiry = expiry
+
+	if hard != 0 && used > hard {
+		err = errors.Wrapf(syscall.EDQUOT,
+			"hard limit of %d exceeded", hard)
+		return
+	}
+
+	if soft == 0 || used <= soft {
+		return
+	}
+
+	if newExpiry.IsZero() {
+		newExpiry = now.Add(grace)
+		return
+	}
+
+	if !now.Before(newExpiry) {
+		err = errors.Wrapf(syscall.EDQUOT,
+			"soft limit of %d exceeded and grace period expired at %s",
+			soft, newExpiry)
+		return
+	}
+
+	return
+}
+
+// applyDelta adds a signed delta to a usage counter without
+// letting it go below zero.
+func applyDelta(used uint64, delta int64) uint64 {
+	if delta >= 0 {
+		return used + uint64(delta)
+	}
+
+	if uint64(-delta) > used {
+		return 0
+	}
+
+	return used - uint64(-delta)
+}
+
+// isUnlimited checks whether a quota has no limits set.
+func isUnlimited(quota *xfs.Quota) bool {
+	return quota.Size == 0 && quota.SoftSize == 0 &&
+		quota.INode == 0 && quota.SoftINode == 0
+}
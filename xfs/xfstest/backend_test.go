@@ -0,0 +1,268 @@
+package xfstest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/cirocosta/xfsvol/xfs/xfstest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackend_failsToAssignQuotaToInexistentDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	err = b.SetQuota(path.Join(dir, "abc"), xfs.Quota{
+		Size: 1 << 20,
+	})
+	assert.Error(t, err)
+}
+
+func TestBackend_assignsDistinctProjectIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		b    = xfstest.NewBackend()
+		dir1 = path.Join(dir, "dir1")
+		dir2 = path.Join(dir, "dir2")
+	)
+
+	assert.NoError(t, os.Mkdir(dir1, 0755))
+	assert.NoError(t, os.Mkdir(dir2, 0755))
+
+	projectId1, err := b.AssignProjectId(dir1)
+	assert.NoError(t, err)
+
+	projectId2, err := b.AssignProjectId(dir2)
+	assert.NoError(t, err)
+	assert.NotEqual(t, projectId1, projectId2)
+
+	projectId, found := b.GetProjectId(dir1)
+	assert.True(t, found)
+	assert.Equal(t, projectId1, projectId)
+
+	projectId, err = b.AssignProjectId(dir1)
+	assert.NoError(t, err)
+	assert.Equal(t, projectId1, projectId)
+}
+
+func TestBackend_setsAndRetrievesQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	err = b.SetQuota(dir, xfs.Quota{
+		Size:      10 << 20,
+		SoftSize:  8 << 20,
+		INode:     100,
+		SoftINode: 80,
+	})
+	assert.NoError(t, err)
+
+	quota, err := b.GetQuota(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10<<20), quota.Size)
+	assert.Equal(t, uint64(8<<20), quota.SoftSize)
+	assert.Equal(t, uint64(100), quota.INode)
+	assert.Equal(t, uint64(80), quota.SoftINode)
+}
+
+func TestBackend_distinguishesMissingProjectsFromMissingLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+
+	_, err = b.GetQuota(dir)
+	assert.True(t, errors.Is(err, xfs.ErrNoProjectId))
+
+	_, err = b.AssignProjectId(dir)
+	assert.NoError(t, err)
+
+	_, err = b.GetQuota(dir)
+	assert.True(t, errors.Is(err, xfs.ErrNoQuota))
+
+	assert.NoError(t, b.RemoveQuota(dir))
+
+	err = b.RemoveQuota(dir)
+	assert.True(t, errors.Is(err, xfs.ErrNoProjectId))
+}
+
+func TestBackend_refusesSoftLimitsAboveHardLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	err = b.SetQuota(dir, xfs.Quota{
+		Size:     1 << 20,
+		SoftSize: 2 << 20,
+	})
+	assert.Error(t, err)
+}
+
+func TestBackend_roundsSizesDownLikeXFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	assert.NoError(t, b.SetQuota(dir, xfs.Quota{
+		Size:     10 * 1000 * 1000,
+		SoftSize: 5 * 1000 * 1000,
+	}))
+
+	q, err := b.GetQuota(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9999872), q.Size)
+	assert.Equal(t, uint64(4999680), q.SoftSize)
+	assert.Equal(t, uint64(xfstest.SizeGranularity), b.GetSizeGranularity())
+}
+
+func TestBackend_enforcesHardLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	assert.NoError(t, b.SetQuota(dir, xfs.Quota{
+		Size:  1 << 20,
+		INode: 2,
+	}))
+
+	assert.NoError(t, b.Use(dir, 1<<20, 2))
+
+	err = b.Use(dir, 1, 0)
+	assert.Error(t, err)
+	assert.Equal(t, syscall.EDQUOT, errors.Cause(err))
+	assert.True(t, errors.Is(err, xfs.ErrQuotaExceeded))
+
+	err = b.Use(dir, 0, 1)
+	assert.Error(t, err)
+	assert.Equal(t, syscall.EDQUOT, errors.Cause(err))
+
+	quota, err := b.GetQuota(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<20), quota.UsedSize)
+	assert.Equal(t, uint64(2), quota.UsedInode)
+
+	assert.NoError(t, b.Use(dir, -(1<<19), -1))
+	assert.NoError(t, b.Use(dir, 1<<19, 1))
+}
+
+func TestBackend_enforcesSoftLimitsAfterGracePeriod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := xfstest.NewBackend()
+	assert.NoError(t, b.SetGracePeriods(xfs.GracePeriods{
+		Size: time.Second,
+	}))
+	assert.NoError(t, b.SetQuota(dir, xfs.Quota{
+		Size:     10 << 20,
+		SoftSize: 1 << 20,
+	}))
+
+	assert.NoError(t, b.Use(dir, 2<<20, 0))
+
+	quota, err := b.GetQuota(dir)
+	assert.NoError(t, err)
+	assert.False(t, quota.SizeGraceExpiresAt.IsZero())
+
+	assert.NoError(t, b.Use(dir, 1<<20, 0))
+
+	time.Sleep(1100 * time.Millisecond)
+
+	err = b.Use(dir, 1<<20, 0)
+	assert.Error(t, err)
+	assert.Equal(t, syscall.EDQUOT, errors.Cause(err))
+
+	assert.NoError(t, b.Use(dir, -(3<<20), 0))
+
+	quota, err = b.GetQuota(dir)
+	assert.NoError(t, err)
+	assert.True(t, quota.SizeGraceExpiresAt.IsZero())
+	assert.NoError(t, b.Use(dir, 1<<20, 0))
+}
+
+func TestBackend_refusesGracePeriodsOutOfRange(t *testing.T) {
+	b := xfstest.NewBackend()
+
+	assert.Error(t, b.SetGracePeriods(xfs.GracePeriods{
+		Size: -time.Second,
+	}))
+	assert.Error(t, b.SetGracePeriods(xfs.GracePeriods{
+		INode: xfs.MaxGracePeriod + time.Second,
+	}))
+	assert.Error(t, b.SetGracePeriods(xfs.GracePeriods{
+		INode: 500 * time.Millisecond,
+	}))
+	assert.NoError(t, b.SetGracePeriods(xfs.GracePeriods{
+		Size: xfs.MaxGracePeriod,
+	}))
+}
+
+func TestBackend_listsProjectQuotas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		b    = xfstest.NewBackend()
+		dir1 = path.Join(dir, "dir1")
+		dir2 = path.Join(dir, "dir2")
+	)
+
+	assert.NoError(t, os.Mkdir(dir1, 0755))
+	assert.NoError(t, os.Mkdir(dir2, 0755))
+	assert.NoError(t, b.SetQuota(dir1, xfs.Quota{Size: 1 << 20}))
+	assert.NoError(t, b.SetQuota(dir2, xfs.Quota{Size: 2 << 20}))
+
+	quotas, err := b.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 2)
+	assert.Equal(t, uint64(1<<20), quotas[0].Size)
+	assert.Equal(t, uint64(2<<20), quotas[1].Size)
+
+	assert.NoError(t, b.RemoveQuota(dir1))
+
+	quotas, err = b.ListProjectQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 1)
+	assert.Equal(t, uint64(2<<20), quotas[0].Size)
+
+	_, found := b.GetProjectId(dir1)
+	assert.False(t, found)
+}
+
+func TestBackend_refreshForgetsRemovedDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		b      = xfstest.NewBackend()
+		subdir = path.Join(dir, "abc")
+	)
+
+	assert.NoError(t, os.Mkdir(subdir, 0755))
+	assert.NoError(t, b.SetQuota(subdir, xfs.Quota{Size: 1 << 20}))
+	assert.NoError(t, os.Remove(subdir))
+	assert.NoError(t, b.Refresh())
+
+	_, found := b.GetProjectId(subdir)
+	assert.False(t, found)
+}
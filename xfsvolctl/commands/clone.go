@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var Clone = cli.Command{
+	Name:  "clone",
+	Usage: "Creates a volume with a copy of the contents of another",
+	Description: `Creates a volume out of the contents of an existing one.
+   Files are cloned with reflinks (copy-on-write) when the XFS
+   filesystem supports them (formatted with 'reflink=1'), such
+   that no data gets copied until either side modifies it. On
+   filesystems without reflink support, their bytes get copied.
+
+   Directories, symlinks, modes, ownership and extended
+   attributes are preserved.
+
+   The clone gets its own project id, being accounted against
+   its own quota - which takes the size limits of the source
+   volume unless '--size' or '--soft-size' is specified and,
+   likewise, its inode limits unless '--inode' or '--soft-inode'
+   is.
+
+   Examples:
+
+     1. clone a volume keeping its limits:
+
+            xfsvolctl clone \
+                --root /mnt/xfs/volumes \
+                --from myvol \
+                --name myvol-copy
+
+     2. clone a volume into a bigger one:
+
+            xfsvolctl clone \
+                --root /mnt/xfs/volumes \
+                --from myvol \
+                --name myvol-copy \
+                --size 20M
+    `,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "Name of the volume to clone",
+		},
+		cli.StringFlag{
+			Name:  "name, n",
+			Usage: "Name of the volume to create",
+		},
+		cli.StringFlag{
+			Name:  "size, s",
+			Usage: "Size of the XFS project quota to apply (defaults to the one of the source volume)",
+		},
+		cli.StringFlag{
+			Name:  "soft-size",
+			Usage: "Soft limit of the XFS project quota to apply (e.g.: 40M)",
+		},
+		cli.Uint64Flag{
+			Name:  "inode, i",
+			Usage: "Maximum number of INodes that can be created (defaults to the one of the source volume)",
+		},
+		cli.Uint64Flag{
+			Name:  "soft-inode",
+			Usage: "Number of INodes after which the volume is over quota",
+		},
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Value: manager.DefaultLockTimeout,
+			Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: cloneAction,
+}
+
+func cloneAction(c *cli.Context) (err error) {
+	var (
+		from      = c.String("from")
+		name      = c.String("name")
+		size      = c.String("size")
+		softSize  = c.String("soft-size")
+		root      = c.String("root")
+		inode     = c.Uint64("inode")
+		softINode = c.Uint64("soft-inode")
+		timeout   = c.Duration("lock-timeout")
+		debug     = c.Bool("debug")
+
+		sizeInBytes     uint64
+		softSizeInBytes uint64
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if from == "" || name == "" || root == "" {
+		cli.ShowCommandHelp(c, "clone")
+		err = cli.NewExitError(
+			"From, name and root are required parameters.", 1)
+		return
+	}
+
+	if size == "" && (softSize != "" || inode != 0 || softINode != 0) {
+		err = cli.NewExitError(
+			"Size must be specified when specifying other limits.", 1)
+		return
+	}
+
+	mgr, err := manager.New(manager.Config{
+		Root:        root,
+		LockTimeout: timeout,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate manager")
+		return
+	}
+
+	if size != "" {
+		sizeInBytes, err = manager.FromHumanSize(size)
+		if err != nil {
+			err = exitError(err,
+				"Size '%s' can't be converted to uint64 bytes", size)
+			return
+		}
+	}
+
+	if softSize != "" {
+		softSizeInBytes, err = manager.FromHumanSize(softSize)
+		if err != nil {
+			err = exitError(err,
+				"Soft size '%s' can't be converted to uint64 bytes", softSize)
+			return
+		}
+	}
+
+	_, err = mgr.Clone(from, manager.Volume{
+		Name:      name,
+		Size:      sizeInBytes,
+		SoftSize:  softSizeInBytes,
+		INode:     inode,
+		SoftINode: softINode,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't clone volume %s into %s", from, name)
+		return
+	}
+
+	return
+}
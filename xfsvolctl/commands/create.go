@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"strings"
+
 	"github.com/cirocosta/xfsvol/manager"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -29,10 +31,51 @@ var Create = cli.Command{
             /dev/loop0 on /mnt/xfs type xfs (rw,relatime,attr2,inode64,prjquota)
 
             xfsvolctl create \
-                --root /mnt/xfs \
+                --root /mnt/xfs/volumes \
                 --name myvol \
                 --size 10M
 
+     2. create a volume that is considered over quota once it
+        reaches 8M but that only has writes failing at 10M:
+
+            xfsvolctl create \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --size 10M \
+                --soft-size 8M
+
+     3. create a volume recording its project in the files that
+        xfs_quota reads such that 'report -p' shows its name:
+
+            xfsvolctl create \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --size 10M \
+                --projects-file /etc/projects \
+                --projid-file /etc/projid
+
+     4. create a volume with labels attached to it:
+
+            xfsvolctl create \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --size 10M \
+                --label team=ci \
+                --label purpose=cache
+
+     5. turn an existing directory under the root into a volume,
+        keeping its contents:
+
+            xfsvolctl create \
+                --root /mnt/xfs/volumes \
+                --name legacy \
+                --size 1G \
+                --adopt
+
+   Creating a volume that already exists with the same limits
+   and labels succeeds without changing it, while creating it
+   with different ones fails (exit code 12).
+
    Note:
      In order to have the creation functioning you must first have a
      mount point in the filesystem that is mounted on top of XFS and
@@ -47,14 +90,43 @@ var Create = cli.Command{
 			Name:  "size, s",
 			Usage: "Size of the XFS project quota to apply (e.g.: 50M)",
 		},
+		cli.StringFlag{
+			Name:  "soft-size",
+			Usage: "Soft limit of the XFS project quota to apply (e.g.: 40M)",
+		},
 		cli.Uint64Flag{
 			Name:  "inode, i",
 			Usage: "Maximum number of INodes that can be created",
 		},
+		cli.Uint64Flag{
+			Name:  "soft-inode",
+			Usage: "Number of INodes after which the volume is over quota",
+		},
 		cli.StringFlag{
 			Name:  "root, r",
 			Usage: "Root of the volume creation (under an xfs filesystem)",
 		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Value: manager.DefaultLockTimeout,
+			Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+		},
+		cli.StringSliceFlag{
+			Name:  "label, l",
+			Usage: "Label (key=value) to attach to the volume (can be repeated)",
+		},
+		cli.BoolFlag{
+			Name:  "adopt",
+			Usage: "Whether to turn an existing directory that is not a volume into one",
+		},
+		cli.StringFlag{
+			Name:  "projects-file",
+			Usage: "File (/etc/projects format) to record the project of the volume in (remembered for the root)",
+		},
+		cli.StringFlag{
+			Name:  "projid-file",
+			Usage: "File (/etc/projid format) to record the name of the volume project in (remembered for the root)",
+		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "Whether debug logs should be displayed",
@@ -65,13 +137,21 @@ var Create = cli.Command{
 
 func createAction(c *cli.Context) (err error) {
 	var (
-		name  = c.String("name")
-		size  = c.String("size")
-		root  = c.String("root")
-		inode = c.Uint64("inode")
-		debug = c.Bool("debug")
-
-		sizeInBytes uint64
+		name      = c.String("name")
+		size      = c.String("size")
+		softSize  = c.String("soft-size")
+		root      = c.String("root")
+		inode     = c.Uint64("inode")
+		softINode = c.Uint64("soft-inode")
+		timeout   = c.Duration("lock-timeout")
+		projects  = c.String("projects-file")
+		projId    = c.String("projid-file")
+		labelArgs = c.StringSlice("label")
+		adopt     = c.Bool("adopt")
+		debug     = c.Bool("debug")
+
+		sizeInBytes     uint64
+		softSizeInBytes uint64
 	)
 
 	if debug {
@@ -85,33 +165,82 @@ func createAction(c *cli.Context) (err error) {
 		return
 	}
 
+	labels, err := parseLabels(labelArgs)
+	if err != nil {
+		err = cli.NewExitError(err, 1)
+		return
+	}
+
 	mgr, err := manager.New(manager.Config{
-		Root: root,
+		Root:         root,
+		LockTimeout:  timeout,
+		ProjectsFile: projects,
+		ProjIdFile:   projId,
 	})
 	if err != nil {
-		err = cli.NewExitError(errors.Wrapf(err,
-			"Couldn't initiate manager"), 1)
+		err = exitError(err,
+			"Couldn't initiate manager")
 		return
 	}
 
 	sizeInBytes, err = manager.FromHumanSize(size)
 	if err != nil {
-		err = cli.NewExitError(errors.Wrapf(err,
-			"Size '%s' can't be converted to uint64 bytes", size), 1)
+		err = exitError(err,
+			"Size '%s' can't be converted to uint64 bytes", size)
 		return
 	}
 
-	_, err = mgr.Create(manager.Volume{
-		Name:  name,
-		Size:  sizeInBytes,
-		INode: inode,
-	})
+	if softSize != "" {
+		softSizeInBytes, err = manager.FromHumanSize(softSize)
+		if err != nil {
+			err = exitError(err,
+				"Soft size '%s' can't be converted to uint64 bytes", softSize)
+			return
+		}
+	}
+
+	var vol = manager.Volume{
+		Name:      name,
+		Size:      sizeInBytes,
+		SoftSize:  softSizeInBytes,
+		INode:     inode,
+		SoftINode: softINode,
+		Labels:    labels,
+	}
+
+	if adopt {
+		_, err = mgr.Adopt(vol)
+	} else {
+		_, err = mgr.Create(vol)
+	}
 	if err != nil {
-		err = cli.NewExitError(errors.Wrapf(err,
-			"Couldn't create volume name=%s bytes=%d inode=%d",
-			name, sizeInBytes, inode), 1)
+		err = exitError(err,
+			"Couldn't create volume name=%s bytes=%d soft-bytes=%d inode=%d soft-inode=%d",
+			name, sizeInBytes, softSizeInBytes, inode, softINode)
+		return
+	}
+
+	return
+}
+
+// parseLabels parses labels specified as `key=value` into
+// a map of keys to values.
+func parseLabels(args []string) (labels map[string]string, err error) {
+	if len(args) == 0 {
 		return
 	}
 
+	labels = make(map[string]string, len(args))
+	for _, arg := range args {
+		fields := strings.SplitN(arg, "=", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			err = errors.Errorf(
+				"Label '%s' must be specified as key=value", arg)
+			return
+		}
+
+		labels[fields[0]] = fields[1]
+	}
+
 	return
 }
@@ -1,10 +1,103 @@
 package commands
 
 import (
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/rs/zerolog"
 	"gopkg.in/urfave/cli.v1"
 )
 
 var Delete = cli.Command{
 	Name:  "delete",
 	Usage: "Deletes a volume managed by 'xfsvol' plugin",
+	Description: `Deletes a volume together with its snapshots.
+   The contents of the volume are removed and the project id
+   associated with it gets released.
+
+   Volumes mounted by containers (as recorded by the plugin)
+   are not deleted unless '--force' is specified.
+
+   Examples:
+
+     1. delete a volume that is not in use:
+
+            xfsvolctl delete \
+                --root /mnt/xfs/volumes \
+                --name myvol
+
+     2. delete a volume even though the plugin recorded it as
+        mounted (e.g., after the container runtime crashed):
+
+            xfsvolctl delete \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --force
+	`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name, n",
+			Usage: "Name of the volume to delete",
+		},
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "Whether to delete the volume even if it's mounted",
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Value: manager.DefaultLockTimeout,
+			Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: deleteAction,
+}
+
+func deleteAction(c *cli.Context) (err error) {
+	var (
+		name    = c.String("name")
+		root    = c.String("root")
+		force   = c.Bool("force")
+		timeout = c.Duration("lock-timeout")
+		debug   = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if name == "" || root == "" {
+		cli.ShowCommandHelp(c, "delete")
+		err = cli.NewExitError(
+			"Name and root are required parameters.", 1)
+		return
+	}
+
+	mgr, err := manager.New(manager.Config{
+		Root:        root,
+		LockTimeout: timeout,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate manager")
+		return
+	}
+
+	if force {
+		err = mgr.ForceDelete(name)
+	} else {
+		err = mgr.Delete(name)
+	}
+	if err != nil {
+		err = exitError(err,
+			"Couldn't delete volume %s", name)
+		return
+	}
+
+	return
 }
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Exit codes that the commands terminate with such that
+// scripts can react to specific conditions.
+const (
+	ExitCodeFailure            = 1
+	ExitCodeNotFound           = 2
+	ExitCodeNoProjectId        = 3
+	ExitCodeNoQuota            = 4
+	ExitCodeQuotaNotEnabled    = 5
+	ExitCodePermissionDenied   = 6
+	ExitCodeQuotaExceeded      = 7
+	ExitCodeInvalidBlockDevice = 8
+	ExitCodePreflightFailed    = 9
+	ExitCodeExists             = 10
+	ExitCodeInUse              = 11
+	ExitCodeConflict           = 12
+)
+
+// ExitCodesHelp describes the exit codes of the commands.
+const ExitCodesHelp = `Exit codes:
+
+     0  success
+     1  failure not covered by the codes below (e.g., bad usage)
+     2  volume (or snapshot) not found
+     3  path has no project id
+     4  project has no quota limits
+     5  project quotas not enabled on the filesystem
+     6  not permitted to manage quotas (requires CAP_SYS_ADMIN)
+     7  quota exceeded
+     8  invalid or stale block device
+     9  filesystem not fit for enforcing project quotas (preflight)
+    10  volume (or snapshot) already exists
+    11  volume in use (mounted)
+    12  volume exists with different options (or path is not a volume)`
+
+// exitCodes maps the errors that commands can fail with
+// to the exit codes that describe them.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{manager.ErrNotFound, ExitCodeNotFound},
+	{manager.ErrExists, ExitCodeExists},
+	{manager.ErrSnapshotNotFound, ExitCodeNotFound},
+	{manager.ErrSnapshotExists, ExitCodeExists},
+	{manager.ErrInUse, ExitCodeInUse},
+	{manager.ErrConflict, ExitCodeConflict},
+	{manager.ErrNotAVolume, ExitCodeConflict},
+	{xfs.ErrNoProjectId, ExitCodeNoProjectId},
+	{xfs.ErrNoQuota, ExitCodeNoQuota},
+	{xfs.ErrQuotaNotEnabled, ExitCodeQuotaNotEnabled},
+	{xfs.ErrPermissionDenied, ExitCodePermissionDenied},
+	{xfs.ErrQuotaExceeded, ExitCodeQuotaExceeded},
+	{xfs.ErrInvalidBlockDevice, ExitCodeInvalidBlockDevice},
+}
+
+// exitError wraps an error with a message and turns it into
+// an error that makes the command exit with the code that
+// corresponds to the error.
+func exitError(err error, format string, args ...interface{}) *cli.ExitError {
+	return cli.NewExitError(errors.Wrapf(err, format, args...), exitCode(err))
+}
+
+// exitCode retrieves the exit code that corresponds to an error.
+func exitCode(err error) int {
+	var preflightErr *xfs.PreflightError
+
+	if errors.As(err, &preflightErr) {
+		return ExitCodePreflightFailed
+	}
+
+	for _, candidate := range exitCodes {
+		if errors.Is(err, candidate.err) {
+			return candidate.code
+		}
+	}
+
+	return ExitCodeFailure
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var Grace = cli.Command{
+	Name:  "grace",
+	Usage: "Displays or changes the grace periods of XFS project quotas",
+	Description: `Displays or changes the project quota grace periods.
+   Once a volume goes past its soft limit (see 'create --soft-size'),
+   it has a grace period during which writes are still accepted. After
+   the grace period expires, the soft limit is enforced as if it was
+   a hard limit.
+
+   Grace periods are filesystem-wide, applying to every volume under
+   the filesystem that holds the root. They're kept in seconds, thus
+   periods can't be shorter than a second.
+
+   Examples:
+
+     1. display the current grace periods:
+
+            xfsvolctl grace \
+                --root /mnt/xfs
+
+            BLK-GRACE   INODE-GRACE
+            168h0m0s    168h0m0s
+
+     2. allow volumes to stay above their soft size limit for
+        a day:
+
+            xfsvolctl grace \
+                --root /mnt/xfs \
+                --size 24h
+	`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.DurationFlag{
+			Name:  "size, s",
+			Usage: "Grace period for soft size limits (e.g.: 24h)",
+		},
+		cli.DurationFlag{
+			Name:  "inode, i",
+			Usage: "Grace period for soft inode limits (e.g.: 24h)",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: graceAction,
+}
+
+func graceAction(c *cli.Context) (err error) {
+	var (
+		root  = c.String("root")
+		size  = c.Duration("size")
+		inode = c.Duration("inode")
+		debug = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if root == "" {
+		cli.ShowCommandHelp(c, "grace")
+		err = cli.NewExitError("Root is a required parameter.", 1)
+		return
+	}
+
+	var cfg = xfs.ControlConfig{
+		BasePath: root,
+	}
+
+	// only displaying them: no device node gets created under a
+	// root that might be served by the plugin.
+	if size == 0 && inode == 0 {
+		cfg.BlockDeviceMode = xfs.BlockDeviceModeLookup
+		cfg.PreflightMode = xfs.PreflightModeSkip
+	}
+
+	ctl, err := xfs.NewControl(cfg)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate quota control")
+		return
+	}
+
+	if size != 0 || inode != 0 {
+		err = ctl.SetGracePeriods(xfs.GracePeriods{
+			Size:  size,
+			INode: inode,
+		})
+		if err != nil {
+			err = exitError(err,
+				"Couldn't set grace periods size=%s inode=%s",
+				size, inode)
+			return
+		}
+	}
+
+	gracePeriods, err := ctl.GetGracePeriods()
+	if err != nil {
+		err = exitError(err,
+			"Couldn't retrieve grace periods under root %s", root)
+		return
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "BLK-GRACE\tINODE-GRACE\t")
+	fmt.Fprintf(w, "%s\t%s\n",
+		gracePeriods.Size.Truncate(time.Second),
+		gracePeriods.INode.Truncate(time.Second))
+	w.Flush()
+	return
+}
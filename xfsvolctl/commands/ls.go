@@ -3,6 +3,9 @@ package commands
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/cirocosta/xfsvol/manager"
@@ -19,7 +22,9 @@ var Ls = cli.Command{
    plugin or the 'xfsvolctl' command.
 
    Volumes are listed by their names relative to a root as
-   well as the sizes assigned as project quota in XFS.
+   well as the sizes assigned as project quota in XFS and how
+   much of them is used. 'USE%' is the highest of the used
+   percentages of the size and inode limits.
 
    Examples:
 
@@ -27,21 +32,42 @@ var Ls = cli.Command{
         the list of volumes:
 
             xfsvolctl create \
-                --root /mnt/xfs
+                --root /mnt/xfs/volumes
                 --name myvol
                 --size 10M
 
             xfsvolctl ls \
-                --root /mnt/xfs
+                --root /mnt/xfs/volumes
 
-            NAME      QUOTA
-            myvol     10M
+            NAME    USED    BLK-QUOTA  SOFT-BLK-QUOTA  USED-INODES  INODE-QUOTA  SOFT-INODE-QUOTA  USE%
+            myvol   4.1kB   10MB       0B              1            0            0                 0.0%
+
+     2. find out which volumes are almost full, fullest first:
+
+            xfsvolctl ls \
+                --root /mnt/xfs/volumes \
+                --sort percent \
+                --over 80%
 	`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "root, r",
 			Usage: "Root of the volume listing",
 		},
+		cli.StringFlag{
+			Name:  "sort",
+			Value: "name",
+			Usage: "Order to list volumes in: 'name', 'usage' (used bytes, highest first) or 'percent' (highest first)",
+		},
+		cli.StringFlag{
+			Name:  "over",
+			Usage: "Only list volumes using more than a percentage of their quota (e.g.: 80%)",
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Value: manager.DefaultLockTimeout,
+			Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+		},
 		cli.BoolFlag{
 			Name:  "debug",
 			Usage: "Whether debug logs should be displayed",
@@ -52,8 +78,13 @@ var Ls = cli.Command{
 
 func lsAction(c *cli.Context) (err error) {
 	var (
-		root  = c.String("root")
-		debug = c.Bool("debug")
+		root    = c.String("root")
+		order   = c.String("sort")
+		over    = c.String("over")
+		timeout = c.Duration("lock-timeout")
+		debug   = c.Bool("debug")
+
+		threshold float64
 	)
 
 	if debug {
@@ -66,32 +97,88 @@ func lsAction(c *cli.Context) (err error) {
 		return
 	}
 
+	less, found := volumeOrders[order]
+	if !found {
+		err = cli.NewExitError(
+			fmt.Sprintf("Unknown sort order '%s' (name|usage|percent)", order), 1)
+		return
+	}
+
+	if over != "" {
+		threshold, err = parsePercentage(over)
+		if err != nil {
+			err = cli.NewExitError(err, 1)
+			return
+		}
+	}
+
 	mgr, err := manager.New(manager.Config{
-		Root: root,
+		Root:        root,
+		LockTimeout: timeout,
 	})
 	if err != nil {
-		err = cli.NewExitError(errors.Wrapf(err,
-			"Couldn't initiate manager"), 1)
+		err = exitError(err,
+			"Couldn't initiate manager")
 		return
 	}
 
 	vols, err := mgr.List()
 	if err != nil {
-		err = cli.NewExitError(errors.Wrapf(err,
-			"Couldn't list volumes under root %s", root), 1)
+		err = exitError(err,
+			"Couldn't list volumes under root %s", root)
 		return
 	}
 
+	sort.SliceStable(vols, func(i, j int) bool {
+		return less(vols[i], vols[j])
+	})
+
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
-	fmt.Fprintln(w, "NAME\tBLK-QUOTA\tINODE-QUOTA\t")
+	fmt.Fprintln(w, "NAME\tUSED\tBLK-QUOTA\tSOFT-BLK-QUOTA\tUSED-INODES\tINODE-QUOTA\tSOFT-INODE-QUOTA\tUSE%\t")
 
 	for _, vol := range vols {
-		fmt.Fprintf(w, "%s\t%s\t%d\n",
+		if over != "" && vol.PercentUsed <= threshold {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%.1f%%\n",
 			vol.Name,
+			manager.HumanSize(vol.UsedSize),
 			manager.HumanSize(vol.Size),
-			vol.INode)
+			manager.HumanSize(vol.SoftSize),
+			vol.UsedINode,
+			vol.INode,
+			vol.SoftINode,
+			vol.PercentUsed)
 	}
 	w.Flush()
 	return
 }
+
+// volumeOrders maps the orders that volumes can be listed in
+// to functions that tell whether a volume comes before another.
+var volumeOrders = map[string]func(a, b manager.Volume) bool{
+	"name": func(a, b manager.Volume) bool {
+		return a.Name < b.Name
+	},
+	"usage": func(a, b manager.Volume) bool {
+		return a.UsedSize > b.UsedSize
+	},
+	"percent": func(a, b manager.Volume) bool {
+		return a.PercentUsed > b.PercentUsed
+	},
+}
+
+// parsePercentage parses a percentage specified either with
+// or without the percent sign (e.g., `80%` or `80`).
+func parsePercentage(value string) (percent float64, err error) {
+	percent, err = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || percent < 0 {
+		err = errors.Errorf(
+			"Percentage '%s' must be a non-negative number (e.g.: 80%%)", value)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var Projects = cli.Command{
+	Name:  "projects",
+	Usage: "Regenerates the project files read by xfs_quota from the volumes",
+	Description: `Regenerates the project files (/etc/projects and /etc/projid).
+   xfs_quota reads '/etc/projects' (mapping project ids to
+   directories) and '/etc/projid' (mapping names to project ids)
+   to show names instead of numeric ids in its reports.
+
+   'projects' rewrites the entries of the volumes under the root
+   in both files out of the project ids currently set on them,
+   leaving entries that belong to other roots or tools untouched.
+
+   Examples:
+
+     1. regenerate the system project files and then check the
+        project quota report:
+
+            xfsvolctl projects \
+                --root /mnt/xfs/volumes
+
+            xfs_quota -x -c 'report -p' /mnt/xfs
+            Project quota on /mnt/xfs (/dev/loop0)
+                                           Blocks
+            Project ID       Used       Soft       Hard    Warn/Grace
+            ---------- --------------------------------------------------
+            #0                  0          0          0     00 [--------]
+            myvol               4          0      10240     00 [--------]
+
+     2. regenerate the files recorded by the plugin (configured
+        with PROJECTS_FILE and PROJID_FILE) and use them:
+
+            xfsvolctl projects \
+                --root /mnt/xfs/volumes \
+                --projects-file /mnt/xfs/projects \
+                --projid-file /mnt/xfs/projid
+
+            xfs_quota -D /mnt/xfs/projects -P /mnt/xfs/projid \
+                -x -c 'report -p' /mnt/xfs
+	`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.StringFlag{
+			Name:  "projects-file",
+			Value: xfs.DefaultProjectsFile,
+			Usage: "File (/etc/projects format) to record the project of each volume in",
+		},
+		cli.StringFlag{
+			Name:  "projid-file",
+			Value: xfs.DefaultProjIdFile,
+			Usage: "File (/etc/projid format) to record the name of each volume project in",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: projectsAction,
+}
+
+func projectsAction(c *cli.Context) (err error) {
+	var (
+		root     = c.String("root")
+		projects = c.String("projects-file")
+		projId   = c.String("projid-file")
+		debug    = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if root == "" || (projects == "" && projId == "") {
+		cli.ShowCommandHelp(c, "projects")
+		err = cli.NewExitError(
+			"Root and at least one of the project files are required parameters.", 1)
+		return
+	}
+
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:      root,
+		PreflightMode: xfs.PreflightModeWarn,
+		ProjectsFile:  projects,
+		ProjIdFile:    projId,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate quota control")
+		return
+	}
+
+	err = ctl.WriteProjectFiles()
+	if err != nil {
+		err = exitError(err,
+			"Couldn't regenerate project files of root %s", root)
+		return
+	}
+
+	return
+}
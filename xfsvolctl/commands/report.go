@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var Report = cli.Command{
+	Name:  "report",
+	Usage: "Reports every project quota of the filesystem holding the volumes",
+	Description: `Reports every project quota known by the filesystem.
+   Differently from 'ls', which only looks at the volumes (directories)
+   under the root, 'report' enumerates every project quota record that
+   the filesystem holds and cross-references them with the volumes
+   under the root.
+
+   Each entry has one of the following statuses:
+
+     ok        the project quota belongs to a volume under the root;
+     orphan    the project quota has no volume under the root (e.g., a
+               volume that has been removed or a project created by
+               another tool);
+     no-quota  the volume has a project id but the filesystem holds no
+               quota record for it.
+
+   Examples:
+
+     1. report the project quotas of the filesystem holding
+        '/mnt/xfs/volumes':
+
+            xfsvolctl report \
+                --root /mnt/xfs/volumes
+
+            PROJECT-ID   VOLUME   STATUS   BLK-QUOTA   USED-BLK   INODE-QUOTA   USED-INODE
+            1            myvol    ok       10MB        4kB        0             3
+            2            -        orphan   20MB        0B         0             0
+	`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: reportAction,
+}
+
+// reportEntry represents a line of the project quota report.
+type reportEntry struct {
+	projectId uint32
+	volume    string
+	status    string
+	quota     xfs.Quota
+}
+
+func reportAction(c *cli.Context) (err error) {
+	var (
+		root  = c.String("root")
+		debug = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if root == "" {
+		cli.ShowCommandHelp(c, "report")
+		err = cli.NewExitError("Root is a required parameter.", 1)
+		return
+	}
+
+	// only inspecting: no device node gets created under a root
+	// that might be served by the plugin.
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        root,
+		BlockDeviceMode: xfs.BlockDeviceModeLookup,
+		PreflightMode:   xfs.PreflightModeSkip,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate quota control")
+		return
+	}
+
+	quotas, err := ctl.ListProjectQuotas()
+	if err != nil {
+		err = exitError(err,
+			"Couldn't list project quotas under root %s", root)
+		return
+	}
+
+	pathToProjectId, err := xfs.GeneratePathToProjectIdMap(root)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't list volumes under root %s", root)
+		return
+	}
+
+	var (
+		projectIdToVolume = make(map[uint32]string, len(pathToProjectId))
+		seen              = make(map[uint32]bool, len(quotas))
+		entries           = make([]reportEntry, 0, len(quotas))
+	)
+
+	for path, projectId := range pathToProjectId {
+		projectIdToVolume[projectId] = filepath.Base(path)
+	}
+
+	for _, quota := range quotas {
+		var entry = reportEntry{
+			projectId: quota.ProjectId,
+			volume:    "-",
+			status:    "orphan",
+			quota:     quota.Quota,
+		}
+
+		volume, found := projectIdToVolume[quota.ProjectId]
+		if found {
+			entry.volume = volume
+			entry.status = "ok"
+		}
+
+		seen[quota.ProjectId] = true
+		entries = append(entries, entry)
+	}
+
+	for projectId, volume := range projectIdToVolume {
+		if seen[projectId] {
+			continue
+		}
+
+		entries = append(entries, reportEntry{
+			projectId: projectId,
+			volume:    volume,
+			status:    "no-quota",
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].projectId < entries[j].projectId
+	})
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "PROJECT-ID\tVOLUME\tSTATUS\tBLK-QUOTA\tUSED-BLK\tINODE-QUOTA\tUSED-INODE\t")
+
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			entry.projectId,
+			entry.volume,
+			entry.status,
+			manager.HumanSize(entry.quota.Size),
+			manager.HumanSize(entry.quota.UsedSize),
+			entry.quota.INode,
+			entry.quota.UsedInode)
+	}
+	w.Flush()
+	return
+}
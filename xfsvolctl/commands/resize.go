@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var Resize = cli.Command{
+	Name:  "resize",
+	Usage: "Changes the limits of a volume managed by 'xfsvol' plugin",
+	Description: `Changes the XFS project quota limits of an existing volume.
+   Volumes can be resized while in use (e.g., mounted by a
+   container served by the plugin) as only the limits of their
+   project change - their data is left untouched.
+
+   Limits that are not specified keep their current values.
+
+   Shrinking a volume below what it already uses is refused
+   unless '--force' is specified, in which case the volume
+   is left over quota (with writes failing) until enough gets
+   removed from it.
+
+   Examples:
+
+     1. grow a volume to 20M:
+
+            xfsvolctl resize \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --size 20M
+
+     2. shrink a volume that uses more than 5M anyway, also
+        changing its soft limit:
+
+            xfsvolctl resize \
+                --root /mnt/xfs/volumes \
+                --name myvol \
+                --size 5M \
+                --soft-size 4M \
+                --force
+    `,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name, n",
+			Usage: "Name of the volume to resize",
+		},
+		cli.StringFlag{
+			Name:  "size, s",
+			Usage: "Size of the XFS project quota to apply (e.g.: 50M)",
+		},
+		cli.StringFlag{
+			Name:  "soft-size",
+			Usage: "Soft limit of the XFS project quota to apply (e.g.: 40M)",
+		},
+		cli.Uint64Flag{
+			Name:  "inode, i",
+			Usage: "Maximum number of INodes that can be created",
+		},
+		cli.Uint64Flag{
+			Name:  "soft-inode",
+			Usage: "Number of INodes after which the volume is over quota",
+		},
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "Whether to apply limits below the current usage of the volume",
+		},
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Value: manager.DefaultLockTimeout,
+			Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: resizeAction,
+}
+
+func resizeAction(c *cli.Context) (err error) {
+	var (
+		name     = c.String("name")
+		size     = c.String("size")
+		softSize = c.String("soft-size")
+		root     = c.String("root")
+		force    = c.Bool("force")
+		timeout  = c.Duration("lock-timeout")
+		debug    = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if name == "" || root == "" {
+		cli.ShowCommandHelp(c, "resize")
+		err = cli.NewExitError(
+			"Name and root are required parameters.", 1)
+		return
+	}
+
+	mgr, err := manager.New(manager.Config{
+		Root:        root,
+		LockTimeout: timeout,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate manager")
+		return
+	}
+
+	vol, found, err := mgr.Get(name)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't retrieve volume %s", name)
+		return
+	}
+
+	if !found {
+		err = exitError(manager.ErrNotFound,
+			"Couldn't resize volume %s", name)
+		return
+	}
+
+	var quota = xfs.Quota{
+		Size:      vol.Size,
+		SoftSize:  vol.SoftSize,
+		INode:     vol.INode,
+		SoftINode: vol.SoftINode,
+	}
+
+	if size != "" {
+		quota.Size, err = manager.FromHumanSize(size)
+		if err != nil {
+			err = exitError(err,
+				"Size '%s' can't be converted to uint64 bytes", size)
+			return
+		}
+	}
+
+	if softSize != "" {
+		quota.SoftSize, err = manager.FromHumanSize(softSize)
+		if err != nil {
+			err = exitError(err,
+				"Soft size '%s' can't be converted to uint64 bytes", softSize)
+			return
+		}
+	}
+
+	if c.IsSet("inode") {
+		quota.INode = c.Uint64("inode")
+	}
+
+	if c.IsSet("soft-inode") {
+		quota.SoftINode = c.Uint64("soft-inode")
+	}
+
+	_, err = mgr.Resize(name, quota, force)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't resize volume name=%s bytes=%d soft-bytes=%d inode=%d soft-inode=%d",
+			name, quota.Size, quota.SoftSize, quota.INode, quota.SoftINode)
+		return
+	}
+
+	return
+}
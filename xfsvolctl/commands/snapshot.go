@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cirocosta/xfsvol/manager"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// snapshotFlags are the flags shared by the snapshot
+// subcommands.
+var snapshotFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "root, r",
+		Usage: "Root of the volumes (under an xfs filesystem)",
+	},
+	cli.DurationFlag{
+		Name:  "lock-timeout",
+		Value: manager.DefaultLockTimeout,
+		Usage: "Maximum time to wait for other processes to release the locks of the root and its volumes",
+	},
+	cli.BoolFlag{
+		Name:  "debug",
+		Usage: "Whether debug logs should be displayed",
+	},
+}
+
+var Snapshot = cli.Command{
+	Name:  "snapshot",
+	Usage: "Manages point-in-time snapshots of volumes",
+	Description: `Manages point-in-time snapshots of the contents of volumes.
+   Snapshots are copies of volumes whose files are cloned with
+   reflinks (copy-on-write) when the XFS filesystem supports
+   them (formatted with 'reflink=1'), making them cheap to take.
+
+   Each snapshot has its own project id such that it doesn't
+   count towards the quota of the volume it's been taken from.
+
+   Snapshots are deleted together with their volume. Volumes
+   that are mounted are not restored unless '--force' is
+   specified.
+
+   Examples:
+
+     1. snapshot a database volume before running migrations
+        and roll it back after they failed:
+
+            xfsvolctl snapshot create \
+                --root /mnt/xfs/volumes \
+                --volume db \
+                --name pre-migration
+
+            xfsvolctl snapshot restore \
+                --root /mnt/xfs/volumes \
+                --volume db \
+                --name pre-migration
+
+     2. list the snapshots of every volume:
+
+            xfsvolctl snapshot ls \
+                --root /mnt/xfs/volumes
+
+            VOLUME   NAME            USED     USED-INODES   CREATED
+            db       pre-migration   1.2GB    1203          2018-01-02T03:04:05Z
+	`,
+	Subcommands: []cli.Command{
+		{
+			Name:   "create",
+			Usage:  "Takes a snapshot of a volume",
+			Flags:  append(snapshotVolumeFlags(), snapshotFlags...),
+			Action: snapshotCreateAction,
+		},
+		{
+			Name:  "ls",
+			Usage: "Lists snapshots (of every volume unless one is specified)",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "volume, v",
+					Usage: "Name of the volume to list the snapshots of",
+				},
+			}, snapshotFlags...),
+			Action: snapshotLsAction,
+		},
+		{
+			Name:  "restore",
+			Usage: "Replaces the contents of a volume with a snapshot of it",
+			Flags: append(append(snapshotVolumeFlags(),
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "Whether to restore the snapshot even if the volume is mounted",
+				}), snapshotFlags...),
+			Action: snapshotRestoreAction,
+		},
+		{
+			Name:   "rm",
+			Usage:  "Deletes a snapshot",
+			Flags:  append(snapshotVolumeFlags(), snapshotFlags...),
+			Action: snapshotRmAction,
+		},
+	},
+}
+
+// snapshotVolumeFlags are the flags that identify a snapshot.
+func snapshotVolumeFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:  "volume, v",
+			Usage: "Name of the volume",
+		},
+		cli.StringFlag{
+			Name:  "name, n",
+			Usage: "Name of the snapshot",
+		},
+	}
+}
+
+// snapshotManager parses the flags shared by the snapshot
+// subcommands and creates the manager of the root.
+func snapshotManager(c *cli.Context, requireName bool) (mgr *manager.Manager, err error) {
+	var (
+		root    = c.String("root")
+		volume  = c.String("volume")
+		name    = c.String("name")
+		timeout = c.Duration("lock-timeout")
+	)
+
+	if c.Bool("debug") {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if root == "" || (requireName && (volume == "" || name == "")) {
+		cli.ShowSubcommandHelp(c)
+		if requireName {
+			err = cli.NewExitError(
+				"Root, volume and name are required parameters.", 1)
+		} else {
+			err = cli.NewExitError("Root is a required parameter.", 1)
+		}
+		return
+	}
+
+	mgr, err = manager.New(manager.Config{
+		Root:        root,
+		LockTimeout: timeout,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate manager")
+		return
+	}
+
+	return
+}
+
+func snapshotCreateAction(c *cli.Context) (err error) {
+	mgr, err := snapshotManager(c, true)
+	if err != nil {
+		return
+	}
+
+	var (
+		volume = c.String("volume")
+		name   = c.String("name")
+	)
+
+	_, err = mgr.CreateSnapshot(volume, name)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't snapshot volume %s as %s", volume, name)
+		return
+	}
+
+	return
+}
+
+func snapshotLsAction(c *cli.Context) (err error) {
+	mgr, err := snapshotManager(c, false)
+	if err != nil {
+		return
+	}
+
+	var volume = c.String("volume")
+
+	snapshots, err := mgr.ListSnapshots(volume)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't list snapshots")
+		return
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "VOLUME\tNAME\tUSED\tUSED-INODES\tCREATED\t")
+
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			snapshot.Volume,
+			snapshot.Name,
+			manager.HumanSize(snapshot.UsedSize),
+			snapshot.UsedINode,
+			snapshot.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+	return
+}
+
+func snapshotRestoreAction(c *cli.Context) (err error) {
+	mgr, err := snapshotManager(c, true)
+	if err != nil {
+		return
+	}
+
+	var (
+		volume = c.String("volume")
+		name   = c.String("name")
+	)
+
+	if c.Bool("force") {
+		err = mgr.ForceRestoreSnapshot(volume, name)
+	} else {
+		err = mgr.RestoreSnapshot(volume, name)
+	}
+	if err != nil {
+		err = exitError(err,
+			"Couldn't restore snapshot %s of volume %s", name, volume)
+		return
+	}
+
+	return
+}
+
+func snapshotRmAction(c *cli.Context) (err error) {
+	mgr, err := snapshotManager(c, true)
+	if err != nil {
+		return
+	}
+
+	var (
+		volume = c.String("volume")
+		name   = c.String("name")
+	)
+
+	err = mgr.DeleteSnapshot(volume, name)
+	if err != nil {
+		err = exitError(err,
+			"Couldn't delete snapshot %s of volume %s", name, volume)
+		return
+	}
+
+	return
+}
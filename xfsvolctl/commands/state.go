@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cirocosta/xfsvol/xfs"
+	"github.com/rs/zerolog"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var State = cli.Command{
+	Name:  "state",
+	Usage: "Displays the quota state of the filesystem holding the volumes",
+	Description: `Displays the quota state of the filesystem.
+   Reports, for each kind of quota (user, group and project), whether
+   accounting and enforcement are turned on, as well as information
+   about the files that hold the quota records, the default grace
+   periods and warning limits.
+
+   A volume only gets its limits enforced if the 'project' quota
+   has both accounting and enforcement on.
+
+   Examples:
+
+     1. check the state of a filesystem mounted with 'pqnoenforce':
+
+            xfsvolctl state \
+                --root /mnt/xfs
+
+            TYPE      ACCOUNTING   ENFORCEMENT   INODE   BLOCKS   EXTENTS
+            user      off          off           0       0        0
+            group     off          off           0       0        0
+            project   on           off           131     8        1
+
+            BLK-GRACE   INODE-GRACE   BLK-WARNINGS   INODE-WARNINGS
+            168h0m0s    168h0m0s      5              5
+	`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "root, r",
+			Usage: "Root of the volumes (under an xfs filesystem)",
+		},
+		cli.BoolFlag{
+			Name:  "debug",
+			Usage: "Whether debug logs should be displayed",
+		},
+	},
+	Action: stateAction,
+}
+
+func stateAction(c *cli.Context) (err error) {
+	var (
+		root  = c.String("root")
+		debug = c.Bool("debug")
+	)
+
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	if root == "" {
+		cli.ShowCommandHelp(c, "state")
+		err = cli.NewExitError("Root is a required parameter.", 1)
+		return
+	}
+
+	// only inspecting: neither create a device node under a root
+	// that might be served by the plugin nor check whether it's
+	// fit for enforcing quotas (which the state tells).
+	ctl, err := xfs.NewControl(xfs.ControlConfig{
+		BasePath:        root,
+		BlockDeviceMode: xfs.BlockDeviceModeLookup,
+		PreflightMode:   xfs.PreflightModeSkip,
+	})
+	if err != nil {
+		err = exitError(err,
+			"Couldn't initiate quota control")
+		return
+	}
+
+	state, err := xfs.GetQuotaState(ctl.GetBackingFsBlockDev())
+	if err != nil {
+		err = exitError(err,
+			"Couldn't retrieve quota state under root %s", root)
+		return
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
+	fmt.Fprintln(w, "TYPE\tACCOUNTING\tENFORCEMENT\tINODE\tBLOCKS\tEXTENTS\t")
+
+	for _, typeState := range []struct {
+		name  string
+		state xfs.QuotaTypeState
+	}{
+		{"user", state.User},
+		{"group", state.Group},
+		{"project", state.Project},
+	} {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n",
+			typeState.name,
+			onOff(typeState.state.Accounting),
+			onOff(typeState.state.Enforcement),
+			typeState.state.File.INode,
+			typeState.state.File.Blocks,
+			typeState.state.File.Extents)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "BLK-GRACE\tINODE-GRACE\tBLK-WARNINGS\tINODE-WARNINGS\t")
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\n",
+		state.GracePeriods.Size,
+		state.GracePeriods.INode,
+		state.SizeWarnLimit,
+		state.INodeWarnLimit)
+	w.Flush()
+	return
+}
+
+// onOff converts a flag into its textual representation.
+func onOff(flag bool) string {
+	if flag {
+		return "on"
+	}
+
+	return "off"
+}
@@ -18,10 +18,18 @@ func main() {
 	app.Name = "xfsvolctl"
 	app.Version = version
 	app.Usage = "Controls the 'xfsvol' volume plugin"
+	app.Description = commands.ExitCodesHelp
 	app.Commands = []cli.Command{
 		commands.Ls,
 		commands.Create,
+		commands.Resize,
+		commands.Clone,
+		commands.Snapshot,
 		commands.Delete,
+		commands.Grace,
+		commands.State,
+		commands.Report,
+		commands.Projects,
 	}
 	app.Run(os.Args)
 }